@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/archive"
+	"github.com/oszuidwest/zwfm-audiologger/internal/check"
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+	"github.com/oszuidwest/zwfm-audiologger/internal/layout"
+	"github.com/oszuidwest/zwfm-audiologger/internal/manifest"
+	"github.com/oszuidwest/zwfm-audiologger/internal/migrate"
+	"github.com/oszuidwest/zwfm-audiologger/internal/tier"
+	"github.com/oszuidwest/zwfm-audiologger/internal/tsa"
+	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
+	"github.com/oszuidwest/zwfm-audiologger/internal/validator"
+)
+
+// subcommands maps the first command-line argument to a one-shot command. Each
+// command receives the remaining arguments and returns the process exit code.
+var subcommands = map[string]func(args []string) int{
+	"verify":            runVerify,
+	"verify-timestamps": runVerifyTimestamps,
+	"revalidate":        runRevalidate,
+	"check":             runCheck,
+	"migrate-layout":    runMigrateLayout,
+}
+
+// loadCommandConfig parses the -config flag shared by all subcommands and loads
+// the configuration.
+func loadCommandConfig(fs *flag.FlagSet, args []string) (*config.Config, error) {
+	configFile := fs.String("config", "config.json", "Config file path")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	utils.SetTimezone(cfg.Timezone)
+	if err := layout.Set(cfg.Layout); err != nil {
+		return nil, fmt.Errorf("invalid layout: %w", err)
+	}
+	utils.AddSecrets(cfg.Secrets()...)
+	return cfg, nil
+}
+
+// commandContext returns a context that is cancelled on SIGINT or SIGTERM.
+func commandContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+}
+
+// runVerify checks the recordings against the integrity manifests.
+func runVerify(args []string) int {
+	cfg, err := loadCommandConfig(flag.NewFlagSet("verify", flag.ContinueOnError), args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	var archiveTier tier.Tier
+	if cfg.ArchiveTier != nil && cfg.ArchiveTier.Enabled {
+		if archiveTier, err = tier.New(cfg.ArchiveTier); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to initialize archive tier: %v\n", err)
+			return 2
+		}
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	report, err := manifest.New(cfg, archiveTier).Verify(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "verification failed: %v\n", err)
+		return 2
+	}
+	manifest.WriteReport(os.Stdout, report)
+	if !report.OK() {
+		return 1
+	}
+	return 0
+}
+
+// runVerifyTimestamps checks the RFC 3161 timestamp responses of the recordings
+// given as arguments, or of every timestamped recording when none are given.
+func runVerifyTimestamps(args []string) int {
+	fs := flag.NewFlagSet("verify-timestamps", flag.ContinueOnError)
+	cfg, err := loadCommandConfig(fs, args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	var caFile string
+	if cfg.Timestamping != nil {
+		caFile = cfg.Timestamping.CAFile
+	}
+	roots, err := tsa.LoadRoots(caFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	recordings := fs.Args()
+	if len(recordings) == 0 {
+		recordings = timestampedRecordings(cfg)
+	}
+
+	failed := 0
+	for _, path := range recordings {
+		info, err := tsa.VerifyFile(path, roots)
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL  %s: %v\n", path, err)
+			continue
+		}
+		fmt.Printf("OK    %s  %s  %s\n", path, info.GenTime.Format(time.RFC3339), info.Signer)
+	}
+	fmt.Printf("%d recordings checked, %d failed\n", len(recordings), failed)
+	if roots == nil {
+		fmt.Println("No ca_file configured: signatures were checked but the TSA certificate was not.")
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// timestampedRecordings returns the audio files in the recordings directory
+// that have a timestamp response.
+func timestampedRecordings(cfg *config.Config) []string {
+	var paths []string
+	stations := slices.Sorted(maps.Keys(cfg.Stations))
+	for _, station := range stations {
+		recordings, err := archive.Scan(cfg.RecordingsDir, station)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read station %s: %v\n", station, err)
+			continue
+		}
+		for _, rec := range recordings {
+			if rec.Audio != "" && rec.File(constants.TimestampFileSuffix) != "" {
+				paths = append(paths, rec.Audio)
+			}
+		}
+	}
+	return paths
+}
+
+// runCheck checks the configuration, the metadata endpoints and the streams.
+func runCheck(args []string) int {
+	cfg, err := loadCommandConfig(flag.NewFlagSet("check", flag.ContinueOnError), args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	report := check.Run(ctx, cfg, check.Probe)
+	check.WriteReport(os.Stdout, report)
+	if !report.OK() {
+		return 1
+	}
+	return 0
+}
+
+// runRevalidate validates recordings again under the current configuration
+// and reports how their results changed.
+func runRevalidate(args []string) int {
+	fs := flag.NewFlagSet("revalidate", flag.ContinueOnError)
+	var opts validator.RevalidateOptions
+	fs.StringVar(&opts.Station, "station", "", "Station to re-validate (default all)")
+	fs.StringVar(&opts.From, "from", "", "First day to re-validate, YYYY-MM-DD")
+	fs.StringVar(&opts.To, "to", "", "Last day to re-validate, YYYY-MM-DD (default today)")
+	fs.BoolVar(&opts.OnlyInvalid, "only-invalid", false, "Only re-validate recordings that failed validation")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "Report changes without writing results or sending alerts")
+	fs.BoolVar(&opts.Alert, "alert", false, "Send alerts for recordings that fail")
+	cfg, err := loadCommandConfig(fs, args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if cfg.Validation == nil || !cfg.Validation.Enabled {
+		fmt.Fprintln(os.Stderr, "validation is not enabled in the config")
+		return 2
+	}
+
+	validatorManager, err := validator.New(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialize validator: %v\n", err)
+		return 2
+	}
+	defer validatorManager.Stop()
+
+	// Record the rewritten sidecars in the integrity manifest, as the running
+	// logger would.
+	if !opts.DryRun && cfg.Integrity != nil && cfg.Integrity.Enabled {
+		var archiveTier tier.Tier
+		if cfg.ArchiveTier != nil && cfg.ArchiveTier.Enabled {
+			if archiveTier, err = tier.New(cfg.ArchiveTier); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to initialize archive tier: %v\n", err)
+				return 2
+			}
+		}
+		validatorManager.AddObserver(manifest.New(cfg, archiveTier))
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	report, err := validatorManager.Revalidate(ctx, opts)
+	if report != nil {
+		validator.WriteRevalidationReport(os.Stdout, report)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "re-validation failed: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+// runMigrateLayout moves the recordings from an earlier layout into the one in
+// the configuration. The service must be stopped while it runs.
+func runMigrateLayout(args []string) int {
+	fs := flag.NewFlagSet("migrate-layout", flag.ContinueOnError)
+	fromTemplate := fs.String("from", constants.DefaultLayout, "Layout the recordings are stored in now")
+	dryRun := fs.Bool("dry-run", false, "List the moves without changing anything")
+	cfg, err := loadCommandConfig(fs, args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	from, err := layout.Parse(*fromTemplate)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -from layout: %v\n", err)
+		return 2
+	}
+
+	report, err := migrate.Run(cfg, from, layout.Current(), *dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migration failed: %v\n", err)
+		return 2
+	}
+
+	// Carry the hashes of the moved files over in the integrity manifest, so
+	// verification follows them to their new paths.
+	if !*dryRun && len(report.Moves) > 0 && cfg.Integrity != nil && cfg.Integrity.Enabled {
+		if _, err := manifest.New(cfg, nil).RecordMoves(report.Moves); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("integrity manifest: %v", err))
+		}
+	}
+
+	migrate.WriteReport(os.Stdout, report, *dryRun)
+	if !report.OK() {
+		return 1
+	}
+	return 0
+}
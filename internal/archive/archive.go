@@ -0,0 +1,193 @@
+// Package archive enumerates recordings and their sidecar files on disk.
+package archive
+
+import (
+	"cmp"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+	"github.com/oszuidwest/zwfm-audiologger/internal/layout"
+	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
+)
+
+// Recording groups the files that belong to one recorded hour of a station:
+// the audio file, the temporary capture file and any sidecars.
+type Recording struct {
+	Station   string
+	Timestamp string
+	// Time is the recording start parsed from the file name. When the name does
+	// not carry a valid timestamp it falls back to the newest file modification time.
+	Time time.Time
+	// Parsed reports whether Time was taken from the file name.
+	Parsed bool
+	// Audio is the path of the finished audio file, empty when only sidecars exist.
+	Audio string
+	// Files lists every file of the recording, including Audio.
+	Files []string
+	// Size is the combined size of all files in bytes.
+	Size int64
+}
+
+// File returns the path of the file with the given suffix (for example ".meta"),
+// or an empty string when the recording has no such file.
+func (r *Recording) File(suffix string) string {
+	for _, f := range r.Files {
+		if strings.HasSuffix(f, suffix) {
+			return f
+		}
+	}
+	return ""
+}
+
+// Original returns the path of the recording as captured, kept next to a
+// transcoded recording, or an empty string when there is none.
+func (r *Recording) Original() string {
+	return r.variant(constants.OriginalFileSuffix)
+}
+
+// Proxy returns the path of the low-bitrate copy of the recording, or an
+// empty string when there is none.
+func (r *Recording) Proxy() string {
+	return r.variant(constants.ProxyFileSuffix)
+}
+
+// variant returns the path of the audio file named timestamp+infix+extension.
+func (r *Recording) variant(infix string) string {
+	for _, f := range r.Files {
+		_, suffix := SplitName(path.Base(filepath.ToSlash(f)))
+		if strings.HasPrefix(suffix, infix+".") {
+			return f
+		}
+	}
+	return ""
+}
+
+// InProgress reports whether the temporary capture file still exists, meaning
+// the recording is being written or was interrupted before remux.
+func (r *Recording) InProgress() bool {
+	return r.File(".mkv") != ""
+}
+
+// SplitName splits a recording file name into its timestamp and suffix at the
+// first dot, so "2026-04-30-22.validation.json" yields "2026-04-30-22" and
+// ".validation.json".
+func SplitName(name string) (timestamp, suffix string) {
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		return name[:i], name[i:]
+	}
+	return name, ""
+}
+
+// SplitPath splits the path of a recording file into its timestamp and suffix
+// following the configured layout. Paths that do not follow it, such as test
+// recordings and files of an earlier flat layout, are split by their name.
+func SplitPath(path string) (timestamp, suffix string) {
+	if timestamp, suffix, ok := layout.Current().Timestamp(path); ok {
+		return timestamp, suffix
+	}
+	return SplitName(filepath.Base(path))
+}
+
+// IsAudio reports whether a file name is that of a finished recording, not of
+// the original or proxy kept next to it, such as "2026-04-30-22.mp3".
+func IsAudio(name string) bool {
+	_, suffix := SplitName(path.Base(filepath.ToSlash(name)))
+	return utils.IsAudioFile(name) && !strings.Contains(suffix[1:], ".")
+}
+
+// File is a single file of the archive.
+type File struct {
+	// Path locates the file; Group keeps it as given.
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Scan returns the recordings of a station in the recordings directory, oldest
+// first. A missing station directory yields no recordings and no error.
+func Scan(recordingsDir, station string) ([]Recording, error) {
+	files, err := ScanFiles(recordingsDir, station)
+	if err != nil || files == nil {
+		return nil, err
+	}
+	return Group(station, files), nil
+}
+
+// ScanFiles returns the files of a station in the recordings directory,
+// including those in the subdirectories of the layout. Hidden directories are
+// skipped. A missing station directory yields no files and no error.
+func ScanFiles(recordingsDir, station string) ([]File, error) {
+	dir := filepath.Join(recordingsDir, station)
+	var files []File
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil // Removed while walking, or no recordings yet.
+			}
+			return err
+		}
+		if entry.IsDir() {
+			if path != dir && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil // Removed between ReadDir and Info.
+		}
+		files = append(files, File{Path: path, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	return files, err
+}
+
+// Group sorts the files of a station into recordings by the timestamp in their
+// paths, oldest first. Hidden files are skipped.
+func Group(station string, files []File) []Recording {
+	groups := make(map[string]*Recording)
+	for _, file := range files {
+		name := path.Base(filepath.ToSlash(file.Path))
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		timestamp, _ := SplitPath(file.Path)
+		rec, ok := groups[timestamp]
+		if !ok {
+			rec = &Recording{Station: station, Timestamp: timestamp}
+			if t, err := utils.ParseTimestamp(timestamp); err == nil {
+				rec.Time = t
+				rec.Parsed = true
+			}
+			groups[timestamp] = rec
+		}
+
+		rec.Files = append(rec.Files, file.Path)
+		rec.Size += file.Size
+		if IsAudio(name) {
+			rec.Audio = file.Path
+		}
+		if !rec.Parsed && file.ModTime.After(rec.Time) {
+			rec.Time = file.ModTime
+		}
+	}
+
+	recordings := make([]Recording, 0, len(groups))
+	for _, rec := range groups {
+		recordings = append(recordings, *rec)
+	}
+	slices.SortFunc(recordings, func(a, b Recording) int {
+		if c := a.Time.Compare(b.Time); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Timestamp, b.Timestamp)
+	})
+	return recordings
+}
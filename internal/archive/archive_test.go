@@ -0,0 +1,118 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+	"github.com/oszuidwest/zwfm-audiologger/internal/layout"
+)
+
+func TestScanGroupsFilesByTimestamp(t *testing.T) {
+	dir := t.TempDir()
+	stationDir := filepath.Join(dir, "station")
+	if err := os.MkdirAll(stationDir, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		"2026-04-30-23.mp3",
+		"2026-04-30-23.meta",
+		"2026-04-30-23.validation.json",
+		"2026-04-30-23.original.aac",
+		"2026-04-30-22.meta",
+		"2026-05-01-00.mkv",
+		".hidden",
+	} {
+		if err := os.WriteFile(filepath.Join(stationDir, name), []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recordings, err := Scan(dir, "station")
+	if err != nil {
+		t.Fatalf("Scan returned error: %v", err)
+	}
+	if len(recordings) != 3 {
+		t.Fatalf("len(recordings) = %d, want 3", len(recordings))
+	}
+
+	wantOrder := []string{"2026-04-30-22", "2026-04-30-23", "2026-05-01-00"}
+	for i, want := range wantOrder {
+		if recordings[i].Timestamp != want {
+			t.Errorf("recordings[%d].Timestamp = %q, want %q", i, recordings[i].Timestamp, want)
+		}
+		if !recordings[i].Parsed {
+			t.Errorf("recordings[%d].Parsed = false, want true", i)
+		}
+	}
+
+	if recordings[0].Audio != "" {
+		t.Errorf("orphaned metadata has Audio = %q, want empty", recordings[0].Audio)
+	}
+	complete := recordings[1]
+	if complete.Audio != filepath.Join(stationDir, "2026-04-30-23.mp3") {
+		t.Errorf("Audio = %q", complete.Audio)
+	}
+	if len(complete.Files) != 4 || complete.Size != 4 {
+		t.Errorf("Files = %v, Size = %d, want 4 files of 4 bytes", complete.Files, complete.Size)
+	}
+	if complete.Original() != filepath.Join(stationDir, "2026-04-30-23.original.aac") {
+		t.Errorf("Original = %q", complete.Original())
+	}
+	if complete.File(".validation.json") == "" {
+		t.Error("validation sidecar not found")
+	}
+	if !recordings[2].InProgress() {
+		t.Error("recording with .mkv file should be in progress")
+	}
+}
+
+func TestScanMissingStationDirectory(t *testing.T) {
+	recordings, err := Scan(t.TempDir(), "missing")
+	if err != nil || recordings != nil {
+		t.Fatalf("Scan = %v, %v, want nil, nil", recordings, err)
+	}
+}
+
+func TestScanFollowsLayout(t *testing.T) {
+	if err := layout.Set("{station}/{yyyy}/{mm}/{dd}/{hh}.{ext}"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = layout.Set(constants.DefaultLayout) })
+
+	dir := t.TempDir()
+	for _, name := range []string{
+		"station/2026/04/30/23.mp3",
+		"station/2026/04/30/23.meta",
+		"station/2026/05/01/00.mp3",
+		"station/2026-04-30-22.mp3", // Not yet migrated
+		"station/test-2026-04-30-21-15-00.mp3",
+		"station/.partial/2026/04/30/20.mp3",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recordings, err := Scan(dir, "station")
+	if err != nil {
+		t.Fatalf("Scan returned error: %v", err)
+	}
+	var timestamps []string
+	for _, rec := range recordings {
+		timestamps = append(timestamps, rec.Timestamp)
+	}
+	want := []string{"test-2026-04-30-21-15-00", "2026-04-30-22", "2026-04-30-23", "2026-05-01-00"}
+	if !slices.Equal(timestamps, want) {
+		t.Fatalf("timestamps = %q, want %q", timestamps, want)
+	}
+	if rec := recordings[2]; rec.Audio != filepath.Join(dir, "station", "2026", "04", "30", "23.mp3") || len(rec.Files) != 2 {
+		t.Errorf("Audio = %q, Files = %q, want the hour and its metadata", rec.Audio, rec.Files)
+	}
+}
@@ -0,0 +1,248 @@
+// Package check verifies a configuration against the outside world before it
+// goes live: the settings themselves, the metadata endpoints and the streams.
+package check
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+	"github.com/oszuidwest/zwfm-audiologger/internal/metadata"
+	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
+	"github.com/oszuidwest/zwfm-audiologger/internal/validator"
+)
+
+// probeTimeout limits how long a single stream probe may take.
+const probeTimeout = 30 * time.Second
+
+// Result is the outcome of one check.
+type Result struct {
+	Subject string
+	OK      bool
+	Message string
+}
+
+// Report lists the outcome of every check.
+type Report struct {
+	Results []Result
+}
+
+// OK reports whether all checks passed.
+func (r *Report) OK() bool {
+	for _, result := range r.Results {
+		if !result.OK {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Report) pass(subject, format string, args ...any) {
+	r.Results = append(r.Results, Result{Subject: subject, OK: true, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *Report) fail(subject, format string, args ...any) {
+	r.Results = append(r.Results, Result{Subject: subject, Message: fmt.Sprintf(format, args...)})
+}
+
+// StreamInfo describes the audio of a stream.
+type StreamInfo struct {
+	Codec       string
+	BitRate     int // Bits per second; zero when the stream does not report it
+	SampleRate  int
+	Channels    int
+	Description string // Stream title or server name, when reported
+}
+
+// ProbeFunc probes a stream.
+type ProbeFunc func(ctx context.Context, streamURL string) (StreamInfo, error)
+
+// Run checks the configuration, resolves the metadata path of every station
+// against its live metadata endpoint and probes every stream.
+func Run(ctx context.Context, cfg *config.Config, probe ProbeFunc) *Report {
+	report := &Report{}
+	checkConfig(report, cfg)
+
+	// Stations are checked in parallel, since each probe waits on the network.
+	names := slices.Sorted(maps.Keys(cfg.Stations))
+	reports := make([]Report, len(names))
+	fetcher := metadata.New()
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Go(func() {
+			checkStation(ctx, &reports[i], fetcher, probe, name, cfg.Stations[name])
+		})
+	}
+	wg.Wait()
+	for _, r := range reports {
+		report.Results = append(report.Results, r.Results...)
+	}
+	return report
+}
+
+// checkConfig checks the settings that can be verified without the network.
+func checkConfig(report *Report, cfg *config.Config) {
+	if len(cfg.Stations) == 0 {
+		report.fail("config", "no stations configured")
+	}
+	if _, err := time.LoadLocation(cfg.Timezone); err != nil {
+		report.fail("config", "invalid timezone %q: %v", cfg.Timezone, err)
+	} else {
+		report.pass("config", "timezone %s", cfg.Timezone)
+	}
+
+	v := cfg.Validation
+	if v == nil || !v.Enabled {
+		return
+	}
+	for _, station := range slices.Sorted(maps.Keys(v.StationRecipients)) {
+		if _, ok := cfg.Stations[station]; !ok {
+			report.fail("config", "validation.station_recipients lists unknown station %q", station)
+		}
+	}
+	if v.Alert != nil && v.Alert.Enabled {
+		if err := validator.ValidateCredentials(v.Alert); err != nil {
+			report.fail("config", "validation.alert: %v", err)
+		} else {
+			report.pass("config", "alert credentials have a valid format")
+		}
+	}
+}
+
+// checkStation resolves the metadata of a station and probes its stream.
+func checkStation(ctx context.Context, report *Report, fetcher *metadata.Fetcher, probe ProbeFunc, name string, station config.Station) {
+	subject := name + " stream"
+	probeCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+	info, err := probe(probeCtx, station.StreamURL)
+	cancel()
+	if err != nil {
+		report.fail(subject, "%v", err)
+	} else {
+		report.pass(subject, "%s", info)
+	}
+
+	if station.MetadataURL == "" {
+		return
+	}
+	subject = name + " metadata"
+	if station.ParseMetadata && station.MetadataPath == "" {
+		report.fail(subject, "parse_metadata is set but metadata_path is empty")
+		return
+	}
+	value, err := fetcher.Resolve(ctx, station.MetadataURL, station.MetadataPath, station.ParseMetadata)
+	switch {
+	case err != nil:
+		report.fail(subject, "%v", err)
+	case value == "":
+		report.fail(subject, "%s returned an empty value", station.MetadataURL)
+	default:
+		report.pass(subject, "%q", value)
+	}
+}
+
+// String formats the stream information for the report.
+func (s StreamInfo) String() string {
+	parts := []string{s.Codec}
+	if s.BitRate > 0 {
+		parts = append(parts, fmt.Sprintf("%d kb/s", s.BitRate/1000))
+	} else {
+		parts = append(parts, "unknown bitrate")
+	}
+	parts = append(parts, fmt.Sprintf("%d Hz", s.SampleRate))
+	switch s.Channels {
+	case 1:
+		parts = append(parts, "mono")
+	case 2:
+		parts = append(parts, "stereo")
+	default:
+		parts = append(parts, fmt.Sprintf("%d channels", s.Channels))
+	}
+	if s.Description != "" {
+		parts = append(parts, strconv.Quote(s.Description))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// streamProbe holds the parts of the ffprobe output that describe a stream.
+type streamProbe struct {
+	Streams []struct {
+		CodecName  string `json:"codec_name"`
+		SampleRate string `json:"sample_rate"`
+		Channels   int    `json:"channels"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"streams"`
+	Format struct {
+		BitRate string            `json:"bit_rate"`
+		Tags    map[string]string `json:"tags"`
+	} `json:"format"`
+}
+
+// Probe connects to a stream with ffprobe and reports its audio format.
+func Probe(ctx context.Context, streamURL string) (StreamInfo, error) {
+	cmd := utils.StreamProbeCommand(ctx, streamURL)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return StreamInfo{}, fmt.Errorf("ffprobe failed: %s", msg)
+		}
+		return StreamInfo{}, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	return parseProbe(bytes.NewReader(output))
+}
+
+// parseProbe extracts the stream information from ffprobe JSON output.
+func parseProbe(r io.Reader) (StreamInfo, error) {
+	var probe streamProbe
+	if err := json.NewDecoder(r).Decode(&probe); err != nil {
+		return StreamInfo{}, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+	if len(probe.Streams) == 0 {
+		return StreamInfo{}, errors.New("no audio stream found")
+	}
+
+	stream := probe.Streams[0]
+	info := StreamInfo{Codec: stream.CodecName, Channels: stream.Channels}
+	info.SampleRate, _ = strconv.Atoi(stream.SampleRate)
+	// Streams in a container report their own bitrate; raw streams such as
+	// Icecast MP3 only report the overall bitrate.
+	if info.BitRate, _ = strconv.Atoi(stream.BitRate); info.BitRate == 0 {
+		info.BitRate, _ = strconv.Atoi(probe.Format.BitRate)
+	}
+	for _, tag := range []string{"icy-name", "StreamTitle", "title"} {
+		if name := probe.Format.Tags[tag]; name != "" {
+			info.Description = name
+			break
+		}
+	}
+	return info, nil
+}
+
+// WriteReport writes a human-readable check report.
+func WriteReport(w io.Writer, report *Report) {
+	failed := 0
+	for _, result := range report.Results {
+		status := "OK  "
+		if !result.OK {
+			status = "FAIL"
+			failed++
+		}
+		_, _ = fmt.Fprintf(w, "%s  %s: %s\n", status, result.Subject, utils.Redact(result.Message))
+	}
+	if failed == 0 {
+		_, _ = fmt.Fprintln(w, "All checks passed")
+		return
+	}
+	_, _ = fmt.Fprintf(w, "%d of %d checks failed\n", failed, len(report.Results))
+}
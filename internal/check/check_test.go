@@ -0,0 +1,120 @@
+package check
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+)
+
+// icecastProbe is ffprobe output for an Icecast MP3 stream, which only reports
+// the bitrate of the format.
+const icecastProbe = `{
+    "streams": [
+        {
+            "index": 0,
+            "codec_name": "mp3",
+            "codec_type": "audio",
+            "sample_fmt": "fltp",
+            "sample_rate": "44100",
+            "channels": 2,
+            "channel_layout": "stereo"
+        }
+    ],
+    "format": {
+        "filename": "https://icecast.example.com/radio.mp3",
+        "format_name": "mp3",
+        "bit_rate": "192000",
+        "tags": {
+            "icy-name": "Radio Example"
+        }
+    }
+}`
+
+func TestParseProbe(t *testing.T) {
+	info, err := parseProbe(strings.NewReader(icecastProbe))
+	if err != nil {
+		t.Fatalf("parseProbe returned error: %v", err)
+	}
+	want := StreamInfo{Codec: "mp3", BitRate: 192000, SampleRate: 44100, Channels: 2, Description: "Radio Example"}
+	if info != want {
+		t.Errorf("parseProbe = %+v, want %+v", info, want)
+	}
+	if got := info.String(); got != `mp3, 192 kb/s, 44100 Hz, stereo, "Radio Example"` {
+		t.Errorf("String = %s", got)
+	}
+
+	if _, err := parseProbe(strings.NewReader(`{"streams": [], "format": {}}`)); err == nil {
+		t.Error("parseProbe accepted output without an audio stream")
+	}
+}
+
+func TestRunReportsProblems(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"data": {"current": {"title": "Artist - Title"}}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{
+		Timezone: "Europe/Amsterdm",
+		Stations: map[string]config.Station{
+			"good": {
+				StreamURL:     "https://stream.example.com/good.mp3",
+				MetadataURL:   server.URL,
+				MetadataPath:  "data.current.title",
+				ParseMetadata: true,
+			},
+			"broken": {
+				StreamURL:     "https://stream.example.com/broken.mp3",
+				MetadataURL:   server.URL,
+				MetadataPath:  "data.now.title",
+				ParseMetadata: true,
+			},
+		},
+		Validation: &config.ValidationConfig{
+			Enabled: true,
+			Alert: &config.AlertConfig{
+				Enabled:      true,
+				TenantID:     "not-a-guid",
+				ClientID:     "00000000-0000-0000-0000-000000000000",
+				ClientSecret: "secret",
+				SenderEmail:  "alerts@example.com",
+			},
+			StationRecipients: map[string][]string{"goood": {"ops@example.com"}},
+		},
+	}
+	probe := func(_ context.Context, streamURL string) (StreamInfo, error) {
+		if strings.Contains(streamURL, "broken") {
+			return StreamInfo{}, errors.New("ffprobe failed: Server returned 404 Not Found")
+		}
+		return StreamInfo{Codec: "mp3", BitRate: 128000, SampleRate: 44100, Channels: 2}, nil
+	}
+
+	report := Run(context.Background(), cfg, probe)
+	if report.OK() {
+		t.Fatal("report is OK, want problems")
+	}
+
+	failed := map[string][]string{}
+	passed := map[string]bool{}
+	for _, result := range report.Results {
+		if result.OK {
+			passed[result.Subject] = true
+		} else {
+			failed[result.Subject] = append(failed[result.Subject], result.Message)
+		}
+	}
+	if len(failed["config"]) != 3 {
+		t.Errorf("config problems = %q, want timezone, station_recipients and alert", failed["config"])
+	}
+	if len(failed["broken stream"]) != 1 || len(failed["broken metadata"]) != 1 {
+		t.Errorf("broken station problems = %v", failed)
+	}
+	if !passed["good stream"] || !passed["good metadata"] {
+		t.Errorf("good station did not pass: %v", failed)
+	}
+}
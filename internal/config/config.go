@@ -2,32 +2,213 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"os"
+	"maps"
+	"path/filepath"
+	"slices"
+	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
 )
 
 // Config represents the application configuration.
 type Config struct {
-	RecordingsDir string             `json:"recordings_dir"`
-	Port          int                `json:"port"`
-	KeepDays      int                `json:"keep_days"`
-	Timezone      string             `json:"timezone"`
-	Stations      map[string]Station `json:"stations"`
-	Validation    *ValidationConfig  `json:"validation,omitempty"`
+	RecordingsDir string `json:"recordings_dir"`
+	StateDir      string `json:"state_dir,omitempty"`
+	// Layout is the path of each recording below recordings_dir, such as
+	// "{station}/{yyyy}/{mm}/{dd}/{hh}.{ext}".
+	Layout          string             `json:"layout,omitempty"`
+	Port            int                `json:"port"`
+	APIToken        string             `json:"api_token,omitempty"` // Bearer token for the endpoints that change state
+	KeepDays        int                `json:"keep_days"`
+	KeepInvalidDays int                `json:"keep_invalid_days,omitempty"`
+	Timezone        string             `json:"timezone"`
+	Stations        map[string]Station `json:"stations"`
+	Validation      *ValidationConfig  `json:"validation,omitempty"`
+	Quota           *QuotaConfig       `json:"quota,omitempty"`
+	ArchiveTier     *ArchiveTierConfig `json:"archive_tier,omitempty"`
+	Upload          *UploadConfig      `json:"upload,omitempty"`
+	Integrity       *IntegrityConfig   `json:"integrity,omitempty"`
+	Timestamping    *TimestampConfig   `json:"timestamping,omitempty"`
+	Proxy           *ProxyConfig       `json:"proxy,omitempty"`
+	// Include lists file patterns, relative to this file, whose settings are
+	// merged in, such as "stations.d/*.yaml" with one station per file.
+	Include []string `json:"include,omitempty"`
+
+	files []string // The config file and the files it includes
+}
+
+// Files returns the config file and the files it includes, as read by Load.
+func (c *Config) Files() []string {
+	return c.files
+}
+
+// TimestampConfig holds settings for RFC 3161 timestamp tokens of finished
+// recordings.
+type TimestampConfig struct {
+	Enabled  bool   `json:"enabled"`
+	URL      string `json:"url"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// CAFile is a PEM bundle of trusted TSA roots. Without it only the token
+	// signature is checked, not who issued the TSA certificate.
+	CAFile string `json:"ca_file,omitempty"`
+}
+
+// ProxyConfig holds settings for the low-bitrate copies of recordings that
+// are served for listening back. KeepDays limits how long proxies are kept;
+// zero keeps them as long as their recording.
+type ProxyConfig struct {
+	Enabled     bool   `json:"enabled"`
+	Codec       string `json:"codec,omitempty"`
+	BitrateKbps int    `json:"bitrate_kbps,omitempty"`
+	Channels    int    `json:"channels,omitempty"`
+	KeepDays    int    `json:"keep_days,omitempty"`
+}
+
+// Profile returns the encoding of proxies.
+func (p *ProxyConfig) Profile() *TranscodeConfig {
+	return &TranscodeConfig{Codec: p.Codec, BitrateKbps: p.BitrateKbps, Channels: p.Channels}
+}
+
+// IntegrityConfig holds settings for the SHA-256 manifests of finished files.
+type IntegrityConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+// UploadConfig holds settings for copying every finished recording and its
+// sidecars to an S3-compatible bucket.
+type UploadConfig struct {
+	Enabled bool      `json:"enabled"`
+	S3      *S3Config `json:"s3"`
+}
+
+// ArchiveTierConfig holds settings for moving older recordings from
+// recordings_dir to secondary storage: either a local path or an S3 bucket.
+type ArchiveTierConfig struct {
+	Enabled   bool      `json:"enabled"`
+	AfterDays int       `json:"after_days"`
+	Path      string    `json:"path,omitempty"`
+	S3        *S3Config `json:"s3,omitempty"`
+}
+
+// S3Config holds the connection settings for an S3-compatible bucket.
+type S3Config struct {
+	Endpoint  string `json:"endpoint"`
+	Region    string `json:"region,omitempty"`
+	Bucket    string `json:"bucket"`
+	Prefix    string `json:"prefix,omitempty"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+}
+
+// QuotaConfig holds settings for size-based retention. When enabled, recordings
+// are deleted oldest first to stay within the configured sizes instead of after
+// keep_days. Sizes are human-readable strings such as "500 GB".
+type QuotaConfig struct {
+	Enabled        bool   `json:"enabled"`
+	MaxArchiveSize string `json:"max_archive_size,omitempty"`
+	MinFreeSpace   string `json:"min_free_space,omitempty"`
+	MinKeepDays    int    `json:"min_keep_days,omitempty"`
+
+	MaxArchiveBytes uint64 `json:"-"`
+	MinFreeBytes    uint64 `json:"-"`
 }
 
 // ValidationConfig holds settings for recording validation.
 type ValidationConfig struct {
-	Enabled            bool                `json:"enabled"`
-	MinDurationSecs    int                 `json:"min_duration_secs"`
-	SilenceThresholdDB float64             `json:"silence_threshold_db"`
-	MaxSilenceSecs     float64             `json:"max_silence_secs"`
-	MaxLoopPercent     float64             `json:"max_loop_percent"`
-	Alert              *AlertConfig        `json:"alert,omitempty"`
-	StationRecipients  map[string][]string `json:"station_recipients,omitempty"`
+	Enabled            bool               `json:"enabled"`
+	MinDurationSecs    int                `json:"min_duration_secs"`
+	SilenceThresholdDB float64            `json:"silence_threshold_db"`
+	MaxSilenceSecs     float64            `json:"max_silence_secs"`
+	MaxLoopPercent     float64            `json:"max_loop_percent"`
+	Workers            int                `json:"workers,omitempty"`
+	Loudness           *LoudnessConfig    `json:"loudness,omitempty"`
+	Fingerprint        *FingerprintConfig `json:"fingerprint,omitempty"`
+	// Checks turns individual checks on or off by name. Duration, silence and
+	// loop run unless turned off; loudness and fingerprint follow their
+	// enabled setting.
+	Checks            map[string]bool       `json:"checks,omitempty"`
+	Exceptions        []ValidationException `json:"exceptions,omitempty"`
+	Alert             *AlertConfig          `json:"alert,omitempty"`
+	StationRecipients map[string][]string   `json:"station_recipients,omitempty"`
+}
+
+// StationValidation overrides the global validation settings for one station.
+// Unset thresholds inherit the global setting; a threshold set to 0 applies as
+// 0, so max_loop_percent: 0 flags any loop. Checks override the global checks,
+// and exceptions apply in addition to the global ones.
+type StationValidation struct {
+	MinDurationSecs    *int                  `json:"min_duration_secs,omitempty"`
+	SilenceThresholdDB *float64              `json:"silence_threshold_db,omitempty"`
+	MaxSilenceSecs     *float64              `json:"max_silence_secs,omitempty"`
+	MaxLoopPercent     *float64              `json:"max_loop_percent,omitempty"`
+	Loudness           *StationLoudness      `json:"loudness,omitempty"`
+	Fingerprint        *StationFingerprint   `json:"fingerprint,omitempty"`
+	Checks             map[string]bool       `json:"checks,omitempty"`
+	Exceptions         []ValidationException `json:"exceptions,omitempty"`
+}
+
+// ValidationException waives checks during a daily time window, such as a
+// nightly carrier test. Times are "HH:MM" in the configured timezone; a window
+// whose end is not after its start runs past midnight.
+type ValidationException struct {
+	From   string   `json:"from"`
+	To     string   `json:"to"`
+	Checks []string `json:"checks,omitempty"` // Empty waives all checks
+
+	FromMinute int `json:"-"`
+	ToMinute   int `json:"-"`
+}
+
+// validationChecks lists the names accepted in checks and exceptions.
+var validationChecks = []string{
+	constants.CheckDuration,
+	constants.CheckSilence,
+	constants.CheckLoop,
+	constants.CheckLoudness,
+	constants.CheckFingerprint,
+}
+
+// LoudnessConfig holds thresholds for the EBU R128 loudness check. Zero values
+// for the optional maximums disable those checks.
+type LoudnessConfig struct {
+	Enabled           bool    `json:"enabled"`
+	MinIntegratedLUFS float64 `json:"min_integrated_lufs"`
+	MaxIntegratedLUFS float64 `json:"max_integrated_lufs,omitempty"`
+	MaxTruePeakDBTP   float64 `json:"max_true_peak_dbtp"`
+	MaxMomentaryLUFS  float64 `json:"max_momentary_lufs,omitempty"`
+	MaxRangeLU        float64 `json:"max_range_lu,omitempty"`
+}
+
+// FingerprintConfig holds settings for detecting recordings that repeat an
+// earlier hour of the same station or carry another station's audio.
+type FingerprintConfig struct {
+	Enabled              bool    `json:"enabled"`
+	MinSimilarityPercent float64 `json:"min_similarity_percent"`
+	LookbackHours        int     `json:"lookback_hours"`
+}
+
+// StationLoudness overrides the global loudness settings for one station.
+// Unset fields inherit the global setting; enabled: false turns the check off.
+type StationLoudness struct {
+	Enabled           *bool    `json:"enabled,omitempty"`
+	MinIntegratedLUFS *float64 `json:"min_integrated_lufs,omitempty"`
+	MaxIntegratedLUFS *float64 `json:"max_integrated_lufs,omitempty"`
+	MaxTruePeakDBTP   *float64 `json:"max_true_peak_dbtp,omitempty"`
+	MaxMomentaryLUFS  *float64 `json:"max_momentary_lufs,omitempty"`
+	MaxRangeLU        *float64 `json:"max_range_lu,omitempty"`
+}
+
+// StationFingerprint overrides the global fingerprint settings for one
+// station. Unset fields inherit the global setting.
+type StationFingerprint struct {
+	Enabled              *bool    `json:"enabled,omitempty"`
+	MinSimilarityPercent *float64 `json:"min_similarity_percent,omitempty"`
+	LookbackHours        *int     `json:"lookback_hours,omitempty"`
 }
 
 // AlertConfig holds settings for email alerts via Microsoft Graph.
@@ -42,37 +223,198 @@ type AlertConfig struct {
 
 // Station represents a radio station configuration.
 type Station struct {
-	StreamURL     string `json:"stream_url"`
-	MetadataURL   string `json:"metadata_url,omitempty"`   // Optional metadata API endpoint
-	MetadataPath  string `json:"metadata_path,omitempty"`  // JSON path for metadata extraction
-	ParseMetadata bool   `json:"parse_metadata,omitempty"` // Enable JSON parsing of metadata
+	StreamURL       string `json:"stream_url"`
+	MetadataURL     string `json:"metadata_url,omitempty"`      // Optional metadata API endpoint
+	MetadataPath    string `json:"metadata_path,omitempty"`     // JSON path for metadata extraction
+	ParseMetadata   bool   `json:"parse_metadata,omitempty"`    // Enable JSON parsing of metadata
+	KeepDays        int    `json:"keep_days,omitempty"`         // Overrides the global keep_days
+	KeepInvalidDays int    `json:"keep_invalid_days,omitempty"` // Overrides the global keep_invalid_days
+	MaxArchiveSize  string `json:"max_archive_size,omitempty"`  // Per-station quota, e.g. "50 GB"
+	MinKeepDays     int    `json:"min_keep_days,omitempty"`     // Overrides quota.min_keep_days
+
+	Validation *StationValidation `json:"validation,omitempty"` // Overrides validation settings
+	Transcode  *TranscodeConfig   `json:"transcode,omitempty"`  // Archive profile; recordings keep the stream's codec without it
+
+	MaxArchiveBytes uint64 `json:"-"`
 }
 
-// Load reads and parses the configuration from a JSON file and applies sensible defaults for missing values.
+// Transcode modes: live encodes while recording, post after the recording is
+// finished so the original can be kept.
+const (
+	TranscodeLive = "live"
+	TranscodePost = "post"
+)
+
+// transcodeCodecs lists the codecs recordings can be transcoded to.
+var transcodeCodecs = []string{"aac", "flac", "mp3", "opus", "vorbis"}
+
+// TranscodeConfig holds the archive profile of a station: the codec and
+// settings its recordings are stored with. Zero values keep the bitrate,
+// sample rate and channels of the stream.
+type TranscodeConfig struct {
+	Codec        string  `json:"codec"`                   // aac, flac, mp3, opus or vorbis
+	BitrateKbps  int     `json:"bitrate_kbps,omitempty"`  // Not used for flac
+	SampleRate   int     `json:"sample_rate,omitempty"`   // In Hz
+	Channels     int     `json:"channels,omitempty"`      // 1 for mono, 2 for stereo
+	LoudnessLUFS float64 `json:"loudness_lufs,omitempty"` // Normalizes to this integrated loudness when set
+	Mode         string  `json:"mode,omitempty"`          // "post" (default) or "live"
+	// KeepOriginalDays keeps the recording as captured next to the transcoded
+	// file for this many days. Only used in post mode; zero removes it at once.
+	KeepOriginalDays int `json:"keep_original_days,omitempty"`
+}
+
+// Live reports whether the recording is encoded while it is captured.
+func (t *TranscodeConfig) Live() bool {
+	return t != nil && t.Mode == TranscodeLive
+}
+
+// StationKeepDays returns the retention in days for a station's recordings,
+// and the retention for its recordings that failed validation.
+func (c *Config) StationKeepDays(name string) (keepDays, keepInvalidDays int) {
+	keepDays = c.KeepDays
+	keepInvalidDays = c.KeepInvalidDays
+	if station, ok := c.Stations[name]; ok {
+		if station.KeepDays > 0 {
+			keepDays = station.KeepDays
+		}
+		if station.KeepInvalidDays > 0 {
+			keepInvalidDays = station.KeepInvalidDays
+		}
+	}
+	return keepDays, max(keepDays, keepInvalidDays)
+}
+
+// StationQuota returns the size limit in bytes for a station's recordings (zero
+// when unlimited) and the number of days its recordings are protected from
+// quota-based deletion.
+func (c *Config) StationQuota(name string) (maxBytes uint64, minKeepDays int) {
+	if c.Quota != nil {
+		minKeepDays = c.Quota.MinKeepDays
+	}
+	if station, ok := c.Stations[name]; ok {
+		maxBytes = station.MaxArchiveBytes
+		if station.MinKeepDays > 0 {
+			minKeepDays = station.MinKeepDays
+		}
+	}
+	return maxBytes, minKeepDays
+}
+
+// Load reads and parses the configuration from a JSON, YAML or TOML file,
+// chosen by extension, together with the files it includes, and applies
+// sensible defaults for missing values.
 func Load(path string) (*Config, error) {
-	file, err := os.Open(path) //nolint:gosec // Config path is provided by the application, not user input
+	data, files, err := readFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open config file %q: %w", path, err)
+		return nil, err
 	}
-	defer func() { _ = file.Close() }()
 
 	var cfg Config
 
-	decoder := json.NewDecoder(file)
+	decoder := json.NewDecoder(bytes.NewReader(data))
 	decoder.DisallowUnknownFields()
 
 	if err := decoder.Decode(&cfg); err != nil {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
+	cfg.files = files
 
+	// Unresolved references would only cause follow-up problems, so stop here
+	// if any fail.
+	p := &problems{}
+	if cfg.resolveReferences(p); len(p.errors) > 0 {
+		return nil, p.err()
+	}
 	cfg.applyDefaults()
+	if err := cfg.validate(p); err != nil {
+		return nil, err
+	}
 	return &cfg, nil
 }
 
+// parseSizes converts the human-readable quota sizes to bytes.
+func (c *Config) parseSizes(p *problems) {
+	var err error
+	if c.Quota != nil {
+		if c.Quota.MaxArchiveBytes, err = parseSize(c.Quota.MaxArchiveSize); err != nil {
+			p.add("quota.max_archive_size", "%v", err)
+		}
+		if c.Quota.MinFreeBytes, err = parseSize(c.Quota.MinFreeSpace); err != nil {
+			p.add("quota.min_free_space", "%v", err)
+		}
+	}
+	for name, station := range c.Stations {
+		if station.MaxArchiveBytes, err = parseSize(station.MaxArchiveSize); err != nil {
+			p.add(stationPath(name)+".max_archive_size", "%v", err)
+		}
+		c.Stations[name] = station
+	}
+}
+
+// parseValidationRules checks the check names and parses the exception times
+// of the global and per-station validation settings.
+func (c *Config) parseValidationRules(p *problems) {
+	if c.Validation != nil {
+		parseRules(p, "validation", c.Validation.Checks, c.Validation.Exceptions)
+	}
+	for name, station := range c.Stations {
+		if station.Validation != nil {
+			parseRules(p, stationPath(name)+".validation", station.Validation.Checks, station.Validation.Exceptions)
+		}
+	}
+}
+
+func parseRules(p *problems, path string, checks map[string]bool, exceptions []ValidationException) {
+	for _, check := range slices.Sorted(maps.Keys(checks)) {
+		if !slices.Contains(validationChecks, check) {
+			p.add(path+".checks", "unknown check %q", check)
+		}
+	}
+	for i := range exceptions {
+		e := &exceptions[i]
+		exceptionPath := fmt.Sprintf("%s.exceptions[%d]", path, i)
+		var err error
+		if e.FromMinute, err = parseTimeOfDay(e.From); err != nil {
+			p.add(exceptionPath+".from", "%v", err)
+		}
+		if e.ToMinute, err = parseTimeOfDay(e.To); err != nil {
+			p.add(exceptionPath+".to", "%v", err)
+		}
+		for _, check := range e.Checks {
+			if !slices.Contains(validationChecks, check) {
+				p.add(exceptionPath+".checks", "unknown check %q", check)
+			}
+		}
+	}
+}
+
+// parseTimeOfDay parses "HH:MM" into minutes after midnight.
+func parseTimeOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time of day (HH:MM)", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseSize parses a human-readable size such as "500 GB"; empty means zero.
+func parseSize(size string) (uint64, error) {
+	if size == "" {
+		return 0, nil
+	}
+	return humanize.ParseBytes(size)
+}
+
 func (c *Config) applyDefaults() {
 	if c.RecordingsDir == "" {
 		c.RecordingsDir = constants.DefaultRecordingsDir
 	}
+	if c.StateDir == "" {
+		c.StateDir = filepath.Join(c.RecordingsDir, constants.DefaultStateDirName)
+	}
+	if c.Layout == "" {
+		c.Layout = constants.DefaultLayout
+	}
 	if c.KeepDays == 0 {
 		c.KeepDays = constants.DefaultKeepDays
 	}
@@ -86,6 +428,20 @@ func (c *Config) applyDefaults() {
 	if c.Validation != nil && c.Validation.Enabled {
 		c.Validation.applyDefaults()
 	}
+	if c.ArchiveTier != nil && c.ArchiveTier.AfterDays == 0 {
+		c.ArchiveTier.AfterDays = constants.DefaultArchiveAfterDays
+	}
+	if p := c.Proxy; p != nil && p.Enabled {
+		if p.Codec == "" {
+			p.Codec = constants.DefaultProxyCodec
+		}
+		if p.BitrateKbps == 0 {
+			p.BitrateKbps = constants.DefaultProxyBitrateKbps
+		}
+		if p.Channels == 0 {
+			p.Channels = constants.DefaultProxyChannels
+		}
+	}
 }
 
 func (v *ValidationConfig) applyDefaults() {
@@ -101,4 +457,23 @@ func (v *ValidationConfig) applyDefaults() {
 	if v.MaxLoopPercent == 0 {
 		v.MaxLoopPercent = constants.DefaultMaxLoopPercent
 	}
+	if v.Workers == 0 {
+		v.Workers = constants.DefaultValidationWorkers
+	}
+	if v.Fingerprint != nil {
+		if v.Fingerprint.MinSimilarityPercent == 0 {
+			v.Fingerprint.MinSimilarityPercent = constants.DefaultMinSimilarityPercent
+		}
+		if v.Fingerprint.LookbackHours == 0 {
+			v.Fingerprint.LookbackHours = constants.DefaultFingerprintLookbackHours
+		}
+	}
+	if v.Loudness != nil {
+		if v.Loudness.MinIntegratedLUFS == 0 {
+			v.Loudness.MinIntegratedLUFS = constants.DefaultMinIntegratedLUFS
+		}
+		if v.Loudness.MaxTruePeakDBTP == 0 {
+			v.Loudness.MaxTruePeakDBTP = constants.DefaultMaxTruePeakDBTP
+		}
+	}
 }
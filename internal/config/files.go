@@ -0,0 +1,154 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"go.yaml.in/yaml/v3"
+)
+
+// readFile reads the configuration file at path, merges the files it
+// includes, and returns the result as JSON together with every file read.
+// YAML and TOML files are converted, so all formats are decoded with the same
+// strict JSON decoder.
+func readFile(path string) (data []byte, files []string, err error) {
+	root, err := readTree(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	files = []string{path}
+
+	includes, err := includePatterns(root["include"])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid include in %s: %w", path, err)
+	}
+	for _, pattern := range includes {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+		}
+		for _, file := range matches {
+			tree, err := readTree(file)
+			if err != nil {
+				return nil, nil, err
+			}
+			if _, ok := tree["include"]; ok {
+				return nil, nil, fmt.Errorf("%s: include is only allowed in the main config file", file)
+			}
+			if err := merge(root, tree, ""); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", file, err)
+			}
+			files = append(files, file)
+		}
+	}
+
+	data, err = json.Marshal(root)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to convert config: %w", err)
+	}
+	return data, files, nil
+}
+
+// readTree parses a JSON, YAML or TOML file, chosen by its extension, into
+// maps and values.
+func readTree(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // Config path is provided by the application, not user input
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file %q: %w", path, err)
+	}
+
+	var tree map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		_, err = toml.Decode(string(data), &tree)
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber() // Keep large integers exact.
+		err = decoder.Decode(&tree)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	if tree == nil {
+		tree = map[string]any{} // An empty file
+	}
+	return normalize(tree).(map[string]any), nil
+}
+
+// normalize converts the maps with non-string keys that YAML produces, for a
+// station named 2 for example, to maps with string keys.
+func normalize(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			v[key] = normalize(value)
+		}
+		return v
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = normalize(value)
+		}
+		return m
+	case []any:
+		for i, value := range v {
+			v[i] = normalize(value)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// includePatterns returns the include setting as a list of patterns.
+func includePatterns(v any) ([]string, error) {
+	if v == nil {
+		return nil, nil
+	}
+	list, ok := v.([]any)
+	if !ok {
+		return nil, errors.New("must be a list of file patterns")
+	}
+	patterns := make([]string, len(list))
+	for i, item := range list {
+		if patterns[i], ok = item.(string); !ok {
+			return nil, errors.New("must be a list of file patterns")
+		}
+	}
+	return patterns, nil
+}
+
+// merge adds the settings of src to dst. Objects are merged, so an included
+// file can add stations; any other setting may only be set once.
+func merge(dst, src map[string]any, path string) error {
+	for _, key := range slices.Sorted(maps.Keys(src)) {
+		child := joinPath(path, key)
+		existing, ok := dst[key]
+		if !ok {
+			dst[key] = src[key]
+			continue
+		}
+		dstMap, dstIsMap := existing.(map[string]any)
+		srcMap, srcIsMap := src[key].(map[string]any)
+		if !dstIsMap || !srcIsMap {
+			return fmt.Errorf("%s is already set", child)
+		}
+		if err := merge(dstMap, srcMap, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// secretFields lists the settings whose values are never shown in a diff.
+var secretFields = []string{"api_token", "client_secret", "access_key", "secret_key", "password"}
+
+// Reload prepares next to replace c in a running process. Settings that only
+// take effect after a restart, such as the recordings directory or enabling a
+// component, keep their current values; restart names those that differ.
+// Changes lists every difference between c and the applied configuration.
+func (c *Config) Reload(next *Config) (applied *Config, changes, restart []string) {
+	merged := *next
+	keep := func(name string, changed bool, restore func()) {
+		if changed {
+			restart = append(restart, name)
+			restore()
+		}
+	}
+
+	keep("recordings_dir", c.RecordingsDir != next.RecordingsDir, func() { merged.RecordingsDir = c.RecordingsDir })
+	keep("state_dir", c.StateDir != next.StateDir, func() { merged.StateDir = c.StateDir })
+	keep("layout", c.Layout != next.Layout, func() { merged.Layout = c.Layout })
+	keep("port", c.Port != next.Port, func() { merged.Port = c.Port })
+	keep("timezone", c.Timezone != next.Timezone, func() { merged.Timezone = c.Timezone })
+	keep("archive_tier", !reflect.DeepEqual(c.ArchiveTier, next.ArchiveTier), func() { merged.ArchiveTier = c.ArchiveTier })
+	keep("upload", !reflect.DeepEqual(c.Upload, next.Upload), func() { merged.Upload = c.Upload })
+	keep("integrity", !reflect.DeepEqual(c.Integrity, next.Integrity), func() { merged.Integrity = c.Integrity })
+	keep("timestamping", !reflect.DeepEqual(c.Timestamping, next.Timestamping), func() { merged.Timestamping = c.Timestamping })
+	keep("proxy", !reflect.DeepEqual(c.Proxy, next.Proxy), func() { merged.Proxy = c.Proxy })
+
+	// The validator is started or left out at startup; within a running
+	// validator everything but the number of workers can change.
+	if c.Validation.enabled() != next.Validation.enabled() {
+		keep("validation.enabled", true, func() { merged.Validation = c.Validation })
+	} else if c.Validation.enabled() {
+		keep("validation.workers", c.Validation.Workers != next.Validation.Workers, func() {
+			v := *next.Validation
+			v.Workers = c.Validation.Workers
+			merged.Validation = &v
+		})
+	}
+
+	return &merged, diff(c, &merged), restart
+}
+
+// enabled reports whether validation is configured and enabled.
+func (v *ValidationConfig) enabled() bool {
+	return v != nil && v.Enabled
+}
+
+// diff lists the differences between two configurations, one line per
+// setting, such as "keep_days: 31 -> 62" or "stations.news: added".
+func diff(old, next *Config) []string {
+	var changes []string
+	diffValues("", generic(old), generic(next), &changes)
+	return changes
+}
+
+// generic converts a configuration to its JSON form as maps and values.
+func generic(c *Config) any {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil
+	}
+	return v
+}
+
+func diffValues(path string, old, next any, changes *[]string) {
+	oldMap, oldIsMap := old.(map[string]any)
+	nextMap, nextIsMap := next.(map[string]any)
+	if oldIsMap && nextIsMap {
+		keys := maps.Clone(oldMap)
+		maps.Copy(keys, nextMap)
+		for _, key := range slices.Sorted(maps.Keys(keys)) {
+			diffValues(joinPath(path, key), oldMap[key], nextMap[key], changes)
+		}
+		return
+	}
+	if reflect.DeepEqual(old, next) {
+		return
+	}
+
+	secret := slices.Contains(secretFields, path[strings.LastIndex(path, ".")+1:])
+	show := func(v any) string {
+		if secret {
+			return "(redacted)"
+		}
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+
+	switch {
+	case old == nil && nextIsMap:
+		*changes = append(*changes, path+": added")
+	case next == nil && oldIsMap:
+		*changes = append(*changes, path+": removed")
+	case old == nil:
+		*changes = append(*changes, fmt.Sprintf("%s: set to %s", path, show(next)))
+	case next == nil:
+		*changes = append(*changes, path+": removed")
+	case secret:
+		*changes = append(*changes, path+": changed")
+	default:
+		*changes = append(*changes, fmt.Sprintf("%s: %s -> %s", path, show(old), show(next)))
+	}
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// filePrefix marks a setting whose value is read from a file, such as a
+// Docker or Kubernetes secret.
+const filePrefix = "file:"
+
+// envReference matches a ${NAME} reference to an environment variable.
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// secretQueryParams lists URL query parameters whose values are treated as
+// secrets, such as the token in https://stream.example.com/live?token=abc.
+var secretQueryParams = []string{"token", "key", "apikey", "api_key", "secret", "password", "pass", "auth", "sig", "signature"}
+
+// resolveReferences replaces references in every string setting with their
+// values. A setting of the form "file:/run/secrets/x" is replaced by the
+// contents of the file without its trailing newline, and every ${NAME} in a
+// setting by the environment variable NAME. Resolved values are only secret in
+// the settings that Secrets lists, so a resolved directory or timezone stays
+// readable in logs.
+func (c *Config) resolveReferences(p *problems) {
+	resolveValue(reflect.ValueOf(c).Elem(), "", p)
+}
+
+func resolveValue(v reflect.Value, path string, p *problems) {
+	switch v.Kind() {
+	case reflect.String:
+		if resolved, ok := resolveString(v.String(), path, p); ok {
+			v.SetString(resolved)
+		}
+	case reflect.Pointer:
+		if !v.IsNil() {
+			resolveValue(v.Elem(), path, p)
+		}
+	case reflect.Struct:
+		for i := range v.NumField() {
+			field := v.Type().Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			resolveValue(v.Field(i), joinPath(path, name), p)
+		}
+	case reflect.Slice:
+		for i := range v.Len() {
+			resolveValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), p)
+		}
+	case reflect.Map:
+		// Map values cannot be set in place; resolve a copy and store it.
+		keys := v.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int { return strings.Compare(a.String(), b.String()) })
+		for _, key := range keys {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			resolveValue(elem, joinPath(path, key.String()), p)
+			v.SetMapIndex(key, elem)
+		}
+	}
+}
+
+// resolveString resolves the references in one setting. It reports false when
+// the setting has no references.
+func resolveString(s, path string, p *problems) (string, bool) {
+	if name, ok := strings.CutPrefix(s, filePrefix); ok {
+		data, err := os.ReadFile(name) //nolint:gosec // G304: the path comes from the config file
+		if err != nil {
+			p.add(path, "cannot read secret file: %v", err)
+			return "", false
+		}
+		return strings.TrimRight(string(data), "\r\n"), true
+	}
+
+	if !envReference.MatchString(s) {
+		return "", false
+	}
+	resolved := envReference.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envReference.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			p.add(path, "environment variable %s is not set", name)
+			return ref
+		}
+		return value
+	})
+	return resolved, true
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// Secrets returns the values that must not appear in logs: the secret settings
+// and credentials in URLs.
+func (c *Config) Secrets() []string {
+	secrets := []string{c.APIToken}
+	if v := c.Validation; v != nil && v.Alert != nil {
+		secrets = append(secrets, v.Alert.ClientSecret)
+	}
+	var urls []string
+	var buckets []*S3Config
+	if c.ArchiveTier != nil && c.ArchiveTier.S3 != nil {
+		buckets = append(buckets, c.ArchiveTier.S3)
+	}
+	if c.Upload != nil && c.Upload.S3 != nil {
+		buckets = append(buckets, c.Upload.S3)
+	}
+	for _, s3 := range buckets {
+		secrets = append(secrets, s3.SecretKey)
+		urls = append(urls, s3.Endpoint)
+	}
+	if t := c.Timestamping; t != nil {
+		secrets = append(secrets, t.Password)
+		urls = append(urls, t.URL)
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Stations)) {
+		urls = append(urls, c.Stations[name].StreamURL, c.Stations[name].MetadataURL)
+	}
+	for _, rawURL := range urls {
+		secrets = append(secrets, urlSecrets(rawURL)...)
+	}
+	return slices.DeleteFunc(secrets, func(s string) bool { return s == "" })
+}
+
+// urlSecrets returns the password and secret query parameters of a URL, both
+// decoded and as written, since a logged URL holds the percent-encoded form.
+func urlSecrets(rawURL string) []string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	var secrets []string
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			secrets = append(secrets, password, rawPassword(rawURL))
+		}
+	}
+	for param := range strings.SplitSeq(u.RawQuery, "&") {
+		rawName, rawValue, _ := strings.Cut(param, "=")
+		name, err := url.QueryUnescape(rawName)
+		if err != nil || !slices.Contains(secretQueryParams, strings.ToLower(name)) {
+			continue
+		}
+		secrets = append(secrets, rawValue)
+		if value, err := url.QueryUnescape(rawValue); err == nil {
+			secrets = append(secrets, value)
+		}
+	}
+	return secrets
+}
+
+// rawPassword returns the password in the userinfo of a URL as written, before
+// percent-decoding.
+func rawPassword(rawURL string) string {
+	_, authority, _ := strings.Cut(rawURL, "//")
+	if end := strings.IndexAny(authority, "/?#"); end >= 0 {
+		authority = authority[:end]
+	}
+	userinfo := authority[:max(strings.LastIndex(authority, "@"), 0)]
+	_, password, _ := strings.Cut(userinfo, ":")
+	return password
+}
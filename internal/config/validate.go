@@ -0,0 +1,366 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/layout"
+)
+
+// stationNamePattern limits station names to characters that are safe as a
+// directory name and in a URL path. A leading dot is not allowed, so a station
+// cannot hide its recordings or collide with the state directory.
+var stationNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// streamSchemes lists the URL schemes ffmpeg is allowed to record from.
+var streamSchemes = []string{"http", "https", "rtmp", "rtmps", "rtsp", "srt"}
+
+// Problem is an invalid setting, identified by its JSON path.
+type Problem struct {
+	Path    string
+	Message string
+}
+
+func (p Problem) Error() string {
+	return p.Path + ": " + p.Message
+}
+
+// ValidationError lists every invalid setting found in a configuration.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "config has %d invalid settings:", len(e.Problems))
+	for _, p := range e.Problems {
+		b.WriteString("\n  ")
+		b.WriteString(p.Error())
+	}
+	return b.String()
+}
+
+// problems collects the problems found while validating a configuration.
+// Errors refuse the configuration; warnings are only logged.
+type problems struct {
+	errors   []Problem
+	warnings []Problem
+}
+
+func (p *problems) add(path, format string, args ...any) {
+	p.errors = append(p.errors, Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (p *problems) warn(path, format string, args ...any) {
+	p.warnings = append(p.warnings, Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// err returns a *ValidationError listing every error, or nil if there are none.
+func (p *problems) err() error {
+	if len(p.errors) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: p.errors}
+}
+
+// validate checks the whole configuration after defaults are applied. It logs
+// the warnings and returns a *ValidationError listing every error.
+func (c *Config) validate(p *problems) error {
+	c.parseSizes(p)
+	c.parseValidationRules(p)
+
+	if c.Port < 1 || c.Port > 65535 {
+		p.add("port", "%d is not a valid port", c.Port)
+	}
+	if _, err := layout.Parse(c.Layout); err != nil {
+		p.add("layout", "%s", err)
+	}
+	checkNotNegative(p, "keep_days", c.KeepDays)
+	checkNotNegative(p, "keep_invalid_days", c.KeepInvalidDays)
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		p.add("timezone", "unknown timezone %q", c.Timezone)
+	}
+
+	if len(c.Stations) == 0 {
+		p.add("stations", "no stations configured")
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Stations)) {
+		c.Stations[name].validate(p, name)
+	}
+
+	if c.Quota != nil {
+		checkNotNegative(p, "quota.min_keep_days", c.Quota.MinKeepDays)
+	}
+	if t := c.ArchiveTier; t != nil && t.Enabled {
+		checkNotNegative(p, "archive_tier.after_days", t.AfterDays)
+		switch {
+		case t.S3 != nil && t.Path != "":
+			p.add("archive_tier", "set either path or s3, not both")
+		case t.S3 != nil:
+			t.S3.validate(p, "archive_tier.s3")
+		case t.Path == "":
+			p.add("archive_tier", "path or s3 is required")
+		}
+	}
+	if u := c.Upload; u != nil && u.Enabled {
+		if u.S3 == nil {
+			p.add("upload.s3", "required when upload is enabled")
+		} else {
+			u.S3.validate(p, "upload.s3")
+		}
+	}
+	if t := c.Timestamping; t != nil && t.Enabled {
+		checkURL(p, "timestamping.url", t.URL, "http", "https")
+	}
+	if v := c.Validation; v != nil && v.Enabled {
+		c.validateValidation(p)
+	}
+	if x := c.Proxy; x != nil && x.Enabled {
+		x.Profile().validate(p, "proxy")
+		checkNotNegative(p, "proxy.keep_days", x.KeepDays)
+	}
+
+	for _, w := range p.warnings {
+		slog.Warn("config setting has no effect", "path", w.Path, "problem", w.Message)
+	}
+	return p.err()
+}
+
+// validate checks the settings of one station.
+func (s Station) validate(p *problems, name string) {
+	path := stationPath(name)
+	if !stationNamePattern.MatchString(name) {
+		p.add(path, "station name must be 1-64 letters, digits, '.', '_' or '-' and start with a letter or digit")
+	}
+
+	if s.StreamURL == "" {
+		p.add(path+".stream_url", "required")
+	} else {
+		checkURL(p, path+".stream_url", s.StreamURL, streamSchemes...)
+	}
+	if s.MetadataURL != "" {
+		checkURL(p, path+".metadata_url", s.MetadataURL, "http", "https")
+		if s.ParseMetadata && s.MetadataPath == "" {
+			p.add(path+".metadata_path", "required when parse_metadata is set")
+		}
+	}
+	if s.MetadataPath != "" && !s.ParseMetadata {
+		p.warn(path+".metadata_path", "ignored because parse_metadata is not set")
+	}
+
+	checkNotNegative(p, path+".keep_days", s.KeepDays)
+	checkNotNegative(p, path+".keep_invalid_days", s.KeepInvalidDays)
+	checkNotNegative(p, path+".min_keep_days", s.MinKeepDays)
+
+	if v := s.Validation; v != nil {
+		checkThresholds(p, path+".validation", orZero(v.MinDurationSecs), orZero(v.SilenceThresholdDB), orZero(v.MaxSilenceSecs), orZero(v.MaxLoopPercent))
+		if l := v.Loudness; l != nil {
+			checkLoudness(p, path+".validation.loudness", &LoudnessConfig{
+				MinIntegratedLUFS: orZero(l.MinIntegratedLUFS),
+				MaxIntegratedLUFS: orZero(l.MaxIntegratedLUFS),
+				MaxTruePeakDBTP:   orZero(l.MaxTruePeakDBTP),
+				MaxMomentaryLUFS:  orZero(l.MaxMomentaryLUFS),
+				MaxRangeLU:        orZero(l.MaxRangeLU),
+			})
+		}
+		if f := v.Fingerprint; f != nil {
+			checkFingerprint(p, path+".validation.fingerprint", &FingerprintConfig{
+				MinSimilarityPercent: orZero(f.MinSimilarityPercent),
+				LookbackHours:        orZero(f.LookbackHours),
+			})
+		}
+	}
+	if s.Transcode != nil {
+		s.Transcode.validate(p, path+".transcode")
+	}
+}
+
+// opusSampleRates lists the sample rates the Opus encoder supports.
+var opusSampleRates = []int{8000, 12000, 16000, 24000, 48000}
+
+// validate checks an archive profile.
+func (t *TranscodeConfig) validate(p *problems, path string) {
+	if !slices.Contains(transcodeCodecs, t.Codec) {
+		p.add(path+".codec", "%q is not one of %s", t.Codec, strings.Join(transcodeCodecs, ", "))
+	}
+	switch {
+	case t.BitrateKbps < 0 || t.BitrateKbps > 512:
+		p.add(path+".bitrate_kbps", "must be between 0 and 512, got %d", t.BitrateKbps)
+	case t.BitrateKbps > 0 && t.Codec == "flac":
+		p.warn(path+".bitrate_kbps", "ignored because flac is lossless")
+	}
+	switch {
+	case t.SampleRate == 0:
+	case t.Codec == "opus" && !slices.Contains(opusSampleRates, t.SampleRate):
+		p.add(path+".sample_rate", "opus supports 8000, 12000, 16000, 24000 or 48000 Hz, got %d", t.SampleRate)
+	case t.SampleRate < 8000 || t.SampleRate > 192000:
+		p.add(path+".sample_rate", "must be between 8000 and 192000 Hz, got %d", t.SampleRate)
+	}
+	if t.Channels < 0 || t.Channels > 8 {
+		p.add(path+".channels", "must be between 0 and 8, got %d", t.Channels)
+	}
+	if t.LoudnessLUFS != 0 && (t.LoudnessLUFS < -70 || t.LoudnessLUFS > -5) {
+		p.add(path+".loudness_lufs", "must be between -70 and -5 LUFS, got %g", t.LoudnessLUFS)
+	}
+	switch t.Mode {
+	case "", TranscodePost:
+	case TranscodeLive:
+		if t.KeepOriginalDays > 0 {
+			p.warn(path+".keep_original_days", "ignored because mode is live")
+		}
+	default:
+		p.add(path+".mode", "must be %q or %q, got %q", TranscodePost, TranscodeLive, t.Mode)
+	}
+	checkNotNegative(p, path+".keep_original_days", t.KeepOriginalDays)
+}
+
+// stationPath returns the JSON path of a station, quoting names that would
+// make the path ambiguous.
+func stationPath(name string) string {
+	if stationNamePattern.MatchString(name) && !strings.Contains(name, ".") {
+		return "stations." + name
+	}
+	return fmt.Sprintf("stations[%q]", name)
+}
+
+// validate checks the connection settings of a bucket.
+func (s *S3Config) validate(p *problems, path string) {
+	if s.Endpoint == "" {
+		p.add(path+".endpoint", "required")
+	} else {
+		checkURL(p, path+".endpoint", s.Endpoint, "http", "https")
+	}
+	if s.Bucket == "" {
+		p.add(path+".bucket", "required")
+	}
+}
+
+// validateValidation checks the validation thresholds and alert settings.
+func (c *Config) validateValidation(p *problems) {
+	v := c.Validation
+	checkThresholds(p, "validation", v.MinDurationSecs, v.SilenceThresholdDB, v.MaxSilenceSecs, v.MaxLoopPercent)
+	if v.Workers < 1 {
+		p.add("validation.workers", "must be at least 1, got %d", v.Workers)
+	}
+	checkLoudness(p, "validation.loudness", v.Loudness)
+	checkFingerprint(p, "validation.fingerprint", v.Fingerprint)
+
+	for _, station := range slices.Sorted(maps.Keys(v.StationRecipients)) {
+		path := "validation.station_recipients." + station
+		if _, ok := c.Stations[station]; !ok {
+			p.warn(path, "unknown station")
+		}
+		checkEmails(p, path, v.StationRecipients[station])
+	}
+	if a := v.Alert; a != nil && a.Enabled {
+		if a.SenderEmail == "" {
+			p.add("validation.alert.sender_email", "required when alerts are enabled")
+		} else {
+			checkEmail(p, "validation.alert.sender_email", a.SenderEmail)
+		}
+		checkEmails(p, "validation.alert.default_recipients", a.DefaultRecipients)
+	}
+}
+
+// checkThresholds checks the validation thresholds. Zero values are not
+// checked: globally they were replaced by defaults, and per station they
+// inherit the global setting.
+func checkThresholds(p *problems, path string, minDurationSecs int, silenceThresholdDB, maxSilenceSecs, maxLoopPercent float64) {
+	if minDurationSecs < 0 {
+		p.add(path+".min_duration_secs", "must not be negative, got %d", minDurationSecs)
+	}
+	if silenceThresholdDB > 0 || silenceThresholdDB < -120 {
+		p.add(path+".silence_threshold_db", "must be between -120 and 0 dB, got %g", silenceThresholdDB)
+	}
+	if maxSilenceSecs < 0 {
+		p.add(path+".max_silence_secs", "must not be negative, got %g", maxSilenceSecs)
+	}
+	checkPercent(p, path+".max_loop_percent", maxLoopPercent)
+}
+
+// orZero returns the value of an optional setting, or zero when it is unset.
+func orZero[T any](v *T) T {
+	if v == nil {
+		var zero T
+		return zero
+	}
+	return *v
+}
+
+func checkLoudness(p *problems, path string, l *LoudnessConfig) {
+	if l == nil {
+		return
+	}
+	for _, level := range []struct {
+		name  string
+		value float64
+	}{
+		{"min_integrated_lufs", l.MinIntegratedLUFS},
+		{"max_integrated_lufs", l.MaxIntegratedLUFS},
+		{"max_momentary_lufs", l.MaxMomentaryLUFS},
+	} {
+		if level.value > 0 || level.value < -70 {
+			p.add(path+"."+level.name, "must be between -70 and 0 LUFS, got %g", level.value)
+		}
+	}
+	if l.MaxIntegratedLUFS != 0 && l.MinIntegratedLUFS != 0 && l.MaxIntegratedLUFS <= l.MinIntegratedLUFS {
+		p.add(path+".max_integrated_lufs", "must be above min_integrated_lufs (%g), got %g", l.MinIntegratedLUFS, l.MaxIntegratedLUFS)
+	}
+	if l.MaxRangeLU < 0 {
+		p.add(path+".max_range_lu", "must not be negative, got %g", l.MaxRangeLU)
+	}
+}
+
+func checkFingerprint(p *problems, path string, f *FingerprintConfig) {
+	if f == nil {
+		return
+	}
+	checkPercent(p, path+".min_similarity_percent", f.MinSimilarityPercent)
+	checkNotNegative(p, path+".lookback_hours", f.LookbackHours)
+}
+
+func checkPercent(p *problems, path string, value float64) {
+	if value < 0 || value > 100 {
+		p.add(path, "must be between 0 and 100, got %g", value)
+	}
+}
+
+func checkNotNegative(p *problems, path string, value int) {
+	if value < 0 {
+		p.add(path, "must not be negative, got %d", value)
+	}
+}
+
+// checkURL checks that a URL is absolute and uses one of the given schemes.
+func checkURL(p *problems, path, rawURL string, schemes ...string) {
+	u, err := url.Parse(rawURL)
+	switch {
+	case err != nil:
+		p.add(path, "not a valid URL")
+	case !slices.Contains(schemes, u.Scheme):
+		p.add(path, "URL scheme %q is not one of %s", u.Scheme, strings.Join(schemes, ", "))
+	case u.Host == "":
+		p.add(path, "URL has no host")
+	}
+}
+
+func checkEmails(p *problems, path string, addresses []string) {
+	for i, address := range addresses {
+		checkEmail(p, fmt.Sprintf("%s[%d]", path, i), address)
+	}
+}
+
+// checkEmail checks that an address is a plain email address, without a
+// display name.
+func checkEmail(p *problems, path, address string) {
+	if parsed, err := mail.ParseAddress(address); err != nil || parsed.Address != address {
+		p.add(path, "invalid email address %q", address)
+	}
+}
@@ -16,6 +16,14 @@ const (
 
 	// DefaultRecordingsDir is the default directory for storing recordings.
 	DefaultRecordingsDir = "/var/audio"
+	// DefaultStateDirName is the directory inside the recordings directory that
+	// holds internal state such as persistent queues, unless state_dir is set.
+	DefaultStateDirName = ".audiologger"
+	// DefaultLayout is the default storage layout: every recording directly in
+	// the station directory, as in "station/2026-04-30-22.mp3".
+	DefaultLayout = "{station}/{yyyy}-{mm}-{dd}-{hh}.{ext}"
+	// ConfigPollInterval is how often the config file is checked for changes.
+	ConfigPollInterval = 10 * time.Second
 	// DefaultAccessLogPath is the default path for HTTP access logs.
 	DefaultAccessLogPath = "/var/log/access.log"
 	// DefaultKeepDays is the default number of days to retain recordings.
@@ -24,6 +32,9 @@ const (
 	DefaultPort = 8080
 	// DefaultTimezone is the default timezone for the application.
 	DefaultTimezone = "UTC"
+	// DefaultArchiveAfterDays is the default age in days at which recordings
+	// move to the archive tier.
+	DefaultArchiveAfterDays = 7
 
 	// DirPermissions defines the file mode for created directories.
 	DirPermissions = 0o755
@@ -38,13 +49,38 @@ const (
 	DefaultSilenceThresholdDB = -40.0
 	// DefaultMaxSilenceSecs is the maximum allowed continuous silence duration.
 	DefaultMaxSilenceSecs = 5.0
+	// SilenceMinDetectSecs is the shortest silence that validation detects, so
+	// pauses shorter than the maximum still count toward the silence share.
+	SilenceMinDetectSecs = 0.5
 	// DefaultMaxLoopPercent is the maximum allowed percentage of looped content.
 	DefaultMaxLoopPercent = 30.0
-	// ValidationQueueSize is the capacity of the validation job queue.
-	ValidationQueueSize = 100
+	// DefaultMinSimilarityPercent is the fingerprint similarity from which two
+	// recordings count as the same audio. Unrelated audio scores about 50%.
+	DefaultMinSimilarityPercent = 75.0
+	// DefaultFingerprintLookbackHours is how many earlier hours of the same
+	// station a recording is compared with.
+	DefaultFingerprintLookbackHours = 48
+	// FingerprintMinOverlap is the minimum amount of non-silent audio two
+	// recordings must share before they can match.
+	FingerprintMinOverlap = 10 * time.Minute
+	// DefaultMinIntegratedLUFS is the quietest allowed integrated loudness.
+	DefaultMinIntegratedLUFS = -30.0
+	// DefaultMaxTruePeakDBTP is the highest allowed true peak.
+	DefaultMaxTruePeakDBTP = -1.0
+	// DefaultValidationWorkers is the default number of recordings validated
+	// in parallel.
+	DefaultValidationWorkers = 2
 	// ValidationAnalysisTimeout is the maximum time allowed for validation analysis.
 	ValidationAnalysisTimeout = 10 * time.Minute
 
+	// Names of the validation checks, as used in the checks settings and in
+	// time-of-day exceptions.
+	CheckDuration    = "duration"
+	CheckSilence     = "silence"
+	CheckLoop        = "loop"
+	CheckLoudness    = "loudness"
+	CheckFingerprint = "fingerprint"
+
 	// HTTPClientTimeout is the default timeout for HTTP client requests.
 	HTTPClientTimeout = 30 * time.Second
 	// AlertRetryMax is the maximum number of retry attempts for alert sending.
@@ -56,6 +92,21 @@ const (
 
 	// ValidationFileSuffix is the file extension for validation result files.
 	ValidationFileSuffix = ".validation.json"
+	// FingerprintFileSuffix is the file extension for audio fingerprint files.
+	FingerprintFileSuffix = ".fingerprint"
+	// MetadataFileSuffix is the file extension for metadata sidecar files.
+	MetadataFileSuffix = ".meta"
+	// HoldFileSuffix marks a recording under legal hold. Cleanup never deletes
+	// a recording while a file with this suffix exists next to it.
+	HoldFileSuffix = ".hold"
+	// OriginalFileSuffix marks the recording as captured, kept next to the
+	// transcoded file, as in "2026-04-30-22.original.mp3".
+	OriginalFileSuffix = ".original"
+
+	// OrphanSidecarGracePeriod is how long sidecars may exist without their
+	// audio file before cleanup removes them. Metadata is written when a
+	// recording starts, so this must exceed HourlyRecordingTimeout.
+	OrphanSidecarGracePeriod = 3 * time.Hour
 
 	// MinDiskSpaceBytes is the minimum free disk space required before starting a recording.
 	MinDiskSpaceBytes = uint64(1 * 1024 * 1024 * 1024) // 1 GB
@@ -65,6 +116,81 @@ const (
 	// useful and would fail normal duration validation if it is ever re-queued.
 	CatchupMinRemainingSecs = 60
 
+	// UploadRetryInitialWait is the initial wait before retrying a failed upload.
+	UploadRetryInitialWait = 30 * time.Second
+	// UploadRetryMaxWait is the maximum wait between upload retries.
+	UploadRetryMaxWait = 1 * time.Hour
+	// ObjectStoreConnectTimeout bounds connecting to an S3 endpoint, including
+	// the TLS handshake.
+	ObjectStoreConnectTimeout = 30 * time.Second
+	// ObjectStoreResponseTimeout bounds the wait for an S3 endpoint to answer a
+	// request once it was sent. Transfers themselves are not limited, as
+	// recordings can take long to upload or stream.
+	ObjectStoreResponseTimeout = 2 * time.Minute
+	// UploadQueueFile is the name of the persistent upload queue in the state directory.
+	UploadQueueFile = "upload-queue.json"
+
+	// TimestampFileSuffix is the file extension for RFC 3161 timestamp responses.
+	TimestampFileSuffix = ".tsr"
+	// ValidationQueueFile is the name of the persistent validation queue in the state directory.
+	ValidationQueueFile = "validation-queue.json"
+	// TimestampQueueFile is the name of the persistent timestamp queue in the state directory.
+	TimestampQueueFile = "timestamp-queue.json"
+	// TimestampRequestTimeout bounds a single request to the TSA.
+	TimestampRequestTimeout = 30 * time.Second
+	// TimestampRetryInitialWait is the initial wait before retrying a failed timestamp request.
+	TimestampRetryInitialWait = 1 * time.Minute
+	// TimestampRetryMaxWait is the maximum wait between timestamp retries.
+	TimestampRetryMaxWait = 1 * time.Hour
+
+	// ProxyFileSuffix marks the low-bitrate copy of a recording used for
+	// listening back, as in "2026-04-30-22.proxy.opus".
+	ProxyFileSuffix = ".proxy"
+	// ProxyQueueFile is the name of the persistent proxy queue in the state directory.
+	ProxyQueueFile = "proxy-queue.json"
+	// DefaultProxyCodec is the default codec of proxies.
+	DefaultProxyCodec = "opus"
+	// DefaultProxyBitrateKbps is the default bitrate of proxies.
+	DefaultProxyBitrateKbps = 48
+	// DefaultProxyChannels is the default number of channels of proxies.
+	DefaultProxyChannels = 1
+
+	// HLSSegmentDuration is the length of the segments in HLS playlists of the archive.
+	HLSSegmentDuration = 10 * time.Second
+	// HLSMaxRange is the longest time range an HLS playlist may cover.
+	HLSMaxRange = 7 * 24 * time.Hour
+
+	// RestreamBitrateKbps is the bitrate of time-shifted streams.
+	RestreamBitrateKbps = 128
+	// RestreamBurst is how far a time-shifted stream may run ahead of real
+	// time, so players can fill their buffer at the start.
+	RestreamBurst = 10 * time.Second
+	// RestreamMaxWait is how long a time-shifted stream waits for the next
+	// recording before it ends.
+	RestreamMaxWait = 2 * time.Minute
+	// FollowPollInterval is how often a recording in progress is checked for
+	// new data while it is followed.
+	FollowPollInterval = 250 * time.Millisecond
+
+	// IndexFile is the name of the archive index in the state directory.
+	IndexFile = "index.json"
+	// IndexSaveInterval is how often a changed archive index is saved.
+	IndexSaveInterval = 1 * time.Minute
+	// SearchMaxResults is the maximum number of recordings a search returns.
+	SearchMaxResults = 200
+
+	// APIDefaultPageSize is the number of recordings per page of the JSON API.
+	APIDefaultPageSize = 100
+	// APIMaxPageSize is the largest page size a client may ask for.
+	APIMaxPageSize = 1000
+
+	// ManifestDirName is the directory in the state directory holding the daily
+	// integrity manifests.
+	ManifestDirName = "manifests"
+
+	// AlertMaxSilences is the maximum number of silence periods listed in an alert email.
+	AlertMaxSilences = 20
+
 	// AlertNotifyTimeout is the maximum time allowed to deliver a recording failure alert,
 	// including all retries. Bounds the synchronous notify call in the recorder goroutine.
 	AlertNotifyTimeout = 2 * time.Minute
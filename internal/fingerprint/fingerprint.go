@@ -0,0 +1,223 @@
+// Package fingerprint computes compact spectral fingerprints of recordings and
+// compares them, to detect hours that repeat earlier audio or duplicate
+// another station.
+//
+// The method follows Haitsma and Kalker: every frame of audio is reduced to 32
+// bits, each the sign of the change in energy difference between neighbouring
+// frequency bands from one frame to the next. Two recordings of the same audio
+// produce nearly identical bits even after re-encoding, while unrelated audio
+// agrees on about half of them.
+package fingerprint
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"math/cmplx"
+	"os"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
+)
+
+// Analysis parameters. Audio is decoded to mono at SampleRate; each frame
+// covers frameSize samples and starts hopSize samples after the previous one.
+const (
+	SampleRate = 11025
+	frameSize  = 4096
+	hopSize    = 1024
+	numBands   = 33
+	minFreq    = 300.0
+	maxFreq    = 2000.0
+	// silentRMS is the level below which a frame counts as silent (-60 dBFS).
+	// Silent frames get the value 0 and are ignored when comparing, so two
+	// silent hours do not match each other.
+	silentRMS = 0.001
+)
+
+// Binary sidecar format: magic, version, hop size, sample rate, frame count,
+// then one little-endian uint32 per frame.
+var magic = [4]byte{'A', 'L', 'F', 'P'}
+
+const formatVersion = 1
+
+// Fingerprint holds one 32-bit value per frame.
+type Fingerprint struct {
+	Frames []uint32
+}
+
+// FrameDuration is the time between the starts of consecutive frames.
+const FrameDuration = time.Duration(hopSize * int64(time.Second) / SampleRate)
+
+// Compute reads signed 16-bit little-endian mono PCM at SampleRate and
+// returns its fingerprint.
+func Compute(pcm io.Reader) (*Fingerprint, error) {
+	a := newAnalyzer()
+	r := bufio.NewReaderSize(pcm, 64*1024)
+
+	samples := make([]float64, frameSize)
+	buf := make([]byte, 2*hopSize)
+	filled := 0
+	fp := &Fingerprint{}
+	prev := make([]float64, numBands-1)
+	first := true
+
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			// Shift the window by one hop and append the new samples.
+			count := n / 2
+			copy(samples, samples[count:])
+			for i := range count {
+				samples[frameSize-count+i] = float64(int16(binary.LittleEndian.Uint16(buf[2*i:]))) / 32768
+			}
+			filled = min(filled+count, frameSize)
+		}
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if filled < frameSize {
+			continue
+		}
+
+		value, diffs := a.frame(samples, prev)
+		if !first {
+			fp.Frames = append(fp.Frames, value)
+		}
+		prev, first = diffs, false
+	}
+	return fp, nil
+}
+
+// analyzer holds the precomputed window, FFT tables and band edges.
+type analyzer struct {
+	window  []float64
+	edges   []int // FFT bin where each band starts; the last entry ends the last band.
+	twiddle []complex128
+	reverse []int
+	spec    []complex128
+}
+
+func newAnalyzer() *analyzer {
+	a := &analyzer{
+		window:  make([]float64, frameSize),
+		edges:   make([]int, numBands+1),
+		twiddle: make([]complex128, frameSize/2),
+		reverse: make([]int, frameSize),
+		spec:    make([]complex128, frameSize),
+	}
+	for i := range a.window {
+		a.window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(frameSize-1))
+	}
+	for i := range a.edges {
+		freq := minFreq * math.Pow(maxFreq/minFreq, float64(i)/numBands)
+		a.edges[i] = int(math.Round(freq * frameSize / SampleRate))
+	}
+	for i := range a.twiddle {
+		a.twiddle[i] = cmplx.Exp(complex(0, -2*math.Pi*float64(i)/frameSize))
+	}
+	shift := 64 - bits.TrailingZeros(frameSize)
+	for i := range a.reverse {
+		a.reverse[i] = int(bits.Reverse64(uint64(i)) >> shift)
+	}
+	return a
+}
+
+// frame computes the value of one frame from the band energy differences of
+// this frame and the previous one. It also returns this frame's differences.
+func (a *analyzer) frame(samples, prev []float64) (uint32, []float64) {
+	var power float64
+	for i, s := range samples {
+		power += s * s
+		a.spec[a.reverse[i]] = complex(s*a.window[i], 0)
+	}
+	a.fft()
+
+	energies := make([]float64, numBands)
+	for band := range numBands {
+		for k := a.edges[band]; k < a.edges[band+1]; k++ {
+			re, im := real(a.spec[k]), imag(a.spec[k])
+			energies[band] += re*re + im*im
+		}
+	}
+	diffs := make([]float64, numBands-1)
+	for m := range diffs {
+		diffs[m] = energies[m] - energies[m+1]
+	}
+
+	if math.Sqrt(power/frameSize) < silentRMS {
+		return 0, diffs
+	}
+	var value uint32
+	for m := range diffs {
+		if diffs[m]-prev[m] > 0 {
+			value |= 1 << m
+		}
+	}
+	if value == 0 {
+		value = 1 // Keep 0 reserved for silent frames.
+	}
+	return value, diffs
+}
+
+// fft transforms a.spec in place. The input must be in bit-reversed order.
+func (a *analyzer) fft() {
+	for size := 2; size <= frameSize; size <<= 1 {
+		half := size / 2
+		step := frameSize / size
+		for start := 0; start < frameSize; start += size {
+			for k := range half {
+				t := a.twiddle[k*step] * a.spec[start+k+half]
+				u := a.spec[start+k]
+				a.spec[start+k] = u + t
+				a.spec[start+k+half] = u - t
+			}
+		}
+	}
+}
+
+// Save writes the fingerprint to a sidecar file.
+func (fp *Fingerprint) Save(path string) error {
+	data := make([]byte, 0, 17+4*len(fp.Frames))
+	data = append(data, magic[:]...)
+	data = append(data, formatVersion)
+	data = binary.LittleEndian.AppendUint32(data, hopSize)
+	data = binary.LittleEndian.AppendUint32(data, SampleRate)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(fp.Frames))) //nolint:gosec // G115: an hour has far fewer frames
+	for _, v := range fp.Frames {
+		data = binary.LittleEndian.AppendUint32(data, v)
+	}
+	return utils.WriteFileAtomic(path, data)
+}
+
+// Load reads a fingerprint sidecar.
+func Load(path string) (*Fingerprint, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // G304: path is a sidecar inside the recordings directory
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 17 || [4]byte(data[:4]) != magic {
+		return nil, fmt.Errorf("%s is not a fingerprint file", path)
+	}
+	if data[4] != formatVersion ||
+		binary.LittleEndian.Uint32(data[5:]) != hopSize ||
+		binary.LittleEndian.Uint32(data[9:]) != SampleRate {
+		return nil, fmt.Errorf("%s uses unsupported fingerprint parameters", path)
+	}
+	count := int(binary.LittleEndian.Uint32(data[13:]))
+	if len(data) != 17+4*count {
+		return nil, fmt.Errorf("%s is truncated", path)
+	}
+	fp := &Fingerprint{Frames: make([]uint32, count)}
+	for i := range fp.Frames {
+		fp.Frames[i] = binary.LittleEndian.Uint32(data[17+4*i:])
+	}
+	return fp, nil
+}
@@ -0,0 +1,103 @@
+package fingerprint
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/rand/v2"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// melody returns seconds of synthetic audio: a new chord of three notes with
+// harmonics every quarter second, which spreads energy over all bands like
+// real programme material.
+func melody(seed uint64, seconds float64) []float64 {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	samples := make([]float64, int(seconds*SampleRate))
+	var freqs, amps [3]float64
+	for i := range samples {
+		if i%(SampleRate/4) == 0 {
+			for n := range freqs {
+				freqs[n] = 110 + rng.Float64()*550
+				amps[n] = 0.02 + rng.Float64()*0.08
+			}
+		}
+		t := float64(i) / SampleRate
+		for n := range freqs {
+			for h := 1.0; h <= 8; h++ {
+				samples[i] += amps[n] / h * math.Sin(2*math.Pi*freqs[n]*h*t)
+			}
+		}
+	}
+	return samples
+}
+
+// pcm encodes samples as 16-bit little-endian PCM, adding noise at the given level.
+func pcm(samples []float64, noise float64, seed uint64) *bytes.Reader {
+	rng := rand.New(rand.NewPCG(seed, 1))
+	var buf bytes.Buffer
+	for _, s := range samples {
+		s += (rng.Float64()*2 - 1) * noise
+		_ = binary.Write(&buf, binary.LittleEndian, int16(max(-1, min(1, s))*32767))
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func compute(t *testing.T, samples []float64, noise float64, seed uint64) *Fingerprint {
+	t.Helper()
+	fp, err := Compute(pcm(samples, noise, seed))
+	if err != nil {
+		t.Fatalf("Compute returned error: %v", err)
+	}
+	return fp
+}
+
+func TestCompareFindsRepeatedAudio(t *testing.T) {
+	audio := melody(1, 60)
+	original := compute(t, audio, 0.01, 1)
+
+	// The repeat starts 12.3 seconds later, after other audio, and has
+	// different noise, as a replay recorded from the stream would.
+	replay := slices.Concat(melody(2, 12.3), audio)
+	repeated := compute(t, replay, 0.02, 2)
+
+	match := Compare(original, repeated, 30*time.Second)
+	if match.Similarity < 0.8 {
+		t.Errorf("similarity of repeated audio = %.2f, want at least 0.8", match.Similarity)
+	}
+	if diff := match.Offset - 12300*time.Millisecond; diff.Abs() > 2*FrameDuration {
+		t.Errorf("offset = %s, want about 12.3s", match.Offset)
+	}
+
+	unrelated := compute(t, melody(3, 60), 0.01, 3)
+	if match := Compare(original, unrelated, 30*time.Second); match.Similarity > 0.6 {
+		t.Errorf("similarity of unrelated audio = %.2f, want below 0.6", match.Similarity)
+	}
+}
+
+func TestCompareIgnoresSilence(t *testing.T) {
+	silence := make([]float64, 30*SampleRate)
+	a := compute(t, silence, 0, 1)
+	b := compute(t, silence, 0, 2)
+	if match := Compare(a, b, time.Second); match.Similarity != 0 || match.Overlap != 0 {
+		t.Errorf("silent recordings matched: %+v", match)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	fp := compute(t, melody(4, 10), 0.01, 4)
+	path := filepath.Join(t.TempDir(), "2026-04-30-22.fingerprint")
+	if err := fp.Save(path); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if !slices.Equal(fp.Frames, loaded.Frames) {
+		t.Error("loaded fingerprint differs from saved one")
+	}
+}
@@ -0,0 +1,134 @@
+package fingerprint
+
+import (
+	"cmp"
+	"math/bits"
+	"slices"
+	"time"
+)
+
+// Search parameters for Compare.
+const (
+	// nearbyFrames is how far around zero offset every offset is tried,
+	// covering start-time jitter between two hourly recordings (about 5s).
+	nearbyFrames = 50
+	// votedOffsets is how many further offsets, found through frames with
+	// identical values, are tried.
+	votedOffsets = 5
+	// commonValue is the number of occurrences above which a frame value is
+	// too common to suggest an offset.
+	commonValue = 64
+)
+
+// Match describes how closely two fingerprints agree at their best alignment.
+type Match struct {
+	// Similarity is the fraction of matching bits, from about 0.5 for
+	// unrelated audio to 1 for identical audio.
+	Similarity float64
+	// Offset is how far into the other recording the audio of the first one
+	// starts. It is negative if the other recording starts later.
+	Offset time.Duration
+	// Overlap is the duration of non-silent audio that was compared.
+	Overlap time.Duration
+}
+
+// Compare finds the alignment at which two fingerprints agree most. Only
+// alignments with at least minOverlap of non-silent audio in common count; if
+// there are none, the zero Match is returned.
+func Compare(a, b *Fingerprint, minOverlap time.Duration) Match {
+	minFrames := int(minOverlap / FrameDuration)
+
+	var best Match
+	for _, offset := range candidateOffsets(a, b) {
+		similarity, frames := similarityAt(a.Frames, b.Frames, offset)
+		if frames < max(minFrames, 1) || similarity <= best.Similarity {
+			continue
+		}
+		best = Match{
+			Similarity: similarity,
+			Offset:     time.Duration(offset) * FrameDuration,
+			Overlap:    time.Duration(frames) * FrameDuration,
+		}
+	}
+	return best
+}
+
+// candidateOffsets returns the offsets of b relative to a worth comparing: all
+// small offsets, plus those where many frames have identical values.
+func candidateOffsets(a, b *Fingerprint) []int {
+	offsets := make([]int, 0, 2*nearbyFrames+1+votedOffsets)
+	for d := -nearbyFrames; d <= nearbyFrames; d++ {
+		offsets = append(offsets, d)
+	}
+
+	// Index both 16-bit halves of every frame value: with some bit errors an
+	// exact match of half a value is much more likely than of the whole value.
+	index := make(map[uint32][]int32)
+	for j, v := range b.Frames {
+		if v != 0 {
+			for _, key := range halves(v) {
+				index[key] = append(index[key], int32(j)) //nolint:gosec // G115: an hour has far fewer frames
+			}
+		}
+	}
+	votes := make(map[int]int)
+	for i, v := range a.Frames {
+		if v == 0 {
+			continue
+		}
+		for _, key := range halves(v) {
+			positions := index[key]
+			if len(positions) > commonValue {
+				continue
+			}
+			for _, j := range positions {
+				votes[int(j)-i]++
+			}
+		}
+	}
+
+	type vote struct{ offset, count int }
+	ranked := make([]vote, 0, len(votes))
+	for offset, count := range votes {
+		if count > 1 && (offset < -nearbyFrames || offset > nearbyFrames) {
+			ranked = append(ranked, vote{offset, count})
+		}
+	}
+	slices.SortFunc(ranked, func(x, y vote) int {
+		if c := cmp.Compare(y.count, x.count); c != 0 {
+			return c
+		}
+		return cmp.Compare(x.offset, y.offset)
+	})
+	for _, v := range ranked[:min(len(ranked), votedOffsets)] {
+		offsets = append(offsets, v.offset)
+	}
+	return offsets
+}
+
+// halves returns index keys for the low and high 16 bits of a frame value.
+func halves(v uint32) [2]uint32 {
+	return [2]uint32{v & 0xffff, 1<<16 | v>>16}
+}
+
+// similarityAt compares a[i] with b[i+offset] over the frames where both are
+// non-silent. It returns the fraction of equal bits and the number of frames
+// compared.
+func similarityAt(a, b []uint32, offset int) (float64, int) {
+	start := max(0, -offset)
+	end := min(len(a), len(b)-offset)
+
+	var frames, differing int
+	for i := start; i < end; i++ {
+		x, y := a[i], b[i+offset]
+		if x == 0 || y == 0 {
+			continue
+		}
+		frames++
+		differing += bits.OnesCount32(x ^ y)
+	}
+	if frames == 0 {
+		return 0, 0
+	}
+	return 1 - float64(differing)/float64(32*frames), frames
+}
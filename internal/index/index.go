@@ -0,0 +1,699 @@
+// Package index keeps an index of the archive: the files of every recording
+// with its metadata, duration and validation result, in the recordings
+// directory and in the archive tier. It follows the files that are finished,
+// removed and moved to the tier while running, is saved in the state directory
+// and is brought up to date from disk and the tier at startup, so metadata can
+// be searched and directories listed without reading every file.
+package index
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/archive"
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+	"github.com/oszuidwest/zwfm-audiologger/internal/recorder"
+	"github.com/oszuidwest/zwfm-audiologger/internal/retention"
+	"github.com/oszuidwest/zwfm-audiologger/internal/tier"
+	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
+	"github.com/oszuidwest/zwfm-audiologger/internal/validator"
+)
+
+// Compile-time interface checks.
+var (
+	_ recorder.FileObserver     = (*Index)(nil)
+	_ retention.RemovalObserver = (*Index)(nil)
+	_ tier.MoveObserver         = (*Index)(nil)
+)
+
+// Recording is the index entry of one recorded hour of a station.
+type Recording struct {
+	Station   string `json:"station"`
+	Timestamp string `json:"timestamp"`
+	// Time is the start parsed from the timestamp, zero when it does not parse.
+	Time time.Time `json:"time,omitzero"`
+	// Files holds the size and modification time of every file by its slash
+	// path relative to the recordings directory, such as
+	// "station/2026-04-30-22.mp3". The archive tier uses the same paths.
+	Files map[string]File `json:"files"`
+	// Archived is set when the files are in the archive tier rather than the
+	// recordings directory.
+	Archived bool `json:"archived,omitempty"`
+	// DurationSecs is taken from the validation result, zero when there is none.
+	DurationSecs float64     `json:"duration_secs,omitempty"`
+	Metadata     string      `json:"metadata,omitempty"`
+	Validation   *Validation `json:"validation,omitempty"`
+}
+
+// Validation statuses of a recording.
+const (
+	StatusValid   = "valid"
+	StatusInvalid = "invalid"
+	// StatusSkipped marks catchup recordings, which are not validated.
+	StatusSkipped     = "skipped"
+	StatusUnvalidated = "unvalidated"
+)
+
+// Status returns the validation status of the recording.
+func (rec *Recording) Status() string {
+	switch {
+	case rec.Validation == nil:
+		return StatusUnvalidated
+	case rec.Validation.Skipped:
+		return StatusSkipped
+	case rec.Validation.Valid:
+		return StatusValid
+	default:
+		return StatusInvalid
+	}
+}
+
+// Audio returns the relative path of the audio file of the recording, or an
+// empty string when there is none.
+func (rec *Recording) Audio() string {
+	for name := range rec.Files {
+		if archive.IsAudio(name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// Proxy returns the relative path of the proxy of the recording, or an empty
+// string when there is none.
+func (rec *Recording) Proxy() string {
+	for name := range rec.Files {
+		if _, suffix := archive.SplitName(path.Base(name)); strings.HasPrefix(suffix, constants.ProxyFileSuffix+".") {
+			return name
+		}
+	}
+	return ""
+}
+
+// File is a file of a recording.
+type File struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Validation is the outcome of the validation of a recording.
+type Validation struct {
+	Valid   bool     `json:"valid"`
+	Skipped bool     `json:"skipped,omitempty"`
+	Issues  []string `json:"issues,omitempty"`
+}
+
+// Index holds the recordings of all stations by station and timestamp.
+type Index struct {
+	config atomic.Pointer[config.Config]
+	tier   tier.Tier // nil when no archive tier is configured.
+	path   string
+
+	mu       sync.Mutex
+	stations map[string]map[string]*Recording
+	dirty    bool
+}
+
+// New creates an index and loads the one saved by a previous run. A missing or
+// unreadable index starts empty; Start rebuilds it from disk either way. The
+// archive tier may be nil.
+func New(cfg *config.Config, archiveTier tier.Tier) *Index {
+	ix := &Index{
+		tier:     archiveTier,
+		path:     filepath.Join(cfg.StateDir, constants.IndexFile),
+		stations: make(map[string]map[string]*Recording),
+	}
+	ix.config.Store(cfg)
+	data, err := os.ReadFile(ix.path)
+	if err == nil {
+		err = json.Unmarshal(data, &ix.stations)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		slog.Warn("failed to load archive index, rebuilding it", "file", ix.path, "error", err)
+		ix.stations = make(map[string]map[string]*Recording)
+	}
+	return ix
+}
+
+// Start brings the index up to date with the recordings on disk and in the
+// archive tier and saves it whenever it changed until the context is cancelled.
+func (ix *Index) Start(ctx context.Context) error {
+	start := time.Now()
+	ix.rebuild(ctx)
+	slog.Info("Archive index ready", "recordings", ix.count(), "duration", time.Since(start).Round(time.Millisecond))
+	ix.save()
+
+	ticker := time.NewTicker(constants.IndexSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			ix.save()
+			return nil
+		case <-ticker.C:
+			ix.save()
+		}
+	}
+}
+
+// rebuild reads the recordings of every station from disk and from the archive
+// tier. Sidecars are only read again when their size or modification time
+// changed.
+func (ix *Index) rebuild(ctx context.Context) {
+	cfg := ix.config.Load()
+	archived := make(map[string]map[string]*Recording)
+	for station := range cfg.Stations {
+		if recordings, ok := ix.scanTier(ctx, station); ok {
+			archived[station] = recordings
+		}
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	for station := range ix.stations {
+		if _, ok := cfg.Stations[station]; !ok {
+			delete(ix.stations, station)
+		}
+	}
+	for station := range cfg.Stations {
+		if err := ix.scan(station); err != nil {
+			slog.Warn("failed to index station directory", "station", station, "error", err)
+		}
+		if recordings, ok := archived[station]; ok {
+			ix.setArchived(station, recordings)
+		}
+	}
+	ix.dirty = true
+}
+
+// Reload applies a reloaded configuration: stations that were removed leave
+// the index and stations that were added are read from disk and from the
+// archive tier.
+func (ix *Index) Reload(cfg *config.Config) {
+	old := ix.config.Swap(cfg)
+	archived := make(map[string]map[string]*Recording)
+	for station := range cfg.Stations {
+		if _, ok := old.Stations[station]; ok {
+			continue
+		}
+		if recordings, ok := ix.scanTier(context.Background(), station); ok {
+			archived[station] = recordings
+		}
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	for station := range old.Stations {
+		if _, ok := cfg.Stations[station]; !ok {
+			delete(ix.stations, station)
+			ix.dirty = true
+		}
+	}
+	for station := range cfg.Stations {
+		if _, ok := old.Stations[station]; ok {
+			continue
+		}
+		if err := ix.scan(station); err != nil {
+			slog.Warn("failed to index station directory", "station", station, "error", err)
+		}
+		if recordings, ok := archived[station]; ok {
+			ix.setArchived(station, recordings)
+		}
+		ix.dirty = true
+	}
+}
+
+// scan indexes the station directory, reusing the sidecar contents of the
+// current entries for files that did not change. Entries in the archive tier
+// are kept. The caller must hold ix.mu.
+func (ix *Index) scan(station string) error {
+	found, err := archive.ScanFiles(ix.config.Load().RecordingsDir, station)
+	if err != nil {
+		return err
+	}
+
+	files := make([]archive.File, 0, len(found))
+	stats := make(map[string]File, len(found))
+	for _, file := range found {
+		// Capture files are removed without notice once the recording is
+		// finished, so only finished files are indexed.
+		if filepath.Ext(file.Path) == ".mkv" {
+			continue
+		}
+		files = append(files, file)
+		stats[file.Path] = File{Size: file.Size, ModTime: file.ModTime}
+	}
+
+	previous := ix.stations[station]
+	recordings := make(map[string]*Recording)
+	for _, group := range archive.Group(station, files) {
+		rec := newRecording(station, group.Timestamp)
+		old := previous[group.Timestamp]
+		for _, file := range group.Files {
+			name, ok := ix.relPath(file)
+			if !ok {
+				continue
+			}
+			rec.Files[name] = stats[file]
+			if old != nil && old.Files[name].equal(stats[file]) {
+				rec.copySidecar(name, old)
+			} else {
+				rec.readSidecar(name, file)
+			}
+		}
+		recordings[group.Timestamp] = rec
+	}
+	for timestamp, rec := range previous {
+		if rec.Archived && recordings[timestamp] == nil {
+			recordings[timestamp] = rec
+		}
+	}
+	ix.stations[station] = recordings
+	return nil
+}
+
+// scanTier reads the recordings of a station in the archive tier, reusing the
+// sidecar contents of the current entries for files that did not change. It
+// runs without ix.mu, as the tier may be slow to answer, and returns false
+// when there is no tier or it could not be listed.
+func (ix *Index) scanTier(ctx context.Context, station string) (map[string]*Recording, bool) {
+	if ix.tier == nil {
+		return nil, false
+	}
+	files, err := ix.tier.List(ctx, station)
+	if err != nil {
+		slog.Warn("failed to index archive tier", "station", station, "error", err)
+		return nil, false
+	}
+
+	stats := make(map[string]File, len(files))
+	for _, file := range files {
+		stats[file.Path] = File{Size: file.Size, ModTime: file.ModTime}
+	}
+	previous := ix.archived(station)
+	recordings := make(map[string]*Recording)
+	for _, group := range archive.Group(station, files) {
+		rec := newRecording(station, group.Timestamp)
+		rec.Archived = true
+		old := previous[group.Timestamp]
+		for _, name := range group.Files {
+			rec.Files[name] = stats[name]
+			switch {
+			case old != nil && old.Files[name].equal(stats[name]):
+				rec.copySidecar(name, old)
+			case isSidecar(name):
+				data, err := ix.tier.ReadFile(ctx, name)
+				if err != nil {
+					slog.Warn("failed to read sidecar for archive index", "file", name, "error", err)
+					continue
+				}
+				rec.setSidecar(name, name, data)
+			}
+		}
+		recordings[group.Timestamp] = rec
+	}
+	return recordings, true
+}
+
+// archived returns copies of the entries of a station in the archive tier.
+func (ix *Index) archived(station string) map[string]*Recording {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	recordings := make(map[string]*Recording)
+	for timestamp, rec := range ix.stations[station] {
+		if rec.Archived {
+			copied := *rec
+			copied.Files = maps.Clone(rec.Files)
+			recordings[timestamp] = &copied
+		}
+	}
+	return recordings
+}
+
+// setArchived replaces the entries of a station in the archive tier. Entries
+// with files in the recordings directory take precedence. The caller must hold
+// ix.mu.
+func (ix *Index) setArchived(station string, archived map[string]*Recording) {
+	recordings := ix.stations[station]
+	if recordings == nil {
+		recordings = make(map[string]*Recording)
+		ix.stations[station] = recordings
+	}
+	for timestamp, rec := range recordings {
+		if rec.Archived {
+			delete(recordings, timestamp)
+		}
+	}
+	for timestamp, rec := range archived {
+		if recordings[timestamp] == nil {
+			recordings[timestamp] = rec
+		}
+	}
+	ix.dirty = true
+}
+
+// relPath returns the slash path of a file relative to the recordings
+// directory, or false when the file is not in it.
+func (ix *Index) relPath(file string) (string, bool) {
+	rel, err := filepath.Rel(ix.config.Load().RecordingsDir, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+func newRecording(station, timestamp string) *Recording {
+	rec := &Recording{Station: station, Timestamp: timestamp, Files: make(map[string]File)}
+	if t, err := utils.ParseTimestamp(timestamp); err == nil {
+		rec.Time = t
+	}
+	return rec
+}
+
+func (f File) equal(other File) bool {
+	return f.Size == other.Size && f.ModTime.Equal(other.ModTime)
+}
+
+// isSidecar reports whether a file is a metadata or validation sidecar, whose
+// contents are indexed.
+func isSidecar(name string) bool {
+	_, suffix := archive.SplitName(path.Base(name))
+	return suffix == constants.MetadataFileSuffix || suffix == constants.ValidationFileSuffix
+}
+
+// readSidecar stores the contents of a metadata or validation sidecar. Other
+// files are ignored.
+func (rec *Recording) readSidecar(name, file string) {
+	if !isSidecar(name) {
+		return
+	}
+	data, err := os.ReadFile(file) //nolint:gosec // G304: file is a sidecar inside the recordings directory
+	if err != nil {
+		slog.Warn("failed to read sidecar for archive index", "file", file, "error", err)
+		return
+	}
+	rec.setSidecar(name, file, data)
+}
+
+// setSidecar stores the contents data of the sidecar name, read from file.
+func (rec *Recording) setSidecar(name, file string, data []byte) {
+	if _, suffix := archive.SplitName(path.Base(name)); suffix == constants.MetadataFileSuffix {
+		rec.Metadata = strings.TrimSpace(string(data))
+		return
+	}
+	result, err := validator.ParseResult(data)
+	if err != nil {
+		slog.Warn("failed to read validation result for archive index", "file", file, "error", err)
+		return
+	}
+	rec.DurationSecs = result.DurationSecs
+	rec.Validation = &Validation{Valid: result.Valid, Skipped: result.Skipped, Issues: result.Issues}
+}
+
+// copySidecar takes the contents of an unchanged sidecar from the entry old.
+func (rec *Recording) copySidecar(name string, old *Recording) {
+	switch _, suffix := archive.SplitName(path.Base(name)); suffix {
+	case constants.MetadataFileSuffix:
+		rec.Metadata = old.Metadata
+	case constants.ValidationFileSuffix:
+		rec.DurationSecs = old.DurationSecs
+		rec.Validation = old.Validation
+	}
+}
+
+// clearSidecar forgets the contents of a removed sidecar.
+func (rec *Recording) clearSidecar(name string) {
+	switch _, suffix := archive.SplitName(path.Base(name)); suffix {
+	case constants.MetadataFileSuffix:
+		rec.Metadata = ""
+	case constants.ValidationFileSuffix:
+		rec.DurationSecs = 0
+		rec.Validation = nil
+	}
+}
+
+// FileCompleted adds a finished recording or sidecar to the index.
+func (ix *Index) FileCompleted(station, _, file string) {
+	name, ok := ix.relPath(file)
+	if !ok || strings.HasPrefix(path.Base(name), ".") {
+		return
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		slog.Warn("failed to index file", "file", file, "error", err)
+		return
+	}
+	timestamp, _ := archive.SplitPath(file)
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	recordings := ix.stations[station]
+	if recordings == nil {
+		recordings = make(map[string]*Recording)
+		ix.stations[station] = recordings
+	}
+	rec := recordings[timestamp]
+	if rec == nil {
+		rec = newRecording(station, timestamp)
+		recordings[timestamp] = rec
+	}
+	rec.Files[name] = File{Size: info.Size(), ModTime: info.ModTime()}
+	rec.readSidecar(name, file)
+	ix.dirty = true
+}
+
+// FileRemoved removes a file that retention deleted from the index. Paths in
+// the archive tier are relative to its root.
+func (ix *Index) FileRemoved(file string) {
+	name, archived := filepath.ToSlash(file), true
+	if filepath.IsAbs(file) {
+		var ok bool
+		if name, ok = ix.relPath(file); !ok {
+			return
+		}
+		archived = false
+	}
+	station, _, _ := strings.Cut(name, "/")
+	timestamp, _ := archive.SplitPath(file)
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	rec := ix.stations[station][timestamp]
+	if rec == nil || rec.Archived != archived {
+		return
+	}
+	delete(rec.Files, name)
+	rec.clearSidecar(name)
+	if len(rec.Files) == 0 {
+		delete(ix.stations[station], timestamp)
+	}
+	ix.dirty = true
+}
+
+// RecordingMoved marks a recording that Move stored in the archive tier. Its
+// files keep their paths, which are the same in the tier.
+func (ix *Index) RecordingMoved(station, timestamp string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if rec := ix.stations[station][timestamp]; rec != nil {
+		rec.Archived = true
+		ix.dirty = true
+	}
+}
+
+// Files returns the size and modification time of the indexed files in a
+// directory of the recordings directory, given as a slash path relative to it
+// such as "station" or "station/2026/04", by name.
+func (ix *Index) Files(dir string) map[string]File {
+	station, _, _ := strings.Cut(dir, "/")
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	files := make(map[string]File)
+	for _, rec := range ix.stations[station] {
+		if rec.Archived {
+			continue
+		}
+		for name, file := range rec.Files {
+			if path.Dir(name) == dir {
+				files[path.Base(name)] = file
+			}
+		}
+	}
+	return files
+}
+
+// Recordings returns copies of the recordings of a station that start in the
+// range from..to, oldest first. A zero from or to leaves that end open.
+func (ix *Index) Recordings(station string, from, to time.Time) []Recording {
+	ix.mu.Lock()
+	recordings := make([]Recording, 0, len(ix.stations[station]))
+	for _, rec := range ix.stations[station] {
+		if !rec.starts(from, to) {
+			continue
+		}
+		copied := *rec
+		copied.Files = maps.Clone(rec.Files)
+		recordings = append(recordings, copied)
+	}
+	ix.mu.Unlock()
+
+	slices.SortFunc(recordings, func(a, b Recording) int {
+		return a.Time.Compare(b.Time)
+	})
+	return recordings
+}
+
+// starts reports whether the recording starts in the range from..to. A zero
+// from or to leaves that end open.
+func (rec *Recording) starts(from, to time.Time) bool {
+	return !rec.Time.IsZero() && !rec.Time.Before(from) && (to.IsZero() || rec.Time.Before(to))
+}
+
+// count returns the number of indexed recordings.
+func (ix *Index) count() int {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	n := 0
+	for _, recordings := range ix.stations {
+		n += len(recordings)
+	}
+	return n
+}
+
+// save writes the index to the state directory if it changed.
+func (ix *Index) save() {
+	ix.mu.Lock()
+	if !ix.dirty {
+		ix.mu.Unlock()
+		return
+	}
+	data, err := json.Marshal(ix.stations)
+	ix.dirty = false
+	ix.mu.Unlock()
+
+	if err == nil {
+		if err = utils.EnsureDir(filepath.Dir(ix.path)); err == nil {
+			err = utils.WriteFileAtomic(ix.path, data)
+		}
+	}
+	if err != nil {
+		slog.Error("failed to save archive index", "file", ix.path, "error", err)
+	}
+}
+
+// Query selects recordings by the text of their metadata or validation issues.
+type Query struct {
+	// Text holds words that must all occur, in any case.
+	Text    string
+	Station string // Empty for all stations
+	// From and To limit the start of the recordings; zero means unbounded.
+	From, To time.Time
+}
+
+// Hit is a recording that matches a query.
+type Hit struct {
+	Station   string    `json:"station"`
+	Timestamp string    `json:"timestamp"`
+	Start     time.Time `json:"start"`
+	// Field is where the text matched: "metadata" or "issue".
+	Field        string  `json:"field"`
+	Text         string  `json:"text"`
+	DurationSecs float64 `json:"duration_secs,omitempty"`
+	// Valid is nil when the recording was not validated.
+	Valid *bool `json:"valid,omitempty"`
+}
+
+// Search returns the recordings that match a query, newest first, and whether
+// more than constants.SearchMaxResults matched.
+func (ix *Index) Search(q Query) ([]Hit, bool) {
+	terms := strings.Fields(strings.ToLower(q.Text))
+	if len(terms) == 0 {
+		return nil, false
+	}
+
+	ix.mu.Lock()
+	var hits []Hit
+	for station, recordings := range ix.stations {
+		if q.Station != "" && station != q.Station {
+			continue
+		}
+		for _, rec := range recordings {
+			if !rec.starts(q.From, q.To) {
+				continue
+			}
+			if field, text, ok := rec.match(terms); ok {
+				hits = append(hits, rec.hit(field, text))
+			}
+		}
+	}
+	ix.mu.Unlock()
+
+	slices.SortFunc(hits, func(a, b Hit) int {
+		if c := b.Start.Compare(a.Start); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Station, b.Station)
+	})
+	if len(hits) > constants.SearchMaxResults {
+		return hits[:constants.SearchMaxResults], true
+	}
+	return hits, false
+}
+
+// match returns the metadata or first issue of the recording that contains
+// all terms.
+func (rec *Recording) match(terms []string) (field, text string, ok bool) {
+	if containsAll(rec.Metadata, terms) {
+		return "metadata", rec.Metadata, true
+	}
+	if rec.Validation != nil {
+		for _, issue := range rec.Validation.Issues {
+			if containsAll(issue, terms) {
+				return "issue", issue, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+func containsAll(text string, terms []string) bool {
+	if text == "" {
+		return false
+	}
+	text = strings.ToLower(text)
+	for _, term := range terms {
+		if !strings.Contains(text, term) {
+			return false
+		}
+	}
+	return true
+}
+
+func (rec *Recording) hit(field, text string) Hit {
+	hit := Hit{
+		Station:      rec.Station,
+		Timestamp:    rec.Timestamp,
+		Start:        rec.Time,
+		Field:        field,
+		Text:         text,
+		DurationSecs: rec.DurationSecs,
+	}
+	if rec.Validation != nil {
+		valid := rec.Validation.Valid
+		hit.Valid = &valid
+	}
+	return hit
+}
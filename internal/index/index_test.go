@@ -0,0 +1,173 @@
+package index
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+	"github.com/oszuidwest/zwfm-audiologger/internal/tier"
+)
+
+func newTestIndex(t *testing.T) *Index {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := &config.Config{
+		RecordingsDir: filepath.Join(dir, "recordings"),
+		StateDir:      filepath.Join(dir, "recordings", ".audiologger"),
+		Stations:      map[string]config.Station{"station": {}},
+	}
+	if err := os.MkdirAll(filepath.Join(cfg.RecordingsDir, "station"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	return New(cfg, nil)
+}
+
+func writeFile(t *testing.T, ix *Index, name, content string) string {
+	t.Helper()
+	path := filepath.Join(ix.config.Load().RecordingsDir, "station", name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSearchFollowsFilesAndSurvivesRestart(t *testing.T) {
+	ix := newTestIndex(t)
+	writeFile(t, ix, "2026-04-30-09.mp3", "audio")
+	writeFile(t, ix, "2026-04-30-09.meta", "Morning Show - Song Alpha\n")
+	writeFile(t, ix, "2026-04-30-10.mp3", "audio")
+	writeFile(t, ix, "2026-04-30-10.validation.json", `{"duration_secs": 3600, "valid": false, "issues": ["silence detected: 12.0%"]}`)
+	ix.rebuild(context.Background())
+
+	// A recording finished while running.
+	ix.FileCompleted("station", "2026-04-30-11", writeFile(t, ix, "2026-04-30-11.mp3", "audio"))
+	ix.FileCompleted("station", "2026-04-30-11", writeFile(t, ix, "2026-04-30-11.meta", "Afternoon - song alpha (remix)"))
+
+	hits, truncated := ix.Search(Query{Text: "SONG alpha"})
+	if truncated || len(hits) != 2 || hits[0].Timestamp != "2026-04-30-11" || hits[1].Timestamp != "2026-04-30-09" {
+		t.Fatalf("Search = %+v, want 11:00 then 09:00", hits)
+	}
+	if hits[1].Text != "Morning Show - Song Alpha" || hits[1].Field != "metadata" {
+		t.Errorf("hit = %+v, want the trimmed metadata", hits[1])
+	}
+	hits, _ = ix.Search(Query{Text: "silence", From: time.Date(2026, 4, 30, 10, 0, 0, 0, time.UTC)})
+	if len(hits) != 1 || hits[0].Field != "issue" || hits[0].Valid == nil || *hits[0].Valid || hits[0].DurationSecs != 3600 {
+		t.Fatalf("Search(silence) = %+v, want the invalid 10:00 recording", hits)
+	}
+	hits, _ = ix.Search(Query{Text: "alpha", To: time.Date(2026, 4, 30, 11, 0, 0, 0, time.UTC)})
+	if len(hits) != 1 || hits[0].Timestamp != "2026-04-30-09" {
+		t.Fatalf("Search before 11:00 = %+v, want 09:00", hits)
+	}
+
+	// Retention removed the metadata of 09:00.
+	removed := filepath.Join(ix.config.Load().RecordingsDir, "station", "2026-04-30-09.meta")
+	if err := os.Remove(removed); err != nil {
+		t.Fatal(err)
+	}
+	ix.FileRemoved(removed)
+	if hits, _ := ix.Search(Query{Text: "morning"}); len(hits) != 0 {
+		t.Fatalf("Search after removal = %+v, want none", hits)
+	}
+	if files := ix.Files("station"); len(files) != 5 || files["2026-04-30-11.meta"].Size == 0 {
+		t.Fatalf("Files = %v, want the five remaining files", files)
+	}
+
+	// A restart loads the saved index and reuses unchanged sidecars.
+	ix.save()
+	if err := os.WriteFile(filepath.Join(ix.config.Load().RecordingsDir, "station", "2026-04-30-11.meta"), []byte("changed"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	restarted := New(ix.config.Load(), nil)
+	if n := restarted.count(); n != 3 {
+		t.Fatalf("loaded %d recordings, want 3", n)
+	}
+	restarted.rebuild(context.Background())
+	if hits, _ := restarted.Search(Query{Text: "alpha"}); len(hits) != 0 {
+		t.Fatalf("Search after rebuild = %+v, want the changed metadata to be read again", hits)
+	}
+	if hits, _ := restarted.Search(Query{Text: "silence"}); len(hits) != 1 {
+		t.Fatalf("Search after rebuild = %+v, want the kept validation issue", hits)
+	}
+}
+
+func TestReloadFollowsAddedAndRemovedStations(t *testing.T) {
+	ix := newTestIndex(t)
+	writeFile(t, ix, "2026-04-30-09.mp3", "audio")
+	writeFile(t, ix, "2026-04-30-09.meta", "Morning Show")
+	ix.rebuild(context.Background())
+
+	cfg := *ix.config.Load()
+	dir := filepath.Join(cfg.RecordingsDir, "other")
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "2026-04-30-09.mp3"), []byte("audio"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "2026-04-30-09.meta"), []byte("Evening Show"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Stations = map[string]config.Station{"other": {}}
+	ix.Reload(&cfg)
+
+	if hits, _ := ix.Search(Query{Text: "morning"}); len(hits) != 0 {
+		t.Errorf("Search(morning) = %+v, want the removed station gone", hits)
+	}
+	if hits, _ := ix.Search(Query{Text: "evening"}); len(hits) != 1 || hits[0].Station != "other" {
+		t.Errorf("Search(evening) = %+v, want the added station", hits)
+	}
+}
+
+func TestMovedRecordingsStayIndexed(t *testing.T) {
+	ix := newTestIndex(t)
+	cfg := ix.config.Load()
+	cfg.ArchiveTier = &config.ArchiveTierConfig{Enabled: true, AfterDays: 7, Path: t.TempDir()}
+	archiveTier, err := tier.New(cfg.ArchiveTier)
+	if err != nil {
+		t.Fatalf("tier.New returned error: %v", err)
+	}
+	ix.tier = archiveTier
+
+	writeFile(t, ix, "2026-04-30-09.mp3", "audio")
+	writeFile(t, ix, "2026-04-30-09.meta", "Morning Show")
+	writeFile(t, ix, "2026-05-30-09.mp3", "audio")
+	ix.rebuild(context.Background())
+
+	now := time.Date(2026, 5, 31, 12, 0, 0, 0, time.UTC)
+	if moved := tier.Move(context.Background(), cfg, archiveTier, now, ix); moved != 1 {
+		t.Fatalf("Move = %d, want 1", moved)
+	}
+	check := func(ix *Index) {
+		t.Helper()
+		recordings := ix.Recordings("station", time.Time{}, time.Time{})
+		if len(recordings) != 2 || !recordings[0].Archived || recordings[1].Archived {
+			t.Fatalf("Recordings = %+v, want the moved 09:00 in April and the local one in May", recordings)
+		}
+		if hits, _ := ix.Search(Query{Text: "morning"}); len(hits) != 1 {
+			t.Errorf("Search = %+v, want the moved recording", hits)
+		}
+		if files := ix.Files("station"); len(files) != 1 {
+			t.Errorf("Files = %v, want only the local file", files)
+		}
+	}
+	check(ix)
+
+	// A restart finds the moved recording in the tier.
+	restarted := New(cfg, archiveTier)
+	restarted.rebuild(context.Background())
+	check(restarted)
+
+	// Retention in the tier removes it.
+	for _, name := range []string{"station/2026-04-30-09.mp3", "station/2026-04-30-09.meta"} {
+		if err := archiveTier.Remove(context.Background(), name); err != nil {
+			t.Fatal(err)
+		}
+		restarted.FileRemoved(name)
+	}
+	if n := restarted.count(); n != 1 {
+		t.Errorf("count after tier removal = %d, want 1", n)
+	}
+}
@@ -0,0 +1,173 @@
+// Package layout maps recordings to paths below the recordings directory with
+// a template such as "{station}/{yyyy}/{mm}/{dd}/{hh}.{ext}".
+package layout
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+)
+
+// fields maps the time placeholders of a template to the patterns that match
+// them in a path.
+var fields = map[string]string{
+	"{yyyy}": `(?P<yyyy>\d{4})`,
+	"{mm}":   `(?P<mm>\d{2})`,
+	"{dd}":   `(?P<dd>\d{2})`,
+	"{hh}":   `(?P<hh>\d{2})`,
+}
+
+var placeholderPattern = regexp.MustCompile(`\{[^}]*\}`)
+
+// Layout is a parsed layout template. The template starts with the station
+// directory and ends with the file name, whose ".{ext}" stands for everything
+// from the first dot, such as ".mp3" or ".validation.json".
+type Layout struct {
+	template string
+	// elements are the path elements after the station directory.
+	elements []string
+	patterns []*regexp.Regexp
+}
+
+// Parse parses a layout template. It must contain each of {yyyy}, {mm}, {dd}
+// and {hh} once, so every hour has its own path.
+func Parse(template string) (*Layout, error) {
+	elements := strings.Split(template, "/")
+	if len(elements) < 2 || elements[0] != "{station}" {
+		return nil, errors.New(`must start with "{station}/"`)
+	}
+	elements = elements[1:]
+	stem, ok := strings.CutSuffix(elements[len(elements)-1], ".{ext}")
+	if !ok {
+		return nil, errors.New(`must end with ".{ext}"`)
+	}
+	if strings.Contains(stem, ".") {
+		return nil, errors.New("the file name must not contain a dot before .{ext}, which separates sidecars from the recording")
+	}
+
+	l := &Layout{template: template, elements: elements}
+	counts := make(map[string]int)
+	for i, element := range elements {
+		if element == "" || strings.HasPrefix(element, ".") || strings.Contains(element, `\`) {
+			return nil, fmt.Errorf("invalid path element %q", element)
+		}
+		last := i == len(elements)-1
+		if last {
+			element = stem
+		}
+
+		var pattern strings.Builder
+		pattern.WriteString("^")
+		prev := 0
+		for _, loc := range placeholderPattern.FindAllStringIndex(element, -1) {
+			placeholder := element[loc[0]:loc[1]]
+			expr, ok := fields[placeholder]
+			if !ok {
+				return nil, fmt.Errorf("unknown placeholder %s in %q", placeholder, element)
+			}
+			counts[placeholder]++
+			pattern.WriteString(regexp.QuoteMeta(element[prev:loc[0]]))
+			pattern.WriteString(expr)
+			prev = loc[1]
+		}
+		pattern.WriteString(regexp.QuoteMeta(element[prev:]))
+		if last {
+			pattern.WriteString(`(\..+)`)
+		}
+		pattern.WriteString("$")
+
+		re, err := regexp.Compile(pattern.String())
+		if err != nil {
+			return nil, err
+		}
+		l.patterns = append(l.patterns, re)
+	}
+	for _, placeholder := range []string{"{yyyy}", "{mm}", "{dd}", "{hh}"} {
+		if counts[placeholder] != 1 {
+			return nil, fmt.Errorf("must contain %s exactly once", placeholder)
+		}
+	}
+	return l, nil
+}
+
+// String returns the template of the layout.
+func (l *Layout) String() string {
+	return l.template
+}
+
+// Path returns the slash-separated path, relative to the recordings directory,
+// of the file of a station's recording that starts at t with the given suffix.
+func (l *Layout) Path(station string, t time.Time, suffix string) string {
+	r := strings.NewReplacer(
+		"{yyyy}", t.Format("2006"),
+		"{mm}", t.Format("01"),
+		"{dd}", t.Format("02"),
+		"{hh}", t.Format("15"),
+		".{ext}", suffix,
+	)
+	return station + "/" + r.Replace(strings.Join(l.elements, "/"))
+}
+
+// Timestamp returns the hourly timestamp and the suffix of a recording file
+// from its path, which may be absolute or relative. It reports false when the
+// end of the path does not follow the layout.
+func (l *Layout) Timestamp(path string) (timestamp, suffix string, ok bool) {
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	if len(parts) < len(l.elements) {
+		return "", "", false
+	}
+	parts = parts[len(parts)-len(l.elements):]
+
+	values := make(map[string]string, len(fields))
+	for i, re := range l.patterns {
+		match := re.FindStringSubmatch(parts[i])
+		if match == nil {
+			return "", "", false
+		}
+		for j, name := range re.SubexpNames() {
+			if name != "" {
+				values[name] = match[j]
+			}
+		}
+		suffix = match[len(match)-1]
+	}
+	return values["yyyy"] + "-" + values["mm"] + "-" + values["dd"] + "-" + values["hh"], suffix, true
+}
+
+var (
+	mu      sync.RWMutex
+	current = mustParse(constants.DefaultLayout)
+)
+
+func mustParse(template string) *Layout {
+	l, err := Parse(template)
+	if err != nil {
+		panic(fmt.Sprintf("invalid layout %q: %v", template, err))
+	}
+	return l
+}
+
+// Set makes a template the layout of the recordings directory.
+func Set(template string) error {
+	l, err := Parse(template)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	current = l
+	mu.Unlock()
+	return nil
+}
+
+// Current returns the layout of the recordings directory.
+func Current() *Layout {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
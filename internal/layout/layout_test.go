@@ -0,0 +1,55 @@
+package layout
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLayoutRoundTrip(t *testing.T) {
+	start := time.Date(2026, 4, 30, 22, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		template string
+		want     string
+	}{
+		{"{station}/{yyyy}-{mm}-{dd}-{hh}.{ext}", "station/2026-04-30-22.validation.json"},
+		{"{station}/{yyyy}/{mm}/{dd}/{hh}.{ext}", "station/2026/04/30/22.validation.json"},
+		{"{station}/{yyyy}-{mm}/{dd}-{hh}h.{ext}", "station/2026-04/30-22h.validation.json"},
+	} {
+		l, err := Parse(tc.template)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tc.template, err)
+		}
+		p := l.Path("station", start, ".validation.json")
+		if p != tc.want {
+			t.Errorf("%s: Path = %q, want %q", tc.template, p, tc.want)
+		}
+		timestamp, suffix, ok := l.Timestamp("/var/audio/" + p)
+		if !ok || timestamp != "2026-04-30-22" || suffix != ".validation.json" {
+			t.Errorf("%s: Timestamp(%q) = %q, %q, %v", tc.template, p, timestamp, suffix, ok)
+		}
+	}
+
+	l, _ := Parse("{station}/{yyyy}/{mm}/{dd}/{hh}.{ext}")
+	for _, p := range []string{"station/2026-04-30-22.mp3", "station/2026/04/30/test.mp3", "22.mp3"} {
+		if _, _, ok := l.Timestamp(p); ok {
+			t.Errorf("Timestamp(%q) matched, want no match", p)
+		}
+	}
+}
+
+func TestParseRejectsAmbiguousTemplates(t *testing.T) {
+	for template, want := range map[string]string{
+		"{yyyy}/{mm}/{dd}/{hh}.{ext}":                "must start with",
+		"{station}/{yyyy}/{mm}/{dd}/{hh}.mp3":        "must end with",
+		"{station}/{yyyy}/{mm}/{dd}.{hh}.{ext}":      "must not contain a dot",
+		"{station}/{yyyy}/{mm}/{hh}.{ext}":           "{dd} exactly once",
+		"{station}/{yyyy}/{mm}/{dd}/{hh}-{hh}.{ext}": "{hh} exactly once",
+		"{station}/../{yyyy}{mm}{dd}{hh}.{ext}":      "invalid path element",
+		"{station}/{year}/{mm}{dd}{hh}.{ext}":        "unknown placeholder {year}",
+	} {
+		if _, err := Parse(template); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Parse(%q) = %v, want an error containing %q", template, err, want)
+		}
+	}
+}
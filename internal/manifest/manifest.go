@@ -0,0 +1,301 @@
+// Package manifest maintains a tamper-evident record of the archive. Every
+// finished file is hashed with SHA-256 into a per-day manifest, and each
+// manifest includes the hash of the one before it, forming a chain.
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+	"github.com/oszuidwest/zwfm-audiologger/internal/recorder"
+	"github.com/oszuidwest/zwfm-audiologger/internal/retention"
+	"github.com/oszuidwest/zwfm-audiologger/internal/tier"
+	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
+)
+
+// Compile-time interface checks.
+var (
+	_ recorder.FileObserver     = (*Manager)(nil)
+	_ retention.RemovalObserver = (*Manager)(nil)
+)
+
+// Manifest lists the files that were finished or removed on one day.
+type Manifest struct {
+	Date string `json:"date"`
+	// PreviousDate and PreviousHash identify the manifest before this one. The
+	// hash covers the exact bytes of that manifest file after it was sealed.
+	PreviousDate string  `json:"previous_date,omitempty"`
+	PreviousHash string  `json:"previous_hash,omitempty"`
+	Sealed       bool    `json:"sealed"`
+	Entries      []Entry `json:"entries"`
+}
+
+// Entry records the hash of a file, or its removal by retention.
+type Entry struct {
+	// Path is relative to the recordings directory, such as station/2026-04-30-22.mp3.
+	Path    string `json:"path"`
+	SHA256  string `json:"sha256,omitempty"`
+	Size    int64  `json:"size,omitempty"`
+	Removed bool   `json:"removed,omitempty"`
+	// MovedTo is set on the removal of a file that was moved to a new path by
+	// a layout migration; the new path carries over its hash.
+	MovedTo  string    `json:"moved_to,omitempty"`
+	Recorded time.Time `json:"recorded_at"`
+}
+
+// Manager appends finished files to the manifest of the current day.
+type Manager struct {
+	config      *config.Config
+	archiveTier tier.Tier
+	dir         string
+	mu          sync.Mutex
+	now         func() time.Time
+
+	verifyMu sync.Mutex
+	verify   VerificationStatus
+}
+
+// New creates a manifest manager. The archive tier may be nil.
+func New(cfg *config.Config, archiveTier tier.Tier) *Manager {
+	return &Manager{
+		config:      cfg,
+		archiveTier: archiveTier,
+		dir:         filepath.Join(cfg.StateDir, constants.ManifestDirName),
+		now:         utils.Now,
+	}
+}
+
+// FileCompleted hashes a finished recording or sidecar into today's manifest.
+func (m *Manager) FileCompleted(_, _, path string) {
+	sum, size, err := hashFile(path)
+	if err != nil {
+		slog.Error("failed to hash file for manifest", "file", path, "error", err)
+		return
+	}
+	if err := m.append(Entry{Path: m.relPath(path), SHA256: sum, Size: size}); err != nil {
+		slog.Error("failed to add file to manifest", "file", path, "error", err)
+	}
+}
+
+// FileRemoved records that retention deleted a file, so verification does not
+// report it as missing.
+func (m *Manager) FileRemoved(path string) {
+	if err := m.append(Entry{Path: m.relPath(path), Removed: true}); err != nil {
+		slog.Error("failed to record removal in manifest", "file", path, "error", err)
+	}
+}
+
+// RecordMoves records files that were moved within the recordings directory,
+// given as old and new paths. The old path is marked as moved and the new path
+// gets the hash recorded for the old one, so a file changed before the move is
+// still reported by verification. Files that are not in the manifests are
+// skipped. It returns the number of moves recorded.
+func (m *Manager) RecordMoves(moves map[string]string) (int, error) {
+	latest, err := m.latest()
+	if err != nil {
+		return 0, err
+	}
+	var entries []Entry
+	for _, from := range slices.Sorted(maps.Keys(moves)) {
+		entry, ok := latest[m.relPath(from)]
+		if !ok || entry.Removed {
+			continue
+		}
+		to := m.relPath(moves[from])
+		entries = append(entries,
+			Entry{Path: entry.Path, Removed: true, MovedTo: to},
+			Entry{Path: to, SHA256: entry.SHA256, Size: entry.Size},
+		)
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	return len(entries) / 2, m.append(entries...)
+}
+
+// latest returns the last entry of every path in the manifests.
+func (m *Manager) latest() (map[string]Entry, error) {
+	dates, raw, err := m.readAll()
+	if err != nil {
+		return nil, err
+	}
+	latest := make(map[string]Entry)
+	for i, date := range dates {
+		manifest, err := parseManifest(raw[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", date, err)
+		}
+		for _, entry := range manifest.Entries {
+			latest[entry.Path] = entry
+		}
+	}
+	return latest, nil
+}
+
+// relPath converts a path in the recordings directory to the manifest form.
+// Paths in the archive tier are already relative and are returned unchanged.
+func (m *Manager) relPath(path string) string {
+	rel, err := filepath.Rel(m.config.RecordingsDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// append adds entries to today's manifest, creating it and sealing the
+// previous manifest when these are the first entries of the day.
+func (m *Manager) append(entries ...Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	date := now.Format(time.DateOnly)
+
+	if err := utils.EnsureDir(m.dir); err != nil {
+		return fmt.Errorf("failed to create manifest directory: %w", err)
+	}
+
+	manifest, err := m.load(date)
+	if os.IsNotExist(err) {
+		manifest, err = m.start(date)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open manifest %s: %w", date, err)
+	}
+
+	for _, entry := range entries {
+		entry.Recorded = now
+		manifest.Entries = append(manifest.Entries, entry)
+	}
+	if err := m.save(manifest); err != nil {
+		return fmt.Errorf("failed to save manifest %s: %w", date, err)
+	}
+	return nil
+}
+
+// start creates the manifest for date and links it to the latest earlier
+// manifest, sealing that one first.
+func (m *Manager) start(date string) (*Manifest, error) {
+	manifest := &Manifest{Date: date}
+
+	dates, err := listDates(m.dir)
+	if err != nil {
+		return nil, err
+	}
+	i, _ := slices.BinarySearch(dates, date)
+	if i == 0 {
+		return manifest, nil
+	}
+
+	previous, err := m.load(dates[i-1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to load previous manifest: %w", err)
+	}
+	if !previous.Sealed {
+		previous.Sealed = true
+		if err := m.save(previous); err != nil {
+			return nil, fmt.Errorf("failed to seal previous manifest: %w", err)
+		}
+	}
+
+	data, err := os.ReadFile(m.path(previous.Date))
+	if err != nil {
+		return nil, err
+	}
+	manifest.PreviousDate = previous.Date
+	manifest.PreviousHash = hashBytes(data)
+	return manifest, nil
+}
+
+func (m *Manager) path(date string) string {
+	return filepath.Join(m.dir, date+".json")
+}
+
+func (m *Manager) load(date string) (*Manifest, error) {
+	return loadManifest(m.path(date))
+}
+
+func (m *Manager) save(manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(m.path(manifest.Date), data)
+}
+
+// loadManifest reads and parses a manifest file.
+func loadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // G304: path is a manifest inside the state directory
+	if err != nil {
+		return nil, err
+	}
+	return parseManifest(data)
+}
+
+func parseManifest(data []byte) (*Manifest, error) {
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// listDates returns the dates of all manifests in dir, oldest first.
+func listDates(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var dates []string
+	for _, entry := range entries {
+		date, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, date); err == nil {
+			dates = append(dates, date)
+		}
+	}
+	slices.Sort(dates)
+	return dates, nil
+}
+
+// hashFile returns the hex-encoded SHA-256 and size of a file.
+func hashFile(path string) (string, int64, error) {
+	file, err := os.Open(path) //nolint:gosec // G304: path is a recording inside the recordings directory
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() { _ = file.Close() }()
+	return hashReader(file)
+}
+
+func hashReader(r io.Reader) (string, int64, error) {
+	h := sha256.New()
+	size, err := io.Copy(h, r)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,162 @@
+package manifest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+)
+
+func newTestManager(t *testing.T) (*Manager, *time.Time) {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := &config.Config{
+		RecordingsDir: filepath.Join(dir, "recordings"),
+		StateDir:      filepath.Join(dir, "recordings", ".audiologger"),
+	}
+	now := time.Date(2026, 4, 30, 22, 0, 0, 0, time.UTC)
+	m := New(cfg, nil)
+	m.now = func() time.Time { return now }
+	return m, &now
+}
+
+func writeRecording(t *testing.T, m *Manager, name, content string) string {
+	t.Helper()
+	path := filepath.Join(m.config.RecordingsDir, "station", name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func verify(t *testing.T, m *Manager) *Report {
+	t.Helper()
+	report, err := m.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	return report
+}
+
+func TestVerifyDetectsMismatchAndMissing(t *testing.T) {
+	m, now := newTestManager(t)
+	first := writeRecording(t, m, "2026-04-30-22.mp3", "first hour")
+	m.FileCompleted("station", "2026-04-30-22", first)
+	*now = now.Add(24 * time.Hour)
+	second := writeRecording(t, m, "2026-05-01-22.mp3", "second hour")
+	m.FileCompleted("station", "2026-05-01-22", second)
+
+	if report := verify(t, m); !report.OK() || report.Verified != 2 || report.Manifests != 2 {
+		t.Fatalf("clean archive report = %+v, want 2 verified files in 2 manifests", report)
+	}
+
+	if err := os.WriteFile(first, []byte("first hour, edited"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(second); err != nil {
+		t.Fatal(err)
+	}
+
+	report := verify(t, m)
+	if len(report.Mismatched) != 1 || report.Mismatched[0] != "station/2026-04-30-22.mp3" {
+		t.Errorf("Mismatched = %v, want the edited recording", report.Mismatched)
+	}
+	if len(report.Missing) != 1 || report.Missing[0] != "station/2026-05-01-22.mp3" {
+		t.Errorf("Missing = %v, want the deleted recording", report.Missing)
+	}
+}
+
+func TestVerifyAcceptsRetentionRemovals(t *testing.T) {
+	m, now := newTestManager(t)
+	path := writeRecording(t, m, "2026-04-30-22.mp3", "audio")
+	m.FileCompleted("station", "2026-04-30-22", path)
+
+	*now = now.Add(48 * time.Hour)
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	m.FileRemoved(path)
+
+	report := verify(t, m)
+	if !report.OK() || report.Removed != 1 || report.Files != 0 {
+		t.Errorf("report = %+v, want one removed file and no problems", report)
+	}
+}
+
+func TestRecordMovesCarriesHashesOver(t *testing.T) {
+	m, now := newTestManager(t)
+	kept := writeRecording(t, m, "2026-04-30-22.mp3", "audio")
+	edited := writeRecording(t, m, "2026-04-30-23.mp3", "audio")
+	m.FileCompleted("station", "2026-04-30-22", kept)
+	m.FileCompleted("station", "2026-04-30-23", edited)
+
+	*now = now.Add(24 * time.Hour)
+	moves := map[string]string{
+		kept:   writeRecording(t, m, "2026/04/30/22.mp3", "audio"),
+		edited: writeRecording(t, m, "2026/04/30/23.mp3", "audio, edited before the move"),
+		writeRecording(t, m, "untracked.mp3", "x"): filepath.Join(m.config.RecordingsDir, "station", "2026", "untracked.mp3"),
+	}
+	for from := range moves {
+		if err := os.Remove(from); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recorded, err := m.RecordMoves(moves)
+	if err != nil || recorded != 2 {
+		t.Fatalf("RecordMoves = %d, %v, want 2 moves", recorded, err)
+	}
+
+	report := verify(t, m)
+	if report.Removed != 2 || report.Verified != 1 || len(report.Missing) != 0 {
+		t.Errorf("report = %+v, want 2 moved files and 1 verified", report)
+	}
+	if len(report.Mismatched) != 1 || report.Mismatched[0] != "station/2026/04/30/23.mp3" {
+		t.Errorf("Mismatched = %v, want the recording edited before the move", report.Mismatched)
+	}
+}
+
+func TestVerifyDetectsBrokenChain(t *testing.T) {
+	m, now := newTestManager(t)
+	for day := range 3 {
+		name := now.Format("2006-01-02-15") + ".mp3"
+		m.FileCompleted("station", "", writeRecording(t, m, name, name))
+		if day < 2 {
+			*now = now.Add(24 * time.Hour)
+		}
+	}
+
+	previous, err := m.load("2026-04-30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !previous.Sealed {
+		t.Error("previous manifest was not sealed when a new day started")
+	}
+
+	// Rewriting an old manifest, even with a consistent entry, breaks the link
+	// from the next day.
+	previous.Entries[0].SHA256 = strings.Repeat("0", 64)
+	if err := m.save(previous); err != nil {
+		t.Fatal(err)
+	}
+	report := verify(t, m)
+	if len(report.BrokenLinks) != 1 || !strings.HasPrefix(report.BrokenLinks[0], "2026-05-01:") {
+		t.Errorf("BrokenLinks = %v, want the link from 2026-05-01", report.BrokenLinks)
+	}
+
+	// Deleting a manifest from the middle of the chain is detected as well.
+	if err := os.Remove(m.path("2026-05-01")); err != nil {
+		t.Fatal(err)
+	}
+	report = verify(t, m)
+	if len(report.BrokenLinks) != 1 || !strings.HasPrefix(report.BrokenLinks[0], "2026-05-02:") {
+		t.Errorf("BrokenLinks = %v, want the link from 2026-05-02", report.BrokenLinks)
+	}
+}
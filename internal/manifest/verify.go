@@ -0,0 +1,239 @@
+package manifest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
+)
+
+// Report is the outcome of a verification run.
+type Report struct {
+	Manifests int `json:"manifests"`
+	Files     int `json:"files"`
+	Verified  int `json:"verified"`
+	Removed   int `json:"removed"`
+	// Mismatched lists files whose content no longer matches the manifest.
+	Mismatched []string `json:"mismatched,omitempty"`
+	// Missing lists files that are in neither the recordings directory nor the
+	// archive tier, although retention never deleted them.
+	Missing []string `json:"missing,omitempty"`
+	// BrokenLinks describes manifests whose link to the previous manifest does
+	// not hold, which means a manifest was edited, replaced or deleted.
+	BrokenLinks []string `json:"broken_links,omitempty"`
+	// Errors lists files or manifests that could not be read.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// OK reports whether the verification found no problems.
+func (r *Report) OK() bool {
+	return len(r.Mismatched) == 0 && len(r.Missing) == 0 && len(r.BrokenLinks) == 0 && len(r.Errors) == 0
+}
+
+// VerificationStatus describes the current or last verification started via
+// StartVerification.
+type VerificationStatus struct {
+	Running    bool       `json:"running"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Report     *Report    `json:"report,omitempty"`
+}
+
+// Verify checks the manifest chain and re-hashes the latest version of every
+// file it lists. Files are looked up in the recordings directory first and
+// then in the archive tier.
+func (m *Manager) Verify(ctx context.Context) (*Report, error) {
+	report := &Report{}
+
+	dates, raw, err := m.readAll()
+	if err != nil {
+		return nil, err
+	}
+	report.Manifests = len(dates)
+
+	latest := make(map[string]Entry)
+	var order []string
+	for i, date := range dates {
+		manifest, err := parseManifest(raw[i])
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", date, err))
+			continue
+		}
+		if link := checkLink(manifest, dates, raw, i); link != "" {
+			report.BrokenLinks = append(report.BrokenLinks, fmt.Sprintf("%s: %s", date, link))
+		}
+		for _, entry := range manifest.Entries {
+			if _, seen := latest[entry.Path]; !seen {
+				order = append(order, entry.Path)
+			}
+			latest[entry.Path] = entry
+		}
+	}
+
+	for _, path := range order {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		entry := latest[path]
+		if entry.Removed {
+			report.Removed++
+			continue
+		}
+		report.Files++
+
+		sum, size, err := m.hashStored(ctx, path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			report.Missing = append(report.Missing, path)
+		case err != nil:
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", path, err))
+		case sum != entry.SHA256 || size != entry.Size:
+			report.Mismatched = append(report.Mismatched, path)
+		default:
+			report.Verified++
+		}
+	}
+
+	return report, nil
+}
+
+// readAll returns the dates and raw contents of all manifests. It holds the
+// lock so a manifest is not sealed between reading it and its successor.
+func (m *Manager) readAll() ([]string, [][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dates, err := listDates(m.dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	raw := make([][]byte, len(dates))
+	for i, date := range dates {
+		if raw[i], err = os.ReadFile(m.path(date)); err != nil {
+			return nil, nil, err
+		}
+	}
+	return dates, raw, nil
+}
+
+// checkLink verifies that manifest i points at manifest i-1 with the right
+// hash. It returns a description of the problem, or "" if the link holds.
+func checkLink(manifest *Manifest, dates []string, raw [][]byte, i int) string {
+	if manifest.Date != dates[i] {
+		return fmt.Sprintf("manifest claims date %s", manifest.Date)
+	}
+	if i == 0 {
+		if manifest.PreviousDate != "" {
+			return fmt.Sprintf("previous manifest %s is missing", manifest.PreviousDate)
+		}
+		return ""
+	}
+	if manifest.PreviousDate != dates[i-1] {
+		return fmt.Sprintf("links to %q instead of %s", manifest.PreviousDate, dates[i-1])
+	}
+	if manifest.PreviousHash != hashBytes(raw[i-1]) {
+		return fmt.Sprintf("hash of %s does not match", dates[i-1])
+	}
+	return ""
+}
+
+// hashStored hashes a file from the recordings directory or the archive tier.
+func (m *Manager) hashStored(ctx context.Context, path string) (string, int64, error) {
+	sum, size, err := hashFile(filepath.Join(m.config.RecordingsDir, filepath.FromSlash(path)))
+	if !errors.Is(err, fs.ErrNotExist) || m.archiveTier == nil {
+		return sum, size, err
+	}
+
+	file, err := m.archiveTier.Open(ctx, path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() { _ = file.Close() }()
+	return hashReader(file)
+}
+
+// StartVerification runs Verify in the background. It returns false if a
+// verification is already running.
+func (m *Manager) StartVerification(ctx context.Context) bool {
+	m.verifyMu.Lock()
+	defer m.verifyMu.Unlock()
+
+	if m.verify.Running {
+		return false
+	}
+	started := utils.Now()
+	m.verify = VerificationStatus{Running: true, StartedAt: &started, Report: m.verify.Report}
+
+	go func() {
+		report, err := m.Verify(ctx)
+		if err != nil {
+			slog.Error("integrity verification failed", "error", err)
+		} else {
+			logReport(report)
+		}
+
+		m.verifyMu.Lock()
+		defer m.verifyMu.Unlock()
+		finished := utils.Now()
+		m.verify.Running = false
+		m.verify.FinishedAt = &finished
+		if err == nil {
+			m.verify.Report = report
+		}
+	}()
+	return true
+}
+
+// VerificationStatus returns the state of the current or last background verification.
+func (m *Manager) VerificationStatus() any {
+	m.verifyMu.Lock()
+	defer m.verifyMu.Unlock()
+	return m.verify
+}
+
+// WriteReport prints a human-readable report.
+func WriteReport(w io.Writer, report *Report) {
+	_, _ = fmt.Fprintf(w, "Manifests:  %d\n", report.Manifests)
+	_, _ = fmt.Fprintf(w, "Files:      %d\n", report.Files)
+	_, _ = fmt.Fprintf(w, "Verified:   %d\n", report.Verified)
+	_, _ = fmt.Fprintf(w, "Removed:    %d\n", report.Removed)
+	for _, link := range report.BrokenLinks {
+		_, _ = fmt.Fprintf(w, "BROKEN LINK  %s\n", link)
+	}
+	for _, path := range report.Mismatched {
+		_, _ = fmt.Fprintf(w, "MISMATCH     %s\n", path)
+	}
+	for _, path := range report.Missing {
+		_, _ = fmt.Fprintf(w, "MISSING      %s\n", path)
+	}
+	for _, msg := range report.Errors {
+		_, _ = fmt.Fprintf(w, "ERROR        %s\n", msg)
+	}
+	if report.OK() {
+		_, _ = fmt.Fprintln(w, "OK")
+	}
+}
+
+func logReport(report *Report) {
+	attrs := []any{
+		"manifests", report.Manifests,
+		"files", report.Files,
+		"verified", report.Verified,
+		"mismatched", len(report.Mismatched),
+		"missing", len(report.Missing),
+		"broken_links", len(report.BrokenLinks),
+		"errors", len(report.Errors),
+	}
+	if report.OK() {
+		slog.Info("Integrity verification passed", attrs...)
+		return
+	}
+	slog.Warn("Integrity verification found problems", attrs...)
+}
@@ -41,6 +41,20 @@ func (f *Fetcher) Fetch(ctx context.Context, url, jsonPath string, parseJSON boo
 	return f.fetchRaw(ctx, url)
 }
 
+// Resolve retrieves metadata like Fetch but returns fetch and JSON path errors
+// instead of logging them, so a configuration can be checked against a live
+// response.
+func (f *Fetcher) Resolve(ctx context.Context, url, jsonPath string, parseJSON bool) (string, error) {
+	body, err := f.fetchURL(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	if parseJSON && jsonPath != "" {
+		return extractJSONPath(body, jsonPath)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
 // fetchURL retrieves raw content from a URL.
 func (f *Fetcher) fetchURL(ctx context.Context, url string) ([]byte, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
@@ -0,0 +1,200 @@
+// Package migrate moves an existing archive from one layout of the recordings
+// directory to another, such as from flat station directories to directories
+// per year, month and day. It runs while the service is stopped.
+package migrate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/archive"
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+	"github.com/oszuidwest/zwfm-audiologger/internal/layout"
+	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
+)
+
+// queueFiles are the persistent queues in the state directory that hold paths
+// of recordings.
+var queueFiles = []string{
+	constants.ValidationQueueFile,
+	constants.UploadQueueFile,
+	constants.TimestampQueueFile,
+	constants.ProxyQueueFile,
+}
+
+// Report is the outcome of a migration.
+type Report struct {
+	// Moves maps the old path of every moved file to its new path.
+	Moves map[string]string
+	// Conflicts lists files that were not moved because their new path is
+	// already taken.
+	Conflicts []string
+	// Unmatched lists files that do not follow the old layout, such as test
+	// recordings, which are left in place.
+	Unmatched []string
+	// Queued is the number of queued jobs whose paths were rewritten.
+	Queued int
+	// Errors lists files or queues that could not be moved or rewritten.
+	Errors []string
+}
+
+// OK reports whether every file that follows the old layout was moved.
+func (r *Report) OK() bool {
+	return len(r.Conflicts) == 0 && len(r.Errors) == 0
+}
+
+// Run moves the recordings of every configured station from the layout from to
+// the layout to, and rewrites the paths in the persistent queues. A file is
+// never overwritten: when its new path is taken it stays where it is. With
+// dryRun nothing is changed and the report lists what would be moved.
+func Run(cfg *config.Config, from, to *layout.Layout, dryRun bool) (*Report, error) {
+	if from.String() == to.String() {
+		return nil, fmt.Errorf("the archive already uses layout %q", to)
+	}
+
+	report := &Report{Moves: make(map[string]string)}
+	for _, station := range slices.Sorted(maps.Keys(cfg.Stations)) {
+		files, err := archive.ScanFiles(cfg.RecordingsDir, station)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read station %s: %w", station, err)
+		}
+		for _, file := range files {
+			if strings.HasPrefix(filepath.Base(file.Path), ".") {
+				continue
+			}
+			if _, done := targetPath(cfg.RecordingsDir, station, file.Path, to, to); done {
+				continue // Already in the new layout.
+			}
+			target, ok := targetPath(cfg.RecordingsDir, station, file.Path, from, to)
+			if !ok {
+				report.Unmatched = append(report.Unmatched, file.Path)
+				continue
+			}
+			report.move(cfg.RecordingsDir, file.Path, target, dryRun)
+		}
+	}
+	if dryRun || len(report.Moves) == 0 {
+		return report, nil
+	}
+
+	for _, name := range queueFiles {
+		n, err := rewriteQueue(filepath.Join(cfg.StateDir, name), report.Moves)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", name, err))
+		}
+		report.Queued += n
+	}
+	return report, nil
+}
+
+// targetPath returns the path of a file in the layout to, or false when the
+// file is not where the layout from puts it.
+func targetPath(recordingsDir, station, file string, from, to *layout.Layout) (string, bool) {
+	timestamp, suffix, ok := from.Timestamp(file)
+	if !ok {
+		return "", false
+	}
+	t, err := time.Parse(utils.HourlyTimestampFormat, timestamp)
+	if err != nil {
+		return "", false
+	}
+	if filepath.Join(recordingsDir, filepath.FromSlash(from.Path(station, t, suffix))) != file {
+		return "", false // The end of the path matches, but not at the right depth.
+	}
+	return filepath.Join(recordingsDir, filepath.FromSlash(to.Path(station, t, suffix))), true
+}
+
+// move renames a file to its new path unless that path is taken, and removes
+// the directories it leaves empty.
+func (r *Report) move(recordingsDir, from, to string, dryRun bool) {
+	if _, err := os.Lstat(to); !errors.Is(err, os.ErrNotExist) {
+		r.Conflicts = append(r.Conflicts, from)
+		return
+	}
+	if dryRun {
+		r.Moves[from] = to
+		return
+	}
+	if err := utils.EnsureDir(filepath.Dir(to)); err != nil {
+		r.Errors = append(r.Errors, err.Error())
+		return
+	}
+	if err := os.Rename(from, to); err != nil {
+		r.Errors = append(r.Errors, err.Error())
+		return
+	}
+	r.Moves[from] = to
+	utils.RemoveEmptyDirs(recordingsDir, from)
+}
+
+// rewriteQueue replaces the moved paths in a persistent queue, which is a JSON
+// array of jobs. It returns the number of jobs that changed.
+func rewriteQueue(path string, moves map[string]string) (int, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // G304: path is a queue in the state directory
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	// Numbers are kept as written, so large sizes do not lose precision.
+	var jobs []map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&jobs); err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, job := range jobs {
+		rewritten := false
+		for key, value := range job {
+			if s, ok := value.(string); ok && moves[s] != "" {
+				job[key] = moves[s]
+				rewritten = true
+			}
+		}
+		if rewritten {
+			changed++
+		}
+	}
+	if changed == 0 {
+		return 0, nil
+	}
+	if data, err = json.MarshalIndent(jobs, "", "  "); err != nil {
+		return 0, err
+	}
+	return changed, utils.WriteFileAtomic(path, data)
+}
+
+// WriteReport prints a migration report in a human-readable form.
+func WriteReport(w io.Writer, report *Report, dryRun bool) {
+	verb, summary := "MOVED", "moved"
+	if dryRun {
+		verb, summary = "MOVE ", "to move"
+	}
+	for _, from := range slices.Sorted(maps.Keys(report.Moves)) {
+		_, _ = fmt.Fprintf(w, "%s     %s -> %s\n", verb, from, report.Moves[from])
+	}
+	for _, path := range report.Conflicts {
+		_, _ = fmt.Fprintf(w, "CONFLICT  %s\n", path)
+	}
+	for _, path := range report.Unmatched {
+		_, _ = fmt.Fprintf(w, "SKIPPED   %s\n", path)
+	}
+	for _, msg := range report.Errors {
+		_, _ = fmt.Fprintf(w, "ERROR     %s\n", msg)
+	}
+	_, _ = fmt.Fprintf(w, "%d files %s, %d conflicts, %d skipped, %d queued jobs updated\n",
+		len(report.Moves), summary, len(report.Conflicts), len(report.Unmatched), report.Queued)
+}
@@ -0,0 +1,81 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+	"github.com/oszuidwest/zwfm-audiologger/internal/layout"
+)
+
+func TestRunMovesFlatArchiveIntoDatedLayout(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		RecordingsDir: dir,
+		StateDir:      filepath.Join(dir, ".audiologger"),
+		Stations:      map[string]config.Station{"station": {}},
+	}
+	write := func(name, content string) string {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	recording := write("station/2026-04-30-22.mp3", "audio")
+	sidecar := write("station/2026-04-30-22.validation.json", "{}")
+	taken := write("station/2026-04-30-23.mp3", "older copy")
+	write("station/2026/04/30/23.mp3", "already moved")
+	test := write("station/test-2026-04-30-21-15-00.mp3", "test")
+	queue := write(".audiologger/"+constants.ValidationQueueFile,
+		`[{"station":"station","file_path":"`+recording+`","attempts":3}]`)
+
+	from, _ := layout.Parse(constants.DefaultLayout)
+	to, _ := layout.Parse("{station}/{yyyy}/{mm}/{dd}/{hh}.{ext}")
+
+	report, err := Run(cfg, from, to, true)
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if len(report.Moves) != 2 {
+		t.Fatalf("dry run Moves = %v, want the recording and its sidecar", report.Moves)
+	}
+	if _, err := os.Stat(recording); err != nil {
+		t.Fatalf("dry run moved %s: %v", recording, err)
+	}
+
+	report, err = Run(cfg, from, to, false)
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	moved := filepath.Join(dir, "station", "2026", "04", "30", "22.mp3")
+	if report.Moves[recording] != moved || report.Moves[sidecar] == "" {
+		t.Errorf("Moves = %v, want %s moved to %s", report.Moves, recording, moved)
+	}
+	if data, err := os.ReadFile(moved); err != nil || string(data) != "audio" {
+		t.Errorf("moved recording = %q, %v", data, err)
+	}
+	if len(report.Conflicts) != 1 || report.Conflicts[0] != taken || report.OK() {
+		t.Errorf("Conflicts = %v, want %s, which must not be overwritten", report.Conflicts, taken)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "station", "2026", "04", "30", "23.mp3")); string(data) != "already moved" {
+		t.Errorf("existing file was overwritten with %q", data)
+	}
+	if len(report.Unmatched) != 1 || report.Unmatched[0] != test {
+		t.Errorf("Unmatched = %v, want the test recording", report.Unmatched)
+	}
+
+	data, err := os.ReadFile(queue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Queued != 1 || !strings.Contains(string(data), `"file_path": "`+moved+`"`) || !strings.Contains(string(data), `"attempts": 3`) {
+		t.Errorf("queue = %s, want the new path and the other fields kept", data)
+	}
+}
@@ -0,0 +1,273 @@
+// Package objectstore implements a minimal client for S3-compatible object
+// storage such as MinIO, using path-style requests signed with Signature Version 4.
+package objectstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+)
+
+// ErrNotFound is returned when an object does not exist.
+var ErrNotFound = errors.New("object not found")
+
+// Object describes a stored object.
+type Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// Client talks to one bucket of an S3-compatible endpoint.
+type Client struct {
+	endpoint   *url.URL
+	region     string
+	bucket     string
+	accessKey  string
+	secretKey  string
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+// New creates a client for the configured bucket.
+func New(cfg *config.S3Config) (*Client, error) {
+	endpoint, err := url.Parse(strings.TrimRight(cfg.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("s3 endpoint must use http or https, got %q", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3 bucket is required")
+	}
+	region := cfg.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return &Client{
+		endpoint:   endpoint,
+		region:     region,
+		bucket:     cfg.Bucket,
+		accessKey:  cfg.AccessKey,
+		secretKey:  cfg.SecretKey,
+		httpClient: &http.Client{Transport: newTransport()},
+		now:        time.Now,
+	}, nil
+}
+
+// newTransport returns a transport that gives up on an endpoint that does not
+// accept the connection or does not answer, so a stalled endpoint cannot hold
+// up moves, uploads and verifications forever.
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: constants.ObjectStoreConnectTimeout}).DialContext
+	transport.TLSHandshakeTimeout = constants.ObjectStoreConnectTimeout
+	transport.ResponseHeaderTimeout = constants.ObjectStoreResponseTimeout
+	return transport
+}
+
+// String returns the bucket URL, for logging.
+func (c *Client) String() string {
+	return c.endpoint.String() + "/" + c.bucket
+}
+
+// objectURL returns the path-style URL for a key, or for the bucket itself
+// when key is empty.
+func (c *Client) objectURL(key string) *url.URL {
+	u := *c.endpoint
+	u.Path = c.endpoint.Path + "/" + c.bucket
+	u.RawPath = c.endpoint.EscapedPath() + "/" + uriEncode(c.bucket)
+	if key != "" {
+		u.Path += "/" + key
+		u.RawPath += "/" + escapeKey(key)
+	}
+	return &u
+}
+
+// newRequest builds a signed request.
+func (c *Client) newRequest(ctx context.Context, method string, u *url.URL, body io.Reader, payloadHash string, header http.Header) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	sign(req, c.accessKey, c.secretKey, c.region, payloadHash, c.now())
+	return req, nil
+}
+
+// PutFile uploads a local file. The SHA-256 of the content is sent with the
+// request, so the server rejects the upload if the data arrives corrupted.
+// It returns the hex-encoded SHA-256 of the uploaded content.
+func (c *Client) PutFile(ctx context.Context, key, path string) (string, error) {
+	file, err := os.Open(path) //nolint:gosec // G304: path is a recording inside the recordings directory
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = file.Close() }()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPut, c.objectURL(key), file, sum, nil)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = size
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return "", responseError(resp)
+	}
+	return sum, nil
+}
+
+// Get fetches an object. Headers such as Range are forwarded. The caller must
+// close the response body.
+func (c *Client) Get(ctx context.Context, key string, header http.Header) (*http.Response, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, c.objectURL(key), http.NoBody, emptyPayloadHash, header)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent, http.StatusNotModified, http.StatusRequestedRangeNotSatisfiable:
+		return resp, nil
+	case http.StatusNotFound:
+		_ = resp.Body.Close()
+		return nil, ErrNotFound
+	default:
+		defer func() { _ = resp.Body.Close() }()
+		return nil, responseError(resp)
+	}
+}
+
+// Head returns the size and modification time of an object.
+func (c *Client) Head(ctx context.Context, key string) (Object, error) {
+	req, err := c.newRequest(ctx, http.MethodHead, c.objectURL(key), http.NoBody, emptyPayloadHash, nil)
+	if err != nil {
+		return Object{}, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return Object{}, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		lastModified, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+		return Object{Key: key, Size: resp.ContentLength, LastModified: lastModified}, nil
+	case http.StatusNotFound:
+		return Object{}, ErrNotFound
+	default:
+		return Object{}, fmt.Errorf("s3 HEAD returned %s", resp.Status)
+	}
+}
+
+// Delete removes an object. Deleting a missing object is not an error.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, c.objectURL(key), http.NoBody, emptyPayloadHash, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return responseError(resp)
+	}
+	return nil
+}
+
+// listResult is the ListObjectsV2 response body.
+type listResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List returns all objects whose key starts with prefix.
+func (c *Client) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	token := ""
+	for {
+		u := c.objectURL("")
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		u.RawQuery = canonicalQuery(query)
+
+		req, err := c.newRequest(ctx, http.MethodGet, u, http.NoBody, emptyPayloadHash, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := responseError(resp)
+			_ = resp.Body.Close()
+			return nil, err
+		}
+
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse list response: %w", err)
+		}
+
+		for _, item := range result.Contents {
+			objects = append(objects, Object{Key: item.Key, Size: item.Size, LastModified: item.LastModified})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// responseError builds an error from an unexpected response, including the
+// start of the body which usually carries the S3 error code.
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("s3 %s returned %s: %s", resp.Request.Method, resp.Status, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,169 @@
+// Package playback presents the hourly recordings of a station as one
+// continuous timeline for listening back.
+package playback
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/archive"
+	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
+)
+
+// maxCachedDurations bounds the duration cache; it is cleared when full.
+const maxCachedDurations = 10000
+
+// Item is a finished recording on the timeline.
+type Item struct {
+	Timestamp string
+	Start     time.Time
+	// Path is the file played back: the proxy when there is one, because it is
+	// cheaper to decode, otherwise the recording.
+	Path     string
+	Duration float64 // In seconds
+}
+
+// Items returns the finished recordings that overlap the range from..to,
+// oldest first.
+func Items(ctx context.Context, durations *Durations, recordings []archive.Recording, from, to time.Time) ([]Item, error) {
+	var items []Item
+	for _, rec := range recordings {
+		if rec.Audio == "" || rec.InProgress() || !rec.Parsed || !rec.Time.Before(to) {
+			continue
+		}
+		// Recordings last at most about an hour, so older ones cannot overlap.
+		if rec.Time.Add(constants.HourlyRecordingTimeout).Before(from) {
+			continue
+		}
+		it, err := NewItem(ctx, durations, &rec)
+		if err != nil {
+			return nil, err
+		}
+		if it.Start.Add(seconds(it.Duration)).After(from) {
+			items = append(items, it)
+		}
+	}
+	return items, nil
+}
+
+// NewItem returns the timeline item of a finished recording.
+func NewItem(ctx context.Context, durations *Durations, rec *archive.Recording) (Item, error) {
+	path := rec.Audio
+	if p := rec.Proxy(); p != "" {
+		path = p
+	}
+	duration, err := durations.Get(ctx, path)
+	if err != nil {
+		return Item{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return Item{Timestamp: rec.Timestamp, Start: rec.Time, Path: path, Duration: duration}, nil
+}
+
+// Segments returns the number of HLS segments of an item.
+func (it Item) Segments() int {
+	return int(math.Ceil(it.Duration / constants.HLSSegmentDuration.Seconds()))
+}
+
+// Segment returns the start offset and duration in seconds of segment i.
+func (it Item) Segment(i int) (start, duration float64) {
+	length := constants.HLSSegmentDuration.Seconds()
+	start = float64(i) * length
+	return start, min(length, it.Duration-start)
+}
+
+// WritePlaylist writes an HLS playlist of the segments of items that overlap
+// from..to. Each recording starts a discontinuity with its wall-clock time,
+// so players can show the time of day and gaps between hours are skipped.
+func WritePlaylist(w io.Writer, items []Item, from, to time.Time, segmentURL func(timestamp string, i int) string) error {
+	length := constants.HLSSegmentDuration.Seconds()
+
+	_, err := fmt.Fprintf(w, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:%d\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXT-X-MEDIA-SEQUENCE:0\n", int(length))
+	if err != nil {
+		return err
+	}
+	written := false
+	for _, it := range items {
+		first := max(0, int(from.Sub(it.Start).Seconds()/length))
+		last := min(it.Segments(), int(math.Ceil(to.Sub(it.Start).Seconds()/length)))
+		if first >= last {
+			continue
+		}
+
+		if written {
+			if _, err := io.WriteString(w, "#EXT-X-DISCONTINUITY\n"); err != nil {
+				return err
+			}
+		}
+		written = true
+		start := it.Start.Add(seconds(float64(first) * length))
+		if _, err := fmt.Fprintf(w, "#EXT-X-PROGRAM-DATE-TIME:%s\n", start.Format("2006-01-02T15:04:05.000Z07:00")); err != nil {
+			return err
+		}
+		for i := first; i < last; i++ {
+			_, duration := it.Segment(i)
+			if _, err := fmt.Fprintf(w, "#EXTINF:%.3f,\n%s\n", duration, segmentURL(it.Timestamp, i)); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = io.WriteString(w, "#EXT-X-ENDLIST\n")
+	return err
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// Durations caches the durations of recordings by path, size and modification
+// time, so a playlist over a whole day does not probe every file each time.
+type Durations struct {
+	probe func(ctx context.Context, file string) (float64, error)
+
+	mu    sync.Mutex
+	cache map[string]cachedDuration
+}
+
+type cachedDuration struct {
+	size     int64
+	modTime  time.Time
+	duration float64
+}
+
+// NewDurations creates an empty duration cache that probes files with ffprobe.
+func NewDurations() *Durations {
+	return &Durations{probe: utils.ProbeDuration, cache: make(map[string]cachedDuration)}
+}
+
+// Get returns the duration of a file in seconds.
+func (d *Durations) Get(ctx context.Context, path string) (float64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	d.mu.Lock()
+	cached, ok := d.cache[path]
+	d.mu.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.duration, nil
+	}
+
+	duration, err := d.probe(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+
+	d.mu.Lock()
+	if len(d.cache) >= maxCachedDurations {
+		clear(d.cache)
+	}
+	d.cache[path] = cachedDuration{size: info.Size(), modTime: info.ModTime(), duration: duration}
+	d.mu.Unlock()
+	return duration, nil
+}
@@ -0,0 +1,86 @@
+package playback
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/archive"
+)
+
+func TestWritePlaylistSpansHours(t *testing.T) {
+	dir := t.TempDir()
+	stationDir := filepath.Join(dir, "station")
+	if err := os.MkdirAll(stationDir, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		"2026-04-30-09.mp3",        // Before the range.
+		"2026-04-30-10.mp3",        // Partly in the range.
+		"2026-04-30-10.proxy.opus", // Played instead of the recording.
+		"2026-04-30-11.mp3",        // Catchup recording of 25 seconds.
+		"2026-04-30-13.mkv",        // In progress.
+	} {
+		if err := os.WriteFile(filepath.Join(stationDir, name), []byte(name), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recordings, err := archive.Scan(dir, "station")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	durations := &Durations{
+		probe: func(_ context.Context, file string) (float64, error) {
+			if strings.HasSuffix(file, "-11.mp3") {
+				return 25, nil
+			}
+			return 3600, nil
+		},
+		cache: make(map[string]cachedDuration),
+	}
+	from := time.Date(2026, 4, 30, 10, 59, 35, 0, time.UTC)
+	to := time.Date(2026, 4, 30, 14, 0, 0, 0, time.UTC)
+	items, err := Items(context.Background(), durations, recordings, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].Path != filepath.Join(stationDir, "2026-04-30-10.proxy.opus") {
+		t.Fatalf("items = %+v, want the proxy of 10:00 and the recording of 11:00", items)
+	}
+
+	var b strings.Builder
+	segmentURL := func(timestamp string, i int) string { return fmt.Sprintf("%s/%d.ts", timestamp, i) }
+	if err := WritePlaylist(&b, items, from, to, segmentURL); err != nil {
+		t.Fatal(err)
+	}
+	want := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:10
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-PROGRAM-DATE-TIME:2026-04-30T10:59:30.000Z
+#EXTINF:10.000,
+2026-04-30-10/357.ts
+#EXTINF:10.000,
+2026-04-30-10/358.ts
+#EXTINF:10.000,
+2026-04-30-10/359.ts
+#EXT-X-DISCONTINUITY
+#EXT-X-PROGRAM-DATE-TIME:2026-04-30T11:00:00.000Z
+#EXTINF:10.000,
+2026-04-30-11/0.ts
+#EXTINF:10.000,
+2026-04-30-11/1.ts
+#EXTINF:5.000,
+2026-04-30-11/2.ts
+#EXT-X-ENDLIST
+`
+	if b.String() != want {
+		t.Errorf("playlist:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
@@ -0,0 +1,165 @@
+package playback
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/archive"
+	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+)
+
+// Source is a recording to play from Offset seconds on.
+type Source struct {
+	Item
+	Offset float64
+	// Done is nil for a finished recording. For the recording in progress it
+	// is closed once the recorder stops writing to Path.
+	Done <-chan struct{}
+}
+
+// Live reports whether the source is the recording in progress.
+func (s Source) Live() bool {
+	return s.Done != nil
+}
+
+// Next returns the source to play at t among the recordings that start after
+// after: the recording that covers t, from the offset of t, or else the first
+// one that starts later. Live is the recording in progress, or nil. Next
+// reports false when there is no such recording yet.
+func Next(ctx context.Context, durations *Durations, recordings []archive.Recording, live *Source, t, after time.Time) (Source, bool, error) {
+	var next *Source
+	for i := range recordings {
+		rec := &recordings[i]
+		if rec.Audio == "" || rec.InProgress() || !rec.Parsed || !rec.Time.After(after) {
+			continue
+		}
+		if rec.Time.After(t) {
+			it, err := NewItem(ctx, durations, rec)
+			if err != nil {
+				return Source{}, false, err
+			}
+			next = &Source{Item: it}
+			break // Recordings are sorted, so this is the first one after t.
+		}
+		if rec.Time.Add(constants.HourlyRecordingTimeout).Before(t) {
+			continue // Too old to cover t.
+		}
+		it, err := NewItem(ctx, durations, rec)
+		if err != nil {
+			return Source{}, false, err
+		}
+		if offset := t.Sub(it.Start).Seconds(); offset < it.Duration {
+			return Source{Item: it, Offset: offset}, true, nil
+		}
+	}
+
+	if live != nil && live.Start.After(after) {
+		if !live.Start.After(t) {
+			source := *live
+			source.Offset = t.Sub(live.Start).Seconds()
+			return source, true, nil
+		}
+		if next == nil || live.Start.Before(next.Start) {
+			return *live, true, nil
+		}
+	}
+	if next != nil {
+		return *next, true, nil
+	}
+	return Source{}, false, nil
+}
+
+// follower reads a file that is still being written. At the end of the data
+// it waits for more until done is closed.
+type follower struct {
+	ctx  context.Context
+	file *os.File
+	done <-chan struct{}
+}
+
+// Follow opens a file that is still being written, like tail -f. Reads block
+// at the end of the data until more is written, and return io.EOF once done
+// is closed and everything is read.
+func Follow(ctx context.Context, path string, done <-chan struct{}) (io.ReadCloser, error) {
+	file, err := os.Open(path) //nolint:gosec // G304: path is the capture file of the recorder
+	if err != nil {
+		return nil, err
+	}
+	return &follower{ctx: ctx, file: file, done: done}, nil
+}
+
+func (f *follower) Read(p []byte) (int, error) {
+	for {
+		n, err := f.file.Read(p)
+		if n > 0 || !errors.Is(err, io.EOF) {
+			return n, err
+		}
+
+		select {
+		case <-f.done:
+			// Writing stopped; read what was written after the last read.
+			return f.file.Read(p)
+		default:
+		}
+		select {
+		case <-f.ctx.Done():
+			return 0, f.ctx.Err()
+		case <-f.done:
+		case <-time.After(constants.FollowPollInterval):
+		}
+	}
+}
+
+func (f *follower) Close() error {
+	return f.file.Close()
+}
+
+// Pacer limits writes to a constant byte rate after an initial burst, so a
+// constant-bitrate stream is sent in real time.
+type Pacer struct {
+	ctx     context.Context
+	w       io.Writer
+	flush   func()
+	rate    float64 // Bytes per second
+	burst   int64
+	start   time.Time
+	written int64
+}
+
+// NewPacer creates a pacer that writes to w at bitrateKbps after a burst of
+// constants.RestreamBurst. Flush, if not nil, is called after every write.
+func NewPacer(ctx context.Context, w io.Writer, flush func(), bitrateKbps int) *Pacer {
+	rate := float64(bitrateKbps) * 1000 / 8
+	return &Pacer{
+		ctx:   ctx,
+		w:     w,
+		flush: flush,
+		rate:  rate,
+		burst: int64(rate * constants.RestreamBurst.Seconds()),
+		start: time.Now(),
+	}
+}
+
+func (p *Pacer) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	if p.flush != nil {
+		p.flush()
+	}
+	if err != nil {
+		return n, err
+	}
+
+	due := time.Duration(float64(p.written-p.burst) / p.rate * float64(time.Second))
+	if wait := due - time.Since(p.start); wait > 0 {
+		select {
+		case <-p.ctx.Done():
+			return n, p.ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	return n, nil
+}
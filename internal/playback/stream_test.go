@@ -0,0 +1,87 @@
+package playback
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/archive"
+)
+
+func TestNextContinuesIntoLiveRecording(t *testing.T) {
+	dir := t.TempDir()
+	stationDir := filepath.Join(dir, "station")
+	if err := os.MkdirAll(stationDir, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"2026-04-30-10.mp3", "2026-04-30-11.mp3", "2026-04-30-12.mkv"} {
+		if err := os.WriteFile(filepath.Join(stationDir, name), []byte(name), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recordings, err := archive.Scan(dir, "station")
+	if err != nil {
+		t.Fatal(err)
+	}
+	durations := &Durations{
+		probe: func(context.Context, string) (float64, error) { return 3600, nil },
+		cache: make(map[string]cachedDuration),
+	}
+	done := make(chan struct{})
+	live := &Source{
+		Item: Item{Timestamp: "2026-04-30-12", Start: time.Date(2026, 4, 30, 12, 0, 0, 0, time.UTC), Path: filepath.Join(stationDir, "2026-04-30-12.mkv")},
+		Done: done,
+	}
+	ctx := context.Background()
+
+	pos := time.Date(2026, 4, 30, 10, 45, 0, 0, time.UTC)
+	source, ok, err := Next(ctx, durations, recordings, live, pos, time.Time{})
+	if err != nil || !ok || source.Timestamp != "2026-04-30-10" || source.Offset != 2700 {
+		t.Fatalf("Next(10:45) = %+v, %v, %v; want 2026-04-30-10 at 2700s", source, ok, err)
+	}
+	source, ok, err = Next(ctx, durations, recordings, live, source.Start, source.Start)
+	if err != nil || !ok || source.Timestamp != "2026-04-30-11" || source.Offset != 0 {
+		t.Fatalf("Next after 10:00 = %+v, %v, %v; want 2026-04-30-11 from the start", source, ok, err)
+	}
+	source, ok, err = Next(ctx, durations, recordings, live, source.Start, source.Start)
+	if err != nil || !ok || !source.Live() || source.Offset != 0 {
+		t.Fatalf("Next after 11:00 = %+v, %v, %v; want the live recording", source, ok, err)
+	}
+	if _, ok, _ := Next(ctx, durations, recordings, nil, source.Start, source.Start); ok {
+		t.Fatal("Next after 12:00 found a recording, want none until the next hour")
+	}
+}
+
+func TestFollowReadsUntilDone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "live.mkv")
+	if err := os.WriteFile(path, []byte("one"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	r, err := Follow(context.Background(), path, done)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = r.Close() }()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+		if err == nil {
+			_, _ = f.WriteString("two")
+			_ = f.Close()
+		}
+		close(done)
+	}()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "onetwo" {
+		t.Fatalf("read %q, want %q", data, "onetwo")
+	}
+}
@@ -0,0 +1,288 @@
+// Package proxy generates low-bitrate copies of finished recordings, which are
+// served instead of the full-quality file when listening back. Recordings wait
+// in a persistent queue, so a restart does not lose pending proxies.
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/archive"
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+	"github.com/oszuidwest/zwfm-audiologger/internal/recorder"
+	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
+)
+
+// Compile-time interface check.
+var _ recorder.FileObserver = (*Manager)(nil)
+
+// Job is a recording waiting for its proxy.
+type Job struct {
+	Station   string `json:"station"`
+	Timestamp string `json:"timestamp"`
+	Path      string `json:"path"`
+}
+
+// Status summarizes the proxy queue for the status endpoint.
+type Status struct {
+	Queued        int       `json:"queued"`
+	Generated     int64     `json:"generated"`
+	Failures      int64     `json:"failures"`
+	LastGenerated time.Time `json:"last_generated,omitzero"`
+	LastError     string    `json:"last_error,omitempty"`
+}
+
+// Manager generates proxies for finished recordings.
+type Manager struct {
+	config           *config.Config
+	profile          *config.TranscodeConfig
+	queuePath        string
+	wake             chan struct{}
+	transcodeCommand func(context.Context, string, string, *config.TranscodeConfig) *exec.Cmd
+	now              func() time.Time
+
+	mu     sync.Mutex
+	jobs   []Job
+	status Status
+}
+
+// New creates a proxy manager and loads any queue left by a previous run.
+func New(cfg *config.Config) (*Manager, error) {
+	if err := utils.EnsureDir(cfg.StateDir); err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		config:           cfg,
+		profile:          cfg.Proxy.Profile(),
+		queuePath:        filepath.Join(cfg.StateDir, constants.ProxyQueueFile),
+		wake:             make(chan struct{}, 1),
+		transcodeCommand: utils.TranscodeCommand,
+		now:              utils.Now,
+	}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	if len(m.jobs) > 0 {
+		slog.Info("Resuming proxy queue", "queued", len(m.jobs))
+	}
+	return m, nil
+}
+
+// Path returns the path of the proxy of a recording, or an empty string when
+// the recording has none.
+func Path(recording string) string {
+	stem, _ := archive.SplitName(filepath.Base(recording))
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(recording), stem+constants.ProxyFileSuffix+".*"))
+	for _, match := range matches {
+		if utils.IsAudioFile(match) {
+			return match
+		}
+	}
+	return ""
+}
+
+// load reads the persistent queue. A missing file means an empty queue.
+func (m *Manager) load() error {
+	data, err := os.ReadFile(m.queuePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read proxy queue: %w", err)
+	}
+	if err := json.Unmarshal(data, &m.jobs); err != nil {
+		return fmt.Errorf("failed to parse proxy queue %s: %w", m.queuePath, err)
+	}
+	return nil
+}
+
+// persist writes the queue to disk. The caller must hold m.mu.
+func (m *Manager) persist() {
+	data, err := json.MarshalIndent(m.jobs, "", "  ")
+	if err == nil {
+		err = utils.WriteFileAtomic(m.queuePath, data)
+	}
+	if err != nil {
+		slog.Error("failed to save proxy queue", "file", m.queuePath, "error", err)
+	}
+}
+
+// FileCompleted queues a finished recording for a proxy. Sidecars and the
+// originals kept next to transcoded recordings are ignored.
+func (m *Manager) FileCompleted(station, timestamp, path string) {
+	if !archive.IsAudio(path) {
+		return
+	}
+	m.enqueue(Job{Station: station, Timestamp: timestamp, Path: path})
+}
+
+// enqueue adds jobs that are not queued yet and wakes the worker.
+func (m *Manager) enqueue(jobs ...Job) {
+	m.mu.Lock()
+	for _, job := range jobs {
+		if !slices.ContainsFunc(m.jobs, func(j Job) bool { return j.Path == job.Path }) {
+			m.jobs = append(m.jobs, job)
+		}
+	}
+	m.persist()
+	m.mu.Unlock()
+
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Status returns a snapshot of the proxy queue for the status endpoint.
+func (m *Manager) Status() any {
+	return m.snapshot()
+}
+
+// snapshot returns the current proxy statistics.
+func (m *Manager) snapshot() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := m.status
+	status.Queued = len(m.jobs)
+	return status
+}
+
+// WriteMetrics writes the proxy metrics in Prometheus text format.
+func (m *Manager) WriteMetrics(w io.Writer) {
+	status := m.snapshot()
+	utils.WriteMetric(w, "audiologger_proxy_queue_length", "gauge", "Recordings waiting for a proxy.", float64(status.Queued))
+	utils.WriteMetric(w, "audiologger_proxies_total", "counter", "Proxies generated.", float64(status.Generated))
+	utils.WriteMetric(w, "audiologger_proxy_failures_total", "counter", "Failed proxy generations.", float64(status.Failures))
+}
+
+// Start queues recordings that have no proxy yet and processes the queue until
+// the context is cancelled.
+func (m *Manager) Start(ctx context.Context) error {
+	slog.Info("Proxy generation started", "codec", m.profile.Codec, "bitrate_kbps", m.profile.BitrateKbps)
+	m.scanMissing()
+
+	for {
+		if job, ok := m.next(); ok {
+			m.process(ctx, job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			slog.Info("Proxy generation shutting down")
+			return nil
+		case <-m.wake:
+		}
+	}
+}
+
+// scanMissing queues the finished recordings that have no proxy, skipping
+// those whose proxy would already be past proxy.keep_days.
+func (m *Manager) scanMissing() {
+	var cutoff time.Time
+	if days := m.config.Proxy.KeepDays; days > 0 {
+		cutoff = m.now().AddDate(0, 0, -days)
+	}
+
+	var jobs []Job
+	for station := range m.config.Stations {
+		recordings, err := archive.Scan(m.config.RecordingsDir, station)
+		if err != nil {
+			slog.Warn("failed to scan station directory", "station", station, "error", err)
+			continue
+		}
+		for _, rec := range recordings {
+			if rec.Audio == "" || rec.InProgress() || rec.Proxy() != "" || rec.Time.Before(cutoff) {
+				continue
+			}
+			jobs = append(jobs, Job{Station: station, Timestamp: rec.Timestamp, Path: rec.Audio})
+		}
+	}
+	if len(jobs) > 0 {
+		slog.Info("Queued recordings without a proxy", "count", len(jobs))
+		m.enqueue(jobs...)
+	}
+}
+
+// next returns the first queued job.
+func (m *Manager) next() (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.jobs) == 0 {
+		return Job{}, false
+	}
+	return m.jobs[0], true
+}
+
+// process generates the proxy of one job and removes it from the queue. A
+// failed job is not retried, since the recording itself is unaffected.
+func (m *Manager) process(ctx context.Context, job Job) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("panic in proxy generation", "file", job.Path, "panic", r, "stack", string(debug.Stack()))
+		}
+	}()
+
+	proxyPath, err := m.generate(ctx, job)
+	if ctx.Err() != nil {
+		return // Shutting down; the job stays queued.
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case err == nil:
+		slog.Info("Generated proxy", "file", job.Path, "proxy", proxyPath)
+		m.status.Generated++
+		m.status.LastGenerated = time.Now()
+	case os.IsNotExist(err):
+		slog.Warn("recording removed before its proxy was generated", "file", job.Path)
+	default:
+		slog.Error("failed to generate proxy", "file", job.Path, "error", err)
+		m.status.Failures++
+		m.status.LastError = err.Error()
+	}
+	m.jobs = slices.DeleteFunc(m.jobs, func(j Job) bool { return j.Path == job.Path })
+	m.persist()
+}
+
+// generate encodes the proxy to a hidden file and renames it into place, so a
+// partial proxy is never served.
+func (m *Manager) generate(ctx context.Context, job Job) (string, error) {
+	if _, err := os.Stat(job.Path); err != nil {
+		return "", err
+	}
+	dir := filepath.Dir(job.Path)
+	stem, _ := archive.SplitName(filepath.Base(job.Path))
+	name := stem + constants.ProxyFileSuffix + utils.ExtensionForCodec(m.profile.Codec)
+	proxyPath := filepath.Join(dir, name)
+	tempPath := filepath.Join(dir, "."+name)
+
+	cmd := m.transcodeCommand(ctx, job.Path, tempPath, m.profile)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		_ = os.Remove(tempPath)
+		outputStr := string(output)
+		if len(outputStr) > 500 {
+			outputStr = outputStr[:500] + "... (truncated)"
+		}
+		return "", fmt.Errorf("ffmpeg failed: %w: %s", err, outputStr)
+	}
+	if err := os.Rename(tempPath, proxyPath); err != nil {
+		_ = os.Remove(tempPath)
+		return "", err
+	}
+	return proxyPath, nil
+}
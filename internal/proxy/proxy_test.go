@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+)
+
+func TestStartGeneratesMissingAndNewProxies(t *testing.T) {
+	dir := t.TempDir()
+	stationDir := filepath.Join(dir, "station")
+	if err := os.MkdirAll(stationDir, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		"2026-04-30-20.mp3",          // Past keep_days: no proxy.
+		"2026-04-30-21.mp3",          // Has a proxy already.
+		"2026-04-30-21.proxy.opus",   //
+		"2026-04-30-22.mp3",          // Missing a proxy.
+		"2026-04-30-22.original.aac", // Original of a transcoded recording.
+	} {
+		if err := os.WriteFile(filepath.Join(stationDir, name), []byte(name), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := &config.Config{
+		RecordingsDir: dir,
+		StateDir:      filepath.Join(dir, ".audiologger"),
+		Stations:      map[string]config.Station{"station": {}},
+		Proxy:         &config.ProxyConfig{Enabled: true, Codec: "opus", KeepDays: 1},
+	}
+	m, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.now = func() time.Time { return time.Date(2026, 5, 1, 21, 30, 0, 0, time.UTC) }
+	var inputs []string
+	m.transcodeCommand = func(ctx context.Context, input, output string, _ *config.TranscodeConfig) *exec.Cmd {
+		inputs = append(inputs, filepath.Base(input))
+		return exec.CommandContext(ctx, "cp", input, output) //nolint:gosec // Paths are test-controlled temp files.
+	}
+
+	// A recording that finished before the start is queued once; an original is not.
+	recording := filepath.Join(stationDir, "2026-04-30-23.mp3")
+	if err := os.WriteFile(recording, []byte("new"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	m.FileCompleted("station", "2026-04-30-22", filepath.Join(stationDir, "2026-04-30-22.original.aac"))
+	m.FileCompleted("station", "2026-04-30-23", recording)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = m.Start(ctx)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for m.snapshot().Generated < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if got := Path(filepath.Join(stationDir, "2026-04-30-22.mp3")); got != filepath.Join(stationDir, "2026-04-30-22.proxy.opus") {
+		t.Errorf("proxy of missing recording = %q", got)
+	}
+	if got, want := Path(recording), filepath.Join(stationDir, "2026-04-30-23.proxy.opus"); got != want {
+		t.Errorf("proxy of new recording = %q, want %q", got, want)
+	}
+	slices.Sort(inputs)
+	if want := []string{"2026-04-30-22.mp3", "2026-04-30-23.mp3"}; !slices.Equal(inputs, want) {
+		t.Errorf("transcoded %q, want %q", inputs, want)
+	}
+	if status := m.snapshot(); status.Generated != 2 || status.Queued != 0 {
+		t.Errorf("status = %+v, want 2 generated and none queued", status)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"runtime/debug"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/oszuidwest/zwfm-audiologger/internal/config"
@@ -33,25 +34,104 @@ type Notifier interface {
 	NotifyRecordingFailure(station, reason string)
 }
 
+// FileObserver defines the interface for components that act on finished files,
+// such as uploaders. Implementations must return promptly; they must not wait
+// on the network.
+type FileObserver interface {
+	// FileCompleted is called once a recording or sidecar will not be written again.
+	FileCompleted(station, timestamp, path string)
+}
+
+// SpaceReclaimer defines the interface for freeing disk space on demand.
+type SpaceReclaimer interface {
+	// ReclaimSpace deletes old recordings until at least needed bytes are available.
+	ReclaimSpace(needed uint64) error
+}
+
+// Live is a recording in progress. Its capture file may be read while it is
+// written, to follow the broadcast with a delay.
+type Live struct {
+	Timestamp string
+	Start     time.Time // When capturing started, the time at the start of Path
+	Path      string    // The temporary capture file
+	done      chan struct{}
+}
+
+// Done is closed when the recorder stops writing to Path. The file is removed
+// shortly after, but stays readable through a file that is already open.
+func (l *Live) Done() <-chan struct{} {
+	return l.done
+}
+
 // Manager handles recording operations.
 type Manager struct {
-	config          *config.Config
-	metadataFetcher *metadata.Fetcher
-	validator       Validator
-	notifier        Notifier
-	recordCommand   func(context.Context, string, time.Duration, string) *exec.Cmd
-	availableBytes  func(string) (uint64, error)
+	config           *config.Config
+	metadataFetcher  *metadata.Fetcher
+	validator        Validator
+	notifier         Notifier
+	reclaimer        SpaceReclaimer
+	observers        []FileObserver
+	recordCommand    func(context.Context, string, time.Duration, string, *config.TranscodeConfig) *exec.Cmd
+	transcodeCommand func(context.Context, string, string, *config.TranscodeConfig) *exec.Cmd
+	availableBytes   func(string) (uint64, error)
+
+	liveMu sync.Mutex
+	live   map[string]*Live // Recording in progress by station
 }
 
 // New creates a new recording manager.
-func New(cfg *config.Config, validator Validator, notifier Notifier) *Manager {
+func New(cfg *config.Config, validator Validator, notifier Notifier, reclaimer SpaceReclaimer) *Manager {
 	return &Manager{
-		config:          cfg,
-		metadataFetcher: metadata.New(),
-		validator:       validator,
-		notifier:        notifier,
-		recordCommand:   utils.RecordCommand,
-		availableBytes:  utils.AvailableDiskBytes,
+		config:           cfg,
+		metadataFetcher:  metadata.New(),
+		validator:        validator,
+		notifier:         notifier,
+		reclaimer:        reclaimer,
+		recordCommand:    utils.RecordCommand,
+		transcodeCommand: utils.TranscodeCommand,
+		availableBytes:   utils.AvailableDiskBytes,
+		live:             make(map[string]*Live),
+	}
+}
+
+// Live returns the recording in progress of a station, or nil when the station
+// is not recording.
+func (m *Manager) Live(station string) *Live {
+	m.liveMu.Lock()
+	defer m.liveMu.Unlock()
+	return m.live[station]
+}
+
+// startLive registers the capture file of a station as its recording in progress.
+func (m *Manager) startLive(station, timestamp, path string) *Live {
+	live := &Live{Timestamp: timestamp, Start: utils.Now(), Path: path, done: make(chan struct{})}
+	m.liveMu.Lock()
+	m.live[station] = live
+	m.liveMu.Unlock()
+	return live
+}
+
+// endLive marks a recording in progress as finished. A newer recording of the
+// station that already started stays registered.
+func (m *Manager) endLive(station string, live *Live) {
+	m.liveMu.Lock()
+	if m.live[station] == live {
+		delete(m.live, station)
+	}
+	m.liveMu.Unlock()
+	close(live.done)
+}
+
+// AddObserver registers an observer for recordings and sidecars the recorder
+// finishes. It must be called before recording starts.
+func (m *Manager) AddObserver(o FileObserver) {
+	m.observers = append(m.observers, o)
+}
+
+// notifyCompleted informs all observers that a file is finished.
+func (m *Manager) notifyCompleted(station, timestamp, path string) {
+	for _, o := range m.observers {
+		o.FileCompleted(station, timestamp, path)
 	}
 }
 
@@ -119,7 +199,9 @@ func (m *Manager) record(ctx context.Context, opts recordOptions) {
 	timeout := opts.timeout
 	skipValidation := opts.skipValidation
 
-	dir := filepath.Join(m.config.RecordingsDir, name)
+	// Use .mkv extension for temporary files - supports any audio codec
+	tempFile := utils.RecordingPath(m.config.RecordingsDir, name, timestamp, ".mkv")
+	dir := filepath.Dir(tempFile)
 	if err := utils.EnsureDir(dir); err != nil {
 		reason := fmt.Sprintf("failed to create recording directory: %v", err)
 		slog.Error("skipping recording",
@@ -135,17 +217,7 @@ func (m *Manager) record(ctx context.Context, opts recordOptions) {
 	}
 
 	// Refuse to record if available disk space is below the minimum threshold.
-	available, err := m.availableBytes(dir)
-	if err != nil {
-		reason := fmt.Sprintf("disk space check failed: %v", err)
-		slog.Error("skipping recording", "station", name, "reason", reason)
-		if m.notifier != nil {
-			m.notifier.NotifyRecordingFailure(name, reason)
-		}
-		return
-	}
-	if available < constants.MinDiskSpaceBytes {
-		reason := fmt.Sprintf("insufficient disk space: %d bytes available, %d required", available, constants.MinDiskSpaceBytes)
+	if reason := m.checkDiskSpace(dir); reason != "" {
 		slog.Error("skipping recording", "station", name, "reason", reason)
 		if m.notifier != nil {
 			m.notifier.NotifyRecordingFailure(name, reason)
@@ -153,30 +225,42 @@ func (m *Manager) record(ctx context.Context, opts recordOptions) {
 		return
 	}
 
-	// Use .mkv extension for temporary files - supports any audio codec
-	tempFile := utils.RecordingPath(m.config.RecordingsDir, name, timestamp, ".mkv")
-
 	slog.Info("Recording started", "station", name, "file", tempFile)
 
 	// Bound recording to both the requested duration timeout and caller cancellation.
 	recordCtx, recordCancel := context.WithTimeout(ctx, timeout)
 	defer recordCancel()
 
-	cmd := m.recordCommand(recordCtx, station.StreamURL, duration, tempFile)
+	// A live archive profile encodes while recording; otherwise the stream is
+	// copied and a post profile is applied once the recording is finished.
+	var liveTranscode, postTranscode *config.TranscodeConfig
+	if station.Transcode.Live() {
+		liveTranscode = station.Transcode
+	} else {
+		postTranscode = station.Transcode
+	}
+
+	cmd := m.recordCommand(recordCtx, station.StreamURL, duration, tempFile, liveTranscode)
 	slog.Debug("FFmpeg args", "args", cmd.Args)
 
 	// Capture both stdout and stderr
+	live := m.startLive(name, timestamp, tempFile)
 	output, err := cmd.CombinedOutput()
 	recordCancel() // Explicitly cancel context after FFmpeg completes
+	m.endLive(name, live)
 
 	if err != nil {
 		m.handleRecordingFailure(ctx, name, station, tempFile, cmd.Args, output, err)
 		return
 	}
 
-	// Detect format from the recorded file and remux to proper container
+	// Detect format from the recorded file and remux to proper container. With
+	// a post profile the remuxed file is the original, transcoded below.
 	format := utils.Format(tempFile)
 	finalFile := utils.RecordingPath(m.config.RecordingsDir, name, timestamp, format)
+	if postTranscode != nil {
+		finalFile = utils.RecordingPath(m.config.RecordingsDir, name, timestamp, constants.OriginalFileSuffix+format)
+	}
 
 	// Remux the .mkv file to proper container format
 	remuxCmd := utils.RemuxCommand(tempFile, finalFile)
@@ -211,7 +295,13 @@ func (m *Manager) record(ctx context.Context, opts recordOptions) {
 		slog.Warn("failed to remove temporary file", "file", tempFile, "error", err)
 	}
 
+	if postTranscode != nil {
+		finalFile = m.transcode(name, timestamp, finalFile, postTranscode)
+		format = filepath.Ext(finalFile)
+	}
+
 	slog.Info("Recording completed", "file", finalFile, "format", format)
+	m.notifyCompleted(name, timestamp, finalFile)
 
 	// For full recordings, enqueue for validation. For catchup recordings, write a
 	// sidecar immediately so scanUnvalidated does not re-queue the file on restart.
@@ -224,6 +314,77 @@ func (m *Manager) record(ctx context.Context, opts recordOptions) {
 	}
 }
 
+// transcode encodes a remuxed recording with the station's archive profile and
+// returns the path of the recording to keep. The original stays next to it
+// for keep_original_days, or is removed at once. When transcoding fails the
+// original becomes the recording, so the hour is not lost.
+func (m *Manager) transcode(name, timestamp, original string, profile *config.TranscodeConfig) string {
+	output := utils.RecordingPath(m.config.RecordingsDir, name, timestamp, utils.ExtensionForCodec(profile.Codec))
+
+	// Like the remux, transcoding finishes even during shutdown.
+	cmd := m.transcodeCommand(context.Background(), original, output, profile)
+	slog.Debug("FFmpeg args", "args", cmd.Args)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		outputStr := string(out)
+		if len(outputStr) > 500 {
+			outputStr = outputStr[:500] + "... (truncated)"
+		}
+		slog.Error("failed to transcode recording, keeping the original",
+			"station", name,
+			"file", original,
+			"error", err,
+			"ffmpeg_output", outputStr,
+		)
+		if m.notifier != nil {
+			m.notifier.NotifyRecordingFailure(name, fmt.Sprintf("transcode failed: %v", err))
+		}
+		if err := os.Remove(output); err != nil && !os.IsNotExist(err) {
+			slog.Warn("failed to clean up output after transcode error", "file", output, "error", err)
+		}
+
+		fallback := utils.RecordingPath(m.config.RecordingsDir, name, timestamp, filepath.Ext(original))
+		if err := os.Rename(original, fallback); err != nil {
+			slog.Error("failed to rename original recording", "file", original, "error", err)
+			return original
+		}
+		return fallback
+	}
+
+	if profile.KeepOriginalDays > 0 {
+		m.notifyCompleted(name, timestamp, original)
+	} else if err := os.Remove(original); err != nil {
+		slog.Warn("failed to remove original recording", "file", original, "error", err)
+	}
+	return output
+}
+
+// checkDiskSpace returns a failure reason when there is not enough disk space to
+// start a recording, after asking the reclaimer to free space. It returns an
+// empty string when recording may proceed.
+func (m *Manager) checkDiskSpace(dir string) string {
+	available, err := m.availableBytes(dir)
+	if err != nil {
+		return fmt.Sprintf("disk space check failed: %v", err)
+	}
+	if available >= constants.MinDiskSpaceBytes {
+		return ""
+	}
+
+	if m.reclaimer != nil {
+		if err := m.reclaimer.ReclaimSpace(constants.MinDiskSpaceBytes); err != nil {
+			slog.Warn("failed to reclaim disk space", "dir", dir, "error", err)
+		}
+		if available, err = m.availableBytes(dir); err != nil {
+			return fmt.Sprintf("disk space check failed: %v", err)
+		}
+		if available >= constants.MinDiskSpaceBytes {
+			return ""
+		}
+	}
+
+	return fmt.Sprintf("insufficient disk space: %d bytes available, %d required", available, constants.MinDiskSpaceBytes)
+}
+
 func (m *Manager) handleRecordingFailure(
 	ctx context.Context,
 	name string,
@@ -290,11 +451,12 @@ func (m *Manager) saveMetadata(ctx context.Context, stationName string, station
 	)
 
 	if meta != "" {
-		metaFile := utils.RecordingPath(m.config.RecordingsDir, stationName, timestamp, ".meta")
+		metaFile := utils.RecordingPath(m.config.RecordingsDir, stationName, timestamp, constants.MetadataFileSuffix)
 		if err := os.WriteFile(metaFile, []byte(meta), constants.FilePermissions); err != nil {
 			slog.Error("failed to save metadata", "station", stationName, "file", metaFile, "error", err)
 		} else {
 			slog.Info("Saved metadata", "station", stationName, "metadata", meta)
+			m.notifyCompleted(stationName, timestamp, metaFile)
 		}
 	}
 }
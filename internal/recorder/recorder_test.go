@@ -48,8 +48,8 @@ func TestScheduledAndCatchupDoNotNotifyOnParentContextCancellation(t *testing.T)
 		t.Run(tt.name, func(t *testing.T) {
 			recordingsDir := t.TempDir()
 			notifier := &recordingFailureNotifier{}
-			manager := New(&config.Config{RecordingsDir: recordingsDir}, nil, notifier)
-			manager.recordCommand = func(ctx context.Context, _ string, _ time.Duration, outputFile string) *exec.Cmd {
+			manager := New(&config.Config{RecordingsDir: recordingsDir}, nil, notifier, nil)
+			manager.recordCommand = func(ctx context.Context, _ string, _ time.Duration, outputFile string, _ *config.TranscodeConfig) *exec.Cmd {
 				cmd := exec.CommandContext(ctx, os.Args[0], "-test.run=TestRecorderHelperProcess", "--", outputFile) //nolint:gosec // Test helper process and temp output path are controlled by this test.
 				cmd.Env = append(os.Environ(), "GO_WANT_RECORDER_HELPER_PROCESS=1")
 				return cmd
@@ -125,3 +125,56 @@ func TestRecorderHelperProcess(t *testing.T) {
 
 	time.Sleep(24 * time.Hour)
 }
+
+func TestTranscodeKeepsOriginalOrFallsBack(t *testing.T) {
+	tests := []struct {
+		name             string
+		fail             bool
+		keepOriginalDays int
+		wantFile         string
+		wantOriginal     bool
+		wantNotified     int32
+	}{
+		{name: "remove original", wantFile: "2026-04-30-22.opus"},
+		{name: "keep original", keepOriginalDays: 7, wantFile: "2026-04-30-22.opus", wantOriginal: true},
+		{name: "failure keeps recording", fail: true, wantFile: "2026-04-30-22.mp3", wantNotified: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recordingsDir := t.TempDir()
+			notifier := &recordingFailureNotifier{}
+			manager := New(&config.Config{RecordingsDir: recordingsDir}, nil, notifier, nil)
+			manager.transcodeCommand = func(_ context.Context, input, output string, _ *config.TranscodeConfig) *exec.Cmd {
+				if tt.fail {
+					return exec.Command("false")
+				}
+				return exec.Command("cp", input, output) //nolint:gosec // Paths are test-controlled temp files.
+			}
+
+			original := utils.RecordingPath(recordingsDir, "station", "2026-04-30-22", ".original.mp3")
+			if err := os.MkdirAll(filepath.Dir(original), 0o750); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(original, []byte("audio"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			profile := &config.TranscodeConfig{Codec: "opus", KeepOriginalDays: tt.keepOriginalDays}
+			got := manager.transcode("station", "2026-04-30-22", original, profile)
+
+			if want := filepath.Join(recordingsDir, "station", tt.wantFile); got != want {
+				t.Errorf("transcode = %q, want %q", got, want)
+			}
+			if _, err := os.Stat(got); err != nil {
+				t.Errorf("recording missing: %v", err)
+			}
+			if _, err := os.Stat(original); (err == nil) != tt.wantOriginal {
+				t.Errorf("original exists = %v, want %v", err == nil, tt.wantOriginal)
+			}
+			if n := notifier.calls.Load(); n != tt.wantNotified {
+				t.Errorf("NotifyRecordingFailure calls = %d, want %d", n, tt.wantNotified)
+			}
+		})
+	}
+}
@@ -0,0 +1,466 @@
+// Package retention removes recordings whose retention period has passed, or
+// the oldest recordings when the archive exceeds its size quota.
+package retention
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/archive"
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+	"github.com/oszuidwest/zwfm-audiologger/internal/tier"
+	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
+	"github.com/oszuidwest/zwfm-audiologger/internal/validator"
+)
+
+// Report summarizes what a cleanup run deleted.
+type Report struct {
+	DeletedRecordings int      `json:"deleted_recordings"`
+	DeletedSidecars   int      `json:"deleted_orphaned_sidecars"`
+	DeletedOriginals  int      `json:"deleted_originals"`
+	DeletedProxies    int      `json:"deleted_proxies"`
+	HeldRecordings    int      `json:"held_recordings"`
+	FreedBytes        int64    `json:"freed_bytes"`
+	Errors            int      `json:"errors"`
+	Deleted           []string `json:"deleted,omitempty"`
+}
+
+// RemovalObserver is notified of every file that retention deletes. Paths in
+// the recordings directory are absolute; paths in the archive tier are relative
+// to the tier root.
+type RemovalObserver interface {
+	FileRemoved(path string)
+}
+
+// store is a location holding recordings. The same age-based policy applies to
+// the recordings directory and the archive tier.
+type store struct {
+	list   func(station string) ([]archive.Recording, error)
+	read   func(path string) ([]byte, error)
+	remove func(path string) error
+}
+
+// Cleaner applies the retention policy to the recordings directory and, when
+// configured, the archive tier.
+type Cleaner struct {
+	config         *config.Config // Guarded by mu.
+	pending        atomic.Pointer[config.Config]
+	tier           tier.Tier
+	mu             sync.Mutex // Serializes the daily run and just-in-time reclaims.
+	now            func() time.Time
+	availableBytes func(string) (uint64, error)
+	observers      []RemovalObserver
+}
+
+// New creates a new cleaner. The archive tier may be nil.
+func New(cfg *config.Config, archiveTier tier.Tier) *Cleaner {
+	return &Cleaner{
+		config:         cfg,
+		tier:           archiveTier,
+		now:            utils.Now,
+		availableBytes: utils.AvailableDiskBytes,
+	}
+}
+
+// Reload applies a new configuration from the next run or reclaim on, so a run
+// in progress finishes with the settings it started with.
+func (c *Cleaner) Reload(cfg *config.Config) {
+	c.pending.Store(cfg)
+}
+
+// lock takes mu and applies a configuration passed to Reload.
+func (c *Cleaner) lock() {
+	c.mu.Lock()
+	if cfg := c.pending.Swap(nil); cfg != nil {
+		c.config = cfg
+	}
+}
+
+// primary returns the store for the recordings directory.
+func (c *Cleaner) primary() store {
+	return store{
+		list: func(station string) ([]archive.Recording, error) {
+			return archive.Scan(c.config.RecordingsDir, station)
+		},
+		read: os.ReadFile,
+		remove: c.notifying(func(path string) error {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			utils.RemoveEmptyDirs(c.config.RecordingsDir, path)
+			return nil
+		}),
+	}
+}
+
+// secondary returns the store for the archive tier.
+func (c *Cleaner) secondary(ctx context.Context) store {
+	return store{
+		list: func(station string) ([]archive.Recording, error) {
+			files, err := c.tier.List(ctx, station)
+			if err != nil {
+				return nil, err
+			}
+			return archive.Group(station, files), nil
+		},
+		read:   func(path string) ([]byte, error) { return c.tier.ReadFile(ctx, path) },
+		remove: c.notifying(func(path string) error { return c.tier.Remove(ctx, path) }),
+	}
+}
+
+// AddObserver registers an observer for deleted files. It must be called
+// before the cleaner is used.
+func (c *Cleaner) AddObserver(o RemovalObserver) {
+	c.observers = append(c.observers, o)
+}
+
+// notifying wraps a remove function so observers learn about successful deletions.
+func (c *Cleaner) notifying(remove func(string) error) func(string) error {
+	return func(path string) error {
+		if err := remove(path); err != nil {
+			return err
+		}
+		for _, o := range c.observers {
+			o.FileRemoved(path)
+		}
+		return nil
+	}
+}
+
+// Run deletes expired recordings and orphaned sidecars for all stations.
+// The age of a recording is taken from its file name, so touching or copying
+// files does not extend or shorten retention. Recordings that failed validation
+// are kept for keep_invalid_days and recordings with a .hold marker are never
+// deleted. When a quota is enabled it replaces keep_days for the recordings
+// directory; the archive tier always follows keep_days.
+func (c *Cleaner) Run(ctx context.Context) Report {
+	c.lock()
+	defer c.mu.Unlock()
+
+	var report Report
+	now := c.now()
+	kept := c.scan(&report, c.primary(), now, !c.quotaEnabled(), true)
+
+	if c.quotaEnabled() {
+		c.enforceQuota(&report, kept, now)
+	}
+	if c.tier != nil {
+		c.scan(&report, c.secondary(ctx), now, true, true)
+	}
+
+	slog.Info("Cleanup finished",
+		"deleted_recordings", report.DeletedRecordings,
+		"deleted_orphaned_sidecars", report.DeletedSidecars,
+		"deleted_originals", report.DeletedOriginals,
+		"deleted_proxies", report.DeletedProxies,
+		"held_recordings", report.HeldRecordings,
+		"freed_bytes", report.FreedBytes,
+		"errors", report.Errors)
+
+	return report
+}
+
+// ReclaimSpace deletes the oldest recordings outside their minimum retention
+// until at least needed bytes are available. It does nothing unless a quota
+// is enabled, because deleting recordings early is only allowed in quota mode.
+func (c *Cleaner) ReclaimSpace(needed uint64) error {
+	c.lock()
+	defer c.mu.Unlock()
+	if !c.quotaEnabled() {
+		return nil
+	}
+
+	var report Report
+	now := c.now()
+	kept := c.scan(&report, c.primary(), now, false, false)
+	c.freeSpace(&report, c.eligible(kept, now), needed)
+
+	if report.DeletedRecordings > 0 {
+		slog.Info("Reclaimed disk space for recording",
+			"deleted_recordings", report.DeletedRecordings,
+			"freed_bytes", report.FreedBytes)
+	}
+
+	available, err := c.availableBytes(c.config.RecordingsDir)
+	if err != nil {
+		return err
+	}
+	if available < needed {
+		return fmt.Errorf("only %d bytes available after deleting all eligible recordings", available)
+	}
+	return nil
+}
+
+func (c *Cleaner) quotaEnabled() bool {
+	return c.config.Quota != nil && c.config.Quota.Enabled
+}
+
+// scan lists the recordings of all stations in a store. With prune set it
+// deletes orphaned sidecars, originals and proxies past their retention on the way,
+// and with ageBased also recordings past keep_days. It returns the recordings
+// that remain.
+func (c *Cleaner) scan(report *Report, st store, now time.Time, ageBased, prune bool) []*archive.Recording {
+	var kept []*archive.Recording
+
+	for station := range c.config.Stations {
+		keepDays, keepInvalidDays := c.config.StationKeepDays(station)
+		cutoff := now.AddDate(0, 0, -keepDays)
+		invalidCutoff := now.AddDate(0, 0, -keepInvalidDays)
+		orphanCutoff := now.Add(-constants.OrphanSidecarGracePeriod)
+
+		if prune && ageBased {
+			slog.Info("Cleaning up old recordings",
+				"station", station,
+				"cutoff_date", cutoff.Format(time.DateOnly),
+				"invalid_cutoff_date", invalidCutoff.Format(time.DateOnly))
+		}
+
+		recordings, err := st.list(station)
+		if err != nil {
+			slog.Error("failed to list station recordings", "station", station, "error", err)
+			report.Errors++
+			continue
+		}
+
+		for i := range recordings {
+			rec := &recordings[i]
+			switch {
+			case !prune:
+				kept = append(kept, rec)
+			case rec.File(constants.HoldFileSuffix) != "":
+				if ageBased && rec.Time.Before(cutoff) {
+					slog.Info("Keeping recording under legal hold", "station", station, "timestamp", rec.Timestamp)
+					report.HeldRecordings++
+				}
+				kept = append(kept, rec)
+			case ageBased && rec.Time.Before(cutoff) && (rec.Time.Before(invalidCutoff) || isValid(st, rec)):
+				remove(report, st, rec)
+				report.DeletedRecordings++
+			case rec.Audio == "" && !rec.InProgress() && rec.Time.Before(orphanCutoff):
+				remove(report, st, rec)
+				report.DeletedSidecars += len(rec.Files)
+			default:
+				c.removeVariants(report, st, rec, now)
+				kept = append(kept, rec)
+			}
+		}
+	}
+
+	return kept
+}
+
+// removeVariants deletes the original kept next to a transcoded recording
+// after the station's keep_original_days, and the proxy after proxy.keep_days.
+// Originals and proxies left by settings that were turned off are removed as
+// well, since nothing else would.
+func (c *Cleaner) removeVariants(report *Report, st store, rec *archive.Recording, now time.Time) {
+	if original := rec.Original(); original != "" {
+		var keepDays int
+		if t := c.config.Stations[rec.Station].Transcode; t != nil {
+			keepDays = t.KeepOriginalDays
+		}
+		if removeExpired(report, st, rec, original, keepDays, now) {
+			report.DeletedOriginals++
+		}
+	}
+
+	if proxy := rec.Proxy(); proxy != "" {
+		var keepDays int
+		if p := c.config.Proxy; p != nil && p.Enabled {
+			if p.KeepDays == 0 {
+				return // Kept as long as the recording.
+			}
+			keepDays = p.KeepDays
+		}
+		if removeExpired(report, st, rec, proxy, keepDays, now) {
+			report.DeletedProxies++
+		}
+	}
+}
+
+// removeExpired deletes one file of a recording once the recording is older
+// than keepDays, and reports whether it did.
+func removeExpired(report *Report, st store, rec *archive.Recording, path string, keepDays int, now time.Time) bool {
+	// The grace period covers a recording that is still being transcoded.
+	cutoff := now.AddDate(0, 0, -keepDays)
+	if grace := now.Add(-constants.OrphanSidecarGracePeriod); grace.Before(cutoff) {
+		cutoff = grace
+	}
+	if !rec.Time.Before(cutoff) {
+		return false
+	}
+
+	if err := st.remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Error("failed to delete file past its retention", "path", path, "error", err)
+		report.Errors++
+		return false
+	}
+	slog.Info("Deleted file past its retention", "path", path)
+	report.Deleted = append(report.Deleted, path)
+	rec.Files = slices.DeleteFunc(rec.Files, func(f string) bool { return f == path })
+	return true
+}
+
+// eligible returns the recordings that quota enforcement may delete, oldest first.
+// Held and in-progress recordings, recordings within the station's minimum
+// retention and failed recordings within keep_invalid_days are excluded.
+func (c *Cleaner) eligible(recordings []*archive.Recording, now time.Time) []*archive.Recording {
+	var result []*archive.Recording
+	st := c.primary()
+	for _, rec := range recordings {
+		if rec.Audio == "" || rec.InProgress() || rec.File(constants.HoldFileSuffix) != "" {
+			continue
+		}
+		_, minKeepDays := c.config.StationQuota(rec.Station)
+		if !rec.Time.Before(now.AddDate(0, 0, -minKeepDays)) {
+			continue
+		}
+		if days := c.invalidKeepDays(rec.Station); days > 0 &&
+			!rec.Time.Before(now.AddDate(0, 0, -days)) && !isValid(st, rec) {
+			continue
+		}
+		result = append(result, rec)
+	}
+	slices.SortFunc(result, func(a, b *archive.Recording) int {
+		return cmp.Or(a.Time.Compare(b.Time), cmp.Compare(a.Station, b.Station))
+	})
+	return result
+}
+
+// invalidKeepDays returns the configured keep_invalid_days for a station, or zero.
+func (c *Cleaner) invalidKeepDays(station string) int {
+	if s, ok := c.config.Stations[station]; ok && s.KeepInvalidDays > 0 {
+		return s.KeepInvalidDays
+	}
+	return c.config.KeepInvalidDays
+}
+
+// enforceQuota deletes the oldest eligible recordings until every station is
+// within its own quota, the archive is within the global quota and the free
+// space target is met.
+func (c *Cleaner) enforceQuota(report *Report, kept []*archive.Recording, now time.Time) {
+	usage := make(map[string]int64)
+	var total int64
+	for _, rec := range kept {
+		usage[rec.Station] += rec.Size
+		total += rec.Size
+	}
+
+	candidates := c.eligible(kept, now)
+	deleted := make(map[*archive.Recording]bool)
+
+	for station := range c.config.Stations {
+		maxBytes, _ := c.config.StationQuota(station)
+		if maxBytes == 0 {
+			continue
+		}
+		for _, rec := range candidates {
+			if uint64(usage[station]) <= maxBytes { //nolint:gosec // Usage is a sum of non-negative file sizes.
+				break
+			}
+			if rec.Station != station {
+				continue
+			}
+			c.deleteForQuota(report, rec, "station quota exceeded")
+			deleted[rec] = true
+			usage[station] -= rec.Size
+			total -= rec.Size
+		}
+		if uint64(usage[station]) > maxBytes { //nolint:gosec // Usage is a sum of non-negative file sizes.
+			slog.Warn("station quota cannot be met without deleting protected recordings",
+				"station", station, "usage_bytes", usage[station], "max_bytes", maxBytes)
+		}
+	}
+
+	remaining := slices.DeleteFunc(candidates, func(rec *archive.Recording) bool { return deleted[rec] })
+
+	if maxBytes := c.config.Quota.MaxArchiveBytes; maxBytes > 0 {
+		for len(remaining) > 0 && uint64(total) > maxBytes { //nolint:gosec // Total is a sum of non-negative file sizes.
+			rec := remaining[0]
+			remaining = remaining[1:]
+			c.deleteForQuota(report, rec, "archive quota exceeded")
+			total -= rec.Size
+		}
+		if uint64(total) > maxBytes { //nolint:gosec // Total is a sum of non-negative file sizes.
+			slog.Warn("archive quota cannot be met without deleting protected recordings",
+				"usage_bytes", total, "max_bytes", maxBytes)
+		}
+	}
+
+	if minFree := c.config.Quota.MinFreeBytes; minFree > 0 {
+		c.freeSpace(report, remaining, minFree)
+	}
+}
+
+// freeSpace deletes recordings from candidates, oldest first, until at least
+// needed bytes are available on the recordings filesystem.
+func (c *Cleaner) freeSpace(report *Report, candidates []*archive.Recording, needed uint64) {
+	for _, rec := range candidates {
+		available, err := c.availableBytes(c.config.RecordingsDir)
+		if err != nil {
+			slog.Error("disk space check failed during cleanup", "error", err)
+			report.Errors++
+			return
+		}
+		if available >= needed {
+			return
+		}
+		c.deleteForQuota(report, rec, "free space below target")
+	}
+}
+
+// deleteForQuota removes a recording with all its sidecars from the recordings directory.
+func (c *Cleaner) deleteForQuota(report *Report, rec *archive.Recording, reason string) {
+	slog.Info("Deleting recording to enforce quota",
+		"station", rec.Station, "timestamp", rec.Timestamp, "reason", reason)
+	remove(report, c.primary(), rec)
+	report.DeletedRecordings++
+}
+
+// isValid reports whether a recording passed validation. Recordings without a
+// readable validation sidecar count as valid, so they follow keep_days.
+func isValid(st store, rec *archive.Recording) bool {
+	path := rec.File(constants.ValidationFileSuffix)
+	if path == "" {
+		return true
+	}
+	data, err := st.read(path)
+	if err == nil {
+		var result *validator.ValidationResult
+		if result, err = validator.ParseResult(data); err == nil {
+			return result.Valid
+		}
+	}
+	slog.Warn("failed to read validation result during cleanup", "file", path, "error", err)
+	return true
+}
+
+// remove deletes all files of a recording and records the outcome in the report.
+func remove(report *Report, st store, rec *archive.Recording) {
+	failed := false
+	for _, path := range rec.Files {
+		if err := st.remove(path); err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				slog.Error("failed to delete old recording", "path", path, "error", err)
+				report.Errors++
+				failed = true
+			}
+			continue
+		}
+		slog.Info("Deleted old recording", "path", path)
+		report.Deleted = append(report.Deleted, path)
+	}
+	if !failed {
+		report.FreedBytes += rec.Size
+	}
+}
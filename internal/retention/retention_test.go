@@ -0,0 +1,262 @@
+package retention
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+	"github.com/oszuidwest/zwfm-audiologger/internal/tier"
+)
+
+func TestRunAppliesRetentionPolicy(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 5, 31, 12, 30, 0, 0, time.UTC)
+
+	cfg := &config.Config{
+		RecordingsDir:   dir,
+		KeepDays:        10,
+		KeepInvalidDays: 30,
+		Stations: map[string]config.Station{
+			"short": {KeepDays: 2},
+			"long":  {},
+			"small": {Transcode: &config.TranscodeConfig{Codec: "opus", KeepOriginalDays: 3}},
+		},
+		Proxy: &config.ProxyConfig{Enabled: true, KeepDays: 4},
+	}
+
+	files := map[string]bool{
+		// Within keep_days: kept even though the file looks ancient.
+		"long/2026-05-25-10.mp3": true,
+		// Past keep_days and valid: deleted together with its sidecars.
+		"long/2026-05-15-10.mp3":             false,
+		"long/2026-05-15-10.meta":            false,
+		"long/2026-05-15-10.validation.json": false,
+		// Past keep_days but invalid: kept for keep_invalid_days.
+		"long/2026-05-15-11.mp3":             true,
+		"long/2026-05-15-11.validation.json": true,
+		// Past keep_invalid_days: deleted.
+		"long/2026-04-20-11.mp3":             false,
+		"long/2026-04-20-11.validation.json": false,
+		// Under legal hold: never deleted.
+		"long/2026-04-01-09.mp3":  true,
+		"long/2026-04-01-09.hold": true,
+		// Orphaned sidecar without audio: deleted.
+		"long/2026-05-30-08.meta": false,
+		// Sidecar of the recording in progress: kept.
+		"long/2026-05-31-12.meta": true,
+		"long/2026-05-31-12.mkv":  true,
+		// Station override of keep_days.
+		"short/2026-05-28-10.mp3": false,
+		"short/2026-05-30-10.mp3": true,
+		// Originals of transcoded recordings follow keep_original_days.
+		"small/2026-05-27-10.opus":         true,
+		"small/2026-05-27-10.original.mp3": false,
+		"small/2026-05-30-10.opus":         true,
+		"small/2026-05-30-10.original.mp3": true,
+		// Proxies follow proxy.keep_days.
+		"long/2026-05-25-10.proxy.opus":  false,
+		"small/2026-05-30-10.proxy.opus": true,
+	}
+
+	for name := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		content := "audio"
+		if filepath.Ext(name) == ".json" {
+			content = `{"valid": true}`
+			if name == "long/2026-05-15-11.validation.json" || name == "long/2026-04-20-11.validation.json" {
+				content = `{"valid": false}`
+			}
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		// Modification times must not influence retention.
+		if err := os.Chtimes(path, now.AddDate(-1, 0, 0), now.AddDate(-1, 0, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cleaner := New(cfg, nil)
+	cleaner.now = func() time.Time { return now }
+	report := cleaner.Run(context.Background())
+
+	for name, wantKept := range files {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if kept := err == nil; kept != wantKept {
+			t.Errorf("%s kept = %v, want %v", name, kept, wantKept)
+		}
+	}
+
+	if report.DeletedRecordings != 3 {
+		t.Errorf("DeletedRecordings = %d, want 3", report.DeletedRecordings)
+	}
+	if report.DeletedSidecars != 1 {
+		t.Errorf("DeletedSidecars = %d, want 1", report.DeletedSidecars)
+	}
+	if report.HeldRecordings != 1 {
+		t.Errorf("HeldRecordings = %d, want 1", report.HeldRecordings)
+	}
+	if report.DeletedOriginals != 1 {
+		t.Errorf("DeletedOriginals = %d, want 1", report.DeletedOriginals)
+	}
+	if report.DeletedProxies != 1 {
+		t.Errorf("DeletedProxies = %d, want 1", report.DeletedProxies)
+	}
+	if len(report.Deleted) != 9 {
+		t.Errorf("len(Deleted) = %d, want 9", len(report.Deleted))
+	}
+}
+
+func TestRunEnforcesQuotaOldestFirst(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 5, 31, 12, 30, 0, 0, time.UTC)
+
+	cfg := &config.Config{
+		RecordingsDir: dir,
+		KeepDays:      1, // Ignored in quota mode.
+		Quota:         &config.QuotaConfig{Enabled: true, MaxArchiveBytes: 40, MinKeepDays: 2},
+		Stations: map[string]config.Station{
+			"a": {MaxArchiveBytes: 15},
+			"b": {},
+		},
+	}
+
+	// Every recording is 10 bytes.
+	files := map[string]bool{
+		// Station a is over its own quota: its oldest recording goes first.
+		"a/2026-05-20-10.mp3": false,
+		"a/2026-05-25-10.mp3": true,
+		// The global quota then removes the oldest remaining recording.
+		"b/2026-05-21-10.mp3": false,
+		"b/2026-05-22-10.mp3": true,
+		// Within min_keep_days: protected even though the archive is full.
+		"b/2026-05-30-10.mp3": true,
+		// Under legal hold: protected.
+		"b/2026-05-01-10.mp3":  true,
+		"b/2026-05-01-10.hold": true,
+	}
+	for name := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		content := "0123456789"
+		if filepath.Ext(name) == ".hold" {
+			content = ""
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cleaner := New(cfg, nil)
+	cleaner.now = func() time.Time { return now }
+	cleaner.availableBytes = func(string) (uint64, error) { return 1 << 40, nil }
+	report := cleaner.Run(context.Background())
+
+	for name, wantKept := range files {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if kept := err == nil; kept != wantKept {
+			t.Errorf("%s kept = %v, want %v", name, kept, wantKept)
+		}
+	}
+	if report.DeletedRecordings != 2 {
+		t.Errorf("DeletedRecordings = %d, want 2", report.DeletedRecordings)
+	}
+}
+
+func TestReclaimSpaceDeletesUntilEnoughIsAvailable(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 5, 31, 12, 30, 0, 0, time.UTC)
+
+	cfg := &config.Config{
+		RecordingsDir: dir,
+		Quota:         &config.QuotaConfig{Enabled: true},
+		Stations:      map[string]config.Station{"a": {}},
+	}
+	names := []string{"a/2026-05-20-10.mp3", "a/2026-05-21-10.mp3", "a/2026-05-22-10.mp3"}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("0123456789"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Simulate a filesystem where each deleted recording frees 10 bytes.
+	cleaner := New(cfg, nil)
+	cleaner.now = func() time.Time { return now }
+	cleaner.availableBytes = func(string) (uint64, error) {
+		var remaining uint64
+		for _, name := range names {
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				remaining++
+			}
+		}
+		return (3 - remaining) * 10, nil
+	}
+
+	if err := cleaner.ReclaimSpace(20); err != nil {
+		t.Fatalf("ReclaimSpace returned error: %v", err)
+	}
+	for i, name := range names {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if kept, wantKept := err == nil, i == 2; kept != wantKept {
+			t.Errorf("%s kept = %v, want %v", name, kept, wantKept)
+		}
+	}
+
+	if err := cleaner.ReclaimSpace(100); err == nil {
+		t.Error("ReclaimSpace returned nil error when the target cannot be met")
+	}
+}
+
+func TestRunCleansArchiveTier(t *testing.T) {
+	tierDir := t.TempDir()
+	now := time.Date(2026, 5, 31, 12, 30, 0, 0, time.UTC)
+	cfg := &config.Config{
+		RecordingsDir: t.TempDir(),
+		KeepDays:      10,
+		Stations:      map[string]config.Station{"a": {}},
+		ArchiveTier:   &config.ArchiveTierConfig{Enabled: true, AfterDays: 7, Path: tierDir},
+	}
+	archiveTier, err := tier.New(cfg.ArchiveTier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]bool{
+		"a/2026-05-01-10.mp3":  false,
+		"a/2026-05-01-10.meta": false,
+		"a/2026-05-25-10.mp3":  true,
+	}
+	for name := range files {
+		path := filepath.Join(tierDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("audio"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cleaner := New(cfg, archiveTier)
+	cleaner.now = func() time.Time { return now }
+	if report := cleaner.Run(context.Background()); report.DeletedRecordings != 1 {
+		t.Errorf("DeletedRecordings = %d, want 1", report.DeletedRecordings)
+	}
+	for name, wantKept := range files {
+		_, err := os.Stat(filepath.Join(tierDir, name))
+		if kept := err == nil; kept != wantKept {
+			t.Errorf("%s kept = %v, want %v", name, kept, wantKept)
+		}
+	}
+}
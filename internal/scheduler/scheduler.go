@@ -9,26 +9,63 @@ import (
 	"path/filepath"
 	"runtime/debug"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	cron "github.com/netresearch/go-cron"
 	"github.com/oszuidwest/zwfm-audiologger/internal/config"
 	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
 	"github.com/oszuidwest/zwfm-audiologger/internal/recorder"
+	"github.com/oszuidwest/zwfm-audiologger/internal/retention"
+	"github.com/oszuidwest/zwfm-audiologger/internal/tier"
 	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
 )
 
 // Scheduler manages scheduled recordings and cleanup tasks.
 type Scheduler struct {
-	config   *config.Config
-	recorder *recorder.Manager
+	config      atomic.Pointer[config.Config]
+	recorder    *recorder.Manager
+	cleaner     *retention.Cleaner
+	archiveTier tier.Tier
+	observers   []tier.MoveObserver
+	ctx         atomic.Pointer[context.Context] // Set by Start; used to record stations added by Reload.
 }
 
-// New creates a new scheduler.
-func New(cfg *config.Config, rec *recorder.Manager) *Scheduler {
-	return &Scheduler{
-		config:   cfg,
-		recorder: rec,
+// New creates a new scheduler. The archive tier may be nil.
+func New(cfg *config.Config, rec *recorder.Manager, cleaner *retention.Cleaner, archiveTier tier.Tier) *Scheduler {
+	s := &Scheduler{
+		recorder:    rec,
+		cleaner:     cleaner,
+		archiveTier: archiveTier,
+	}
+	s.config.Store(cfg)
+	return s
+}
+
+// AddMoveObserver registers an observer for recordings moved to the archive
+// tier. It must be called before the scheduler is started.
+func (s *Scheduler) AddMoveObserver(o tier.MoveObserver) {
+	s.observers = append(s.observers, o)
+}
+
+// Reload applies a new configuration. Stations take their new settings at the
+// next hour; recordings in progress finish with the settings they started
+// with. A station that was added starts recording the rest of the current
+// hour right away, and a removed station is no longer scheduled.
+func (s *Scheduler) Reload(cfg *config.Config) {
+	old := s.config.Swap(cfg)
+	ctx := s.ctx.Load()
+	if ctx == nil {
+		return
+	}
+	added := make(map[string]config.Station)
+	for name, station := range cfg.Stations {
+		if _, ok := old.Stations[name]; !ok {
+			added[name] = station
+		}
+	}
+	if len(added) > 0 {
+		s.startCatchupRecordings(*ctx, added)
 	}
 }
 
@@ -44,20 +81,22 @@ func (s *Scheduler) Start(ctx context.Context) error {
 	}
 
 	// Schedule daily cleanup at midnight
-	_, err = scheduler.AddFunc("0 0 * * *", s.runCleanup, cron.WithName("Daily cleanup"))
+	_, err = scheduler.AddFunc("0 0 * * *", func() { s.runCleanup(ctx) }, cron.WithName("Daily cleanup"))
 	if err != nil {
 		return fmt.Errorf("failed to schedule daily cleanup: %w", err)
 	}
 
 	// Log scheduled stations
-	for name, station := range s.config.Stations {
+	cfg := s.config.Load()
+	for name, station := range cfg.Stations {
 		slog.Info("Scheduled station for hourly recording", "name", name, "url", station.StreamURL)
 	}
 	slog.Info("Scheduled daily cleanup", "time", "midnight", "timezone", utils.AppTimezone)
 
 	// If we started mid-hour, immediately record the remaining portion so no
 	// broadcast is lost between startup and the first cron trigger at minute 0.
-	s.startCatchupRecordings(ctx)
+	s.startCatchupRecordings(ctx, cfg.Stations)
+	s.ctx.Store(&ctx)
 
 	// Start the scheduler
 	scheduler.Start()
@@ -82,10 +121,11 @@ func catchupRemaining(now time.Time) (remainingSecs int, needed bool) {
 }
 
 // existingAudioFile returns the filename of the first audio file in dir whose
-// name starts with timestamp+".". Returns an empty string if none is found.
+// name starts with stem+".", the name of the hour's recording without its
+// extension. Returns an empty string if none is found.
 // Returns an error if the directory cannot be read, except when it does not
 // exist yet (in which case an empty string and nil error are returned).
-func existingAudioFile(dir, timestamp string) (string, error) {
+func existingAudioFile(dir, stem string) (string, error) {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -94,7 +134,7 @@ func existingAudioFile(dir, timestamp string) (string, error) {
 		return "", err
 	}
 	for _, e := range entries {
-		if !e.IsDir() && strings.HasPrefix(e.Name(), timestamp+".") && utils.IsAudioFile(e.Name()) {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), stem+".") && utils.IsAudioFile(e.Name()) {
 			return e.Name(), nil
 		}
 	}
@@ -102,9 +142,10 @@ func existingAudioFile(dir, timestamp string) (string, error) {
 }
 
 // startCatchupRecordings immediately records the remainder of the current hour
-// if the service started mid-hour. This closes the gap that would otherwise
-// exist between startup and the first cron trigger at minute 0.
-func (s *Scheduler) startCatchupRecordings(ctx context.Context) {
+// for the given stations if the service started mid-hour, or the stations were
+// added mid-hour. This closes the gap that would otherwise exist until the
+// next cron trigger at minute 0.
+func (s *Scheduler) startCatchupRecordings(ctx context.Context, stations map[string]config.Station) {
 	if ctx.Err() != nil {
 		slog.Info("catchup recordings skipped because scheduler context is done", "reason", ctx.Err())
 		return
@@ -125,7 +166,7 @@ func (s *Scheduler) startCatchupRecordings(ctx context.Context) {
 		"elapsed_secs", 3600-remainingSecs,
 		"remaining_secs", remainingSecs)
 
-	for name, station := range s.config.Stations {
+	for name, station := range stations {
 		go func(stationName string, stationCfg *config.Station) {
 			defer func() {
 				if r := recover(); r != nil {
@@ -137,8 +178,9 @@ func (s *Scheduler) startCatchupRecordings(ctx context.Context) {
 				return
 			}
 
-			dir := filepath.Join(s.config.RecordingsDir, stationName)
-			existing, err := existingAudioFile(dir, timestamp)
+			recording := utils.RecordingPath(s.config.Load().RecordingsDir, stationName, timestamp, "")
+			dir := filepath.Dir(recording)
+			existing, err := existingAudioFile(dir, filepath.Base(recording))
 			if err != nil {
 				slog.Error("failed to check for existing recordings, skipping catchup",
 					"station", stationName, "dir", dir, "error", err)
@@ -162,7 +204,7 @@ func (s *Scheduler) runAllRecordings(ctx context.Context) {
 		return
 	}
 
-	for name, station := range s.config.Stations {
+	for name, station := range s.config.Load().Stations {
 		go func(stationName string, stationConfig *config.Station) {
 			defer func() {
 				if r := recover(); r != nil {
@@ -178,47 +220,16 @@ func (s *Scheduler) runAllRecordings(ctx context.Context) {
 	}
 }
 
-// runCleanup runs the cleanup with panic recovery.
-func (s *Scheduler) runCleanup() {
+// runCleanup runs the cleanup with panic recovery, then moves older recordings
+// to the archive tier when one is configured.
+func (s *Scheduler) runCleanup(ctx context.Context) {
 	defer func() {
 		if r := recover(); r != nil {
 			slog.Error("panic in cleanup", "panic", r, "stack", string(debug.Stack()))
 		}
 	}()
-	s.cleanupOldRecordings()
-}
-
-// cleanupOldRecordings removes recordings older than configured keep_days.
-func (s *Scheduler) cleanupOldRecordings() {
-	cutoff := utils.Now().AddDate(0, 0, -s.config.KeepDays)
-	slog.Info("Cleaning up old recordings", "cutoff_date", cutoff.Format("2006-01-02"))
-
-	for station := range s.config.Stations {
-		dir := filepath.Join(s.config.RecordingsDir, station)
-		files, err := os.ReadDir(dir)
-		if err != nil {
-			if os.IsNotExist(err) {
-				continue // station has no recordings yet
-			}
-			slog.Error("failed to read directory", "dir", dir, "error", err)
-			continue
-		}
-
-		for _, file := range files {
-			info, err := file.Info()
-			if err != nil {
-				slog.Warn("failed to stat file during cleanup", "file", file.Name(), "error", err)
-				continue
-			}
-
-			if info.ModTime().Before(cutoff) {
-				path := filepath.Join(dir, file.Name())
-				if err := os.Remove(path); err != nil {
-					slog.Error("failed to delete old recording", "path", path, "error", err)
-				} else {
-					slog.Info("Deleted old recording", "path", path)
-				}
-			}
-		}
+	s.cleaner.Run(ctx)
+	if s.archiveTier != nil {
+		tier.Move(ctx, s.config.Load(), s.archiveTier, utils.Now(), s.observers...)
 	}
 }
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+	"github.com/oszuidwest/zwfm-audiologger/internal/index"
+	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
+)
+
+// apiStation summarizes the recordings of a station.
+type apiStation struct {
+	Name          string    `json:"name"`
+	Recordings    int       `json:"recordings"`
+	Oldest        time.Time `json:"oldest,omitzero"`
+	Newest        time.Time `json:"newest,omitzero"`
+	RecordingsURL string    `json:"recordings_url"`
+}
+
+// apiRecording describes a recording in the JSON API.
+type apiRecording struct {
+	Timestamp    string    `json:"timestamp"`
+	Start        time.Time `json:"start"`
+	DurationSecs float64   `json:"duration_secs,omitempty"`
+	Format       string    `json:"format"`
+	Size         int64     `json:"size"`
+	Status       string    `json:"status"`
+	Issues       []string  `json:"issues,omitempty"`
+	Metadata     string    `json:"metadata,omitempty"`
+	// Archived is set when the recording was moved to the archive tier.
+	Archived bool `json:"archived,omitempty"`
+	// DownloadURL serves the recording in full quality.
+	DownloadURL string `json:"download_url"`
+	ProxyURL    string `json:"proxy_url,omitempty"`
+}
+
+// recordingStatuses are the values of the status filter.
+var recordingStatuses = []string{index.StatusValid, index.StatusInvalid, index.StatusSkipped, index.StatusUnvalidated}
+
+// handleAPIStations lists the configured stations with the number and range of
+// their recordings.
+func (s *Server) handleAPIStations(w http.ResponseWriter, _ *http.Request) {
+	if s.archiveIndex == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "The archive index is not available"})
+		return
+	}
+
+	cfg := s.config.Load()
+	stations := make([]apiStation, 0, len(cfg.Stations))
+	for name := range cfg.Stations {
+		station := apiStation{
+			Name:          name,
+			RecordingsURL: "/api/stations/" + url.PathEscape(name) + "/recordings",
+		}
+		for _, rec := range s.archiveIndex.Recordings(name, time.Time{}, time.Time{}) {
+			if rec.Audio() == "" {
+				continue
+			}
+			if station.Recordings == 0 {
+				station.Oldest = rec.Time
+			}
+			station.Recordings++
+			station.Newest = rec.Time
+		}
+		stations = append(stations, station)
+	}
+	slices.SortFunc(stations, func(a, b apiStation) int { return strings.Compare(a.Name, b.Name) })
+	writeJSON(w, http.StatusOK, map[string]any{"stations": stations})
+}
+
+// handleAPIRecordings lists the recordings of a station that start between the
+// from and to query parameters, oldest first, a page at a time. The status
+// parameter keeps only recordings with that validation status.
+func (s *Server) handleAPIRecordings(w http.ResponseWriter, r *http.Request) {
+	if s.archiveIndex == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "The archive index is not available"})
+		return
+	}
+	station := r.PathValue("station")
+	if _, ok := s.config.Load().Stations[station]; !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Unknown station"})
+		return
+	}
+
+	query := r.URL.Query()
+	var from, to time.Time
+	var err error
+	if value := query.Get("from"); value != "" {
+		if from, err = utils.ParseTime(value); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		if to, err = utils.ParseTime(value); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	status := query.Get("status")
+	if status != "" && !slices.Contains(recordingStatuses, status) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": fmt.Sprintf("invalid status %q, use one of %s", status, strings.Join(recordingStatuses, ", ")),
+		})
+		return
+	}
+	limit, offset, err := pagination(query)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	var matched []index.Recording
+	for _, rec := range s.archiveIndex.Recordings(station, from, to) {
+		if rec.Audio() != "" && (status == "" || rec.Status() == status) {
+			matched = append(matched, rec)
+		}
+	}
+
+	// An offset past the end yields an empty page; clamping it first keeps
+	// offset+limit from overflowing.
+	offset = min(offset, len(matched))
+	end := offset + min(limit, len(matched)-offset)
+	page := matched[offset:end]
+	recordings := make([]apiRecording, 0, len(page))
+	for _, rec := range page {
+		recordings = append(recordings, newAPIRecording(&rec))
+	}
+	response := map[string]any{
+		"recordings": recordings,
+		"total":      len(matched),
+		"offset":     offset,
+		"limit":      limit,
+	}
+	if end < len(matched) {
+		next := r.URL.Query()
+		next.Set("offset", strconv.Itoa(end))
+		next.Set("limit", strconv.Itoa(limit))
+		response["next"] = r.URL.Path + "?" + next.Encode()
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// pagination reads the limit and offset query parameters.
+func pagination(query url.Values) (limit, offset int, err error) {
+	limit = constants.APIDefaultPageSize
+	if value := query.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > constants.APIMaxPageSize {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", constants.APIMaxPageSize)
+		}
+	}
+	if value := query.Get("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("invalid offset %q", value)
+		}
+	}
+	return limit, offset, nil
+}
+
+// newAPIRecording describes an indexed recording that has an audio file.
+func newAPIRecording(rec *index.Recording) apiRecording {
+	audio := rec.Audio()
+	out := apiRecording{
+		Timestamp:    rec.Timestamp,
+		Start:        rec.Time,
+		DurationSecs: rec.DurationSecs,
+		Format:       strings.TrimPrefix(path.Ext(audio), "."),
+		Size:         rec.Files[audio].Size,
+		Status:       rec.Status(),
+		Metadata:     rec.Metadata,
+		Archived:     rec.Archived,
+		DownloadURL:  recordingURL(audio) + "?quality=original",
+	}
+	if rec.Validation != nil {
+		out.Issues = rec.Validation.Issues
+	}
+	if proxy := rec.Proxy(); proxy != "" {
+		out.ProxyURL = recordingURL(proxy)
+	}
+	return out
+}
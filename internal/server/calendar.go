@@ -0,0 +1,207 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/index"
+	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
+)
+
+// Statuses of an hour in the calendar.
+const (
+	hourOK          = "ok"
+	hourFlagged     = "flagged"
+	hourPartial     = "partial" // A catchup recording, started late
+	hourUnvalidated = "unvalidated"
+	hourArchived    = "archived"
+	hourRecording   = "recording"
+	hourMissing     = "missing"
+	hourNone        = "none" // Before the archive starts, or still to come
+)
+
+// calendarHour is an hour slot in the calendar.
+type calendarHour struct {
+	Label  string // Such as "14:00"
+	Status string
+	// Details holds the metadata and validation issues, shown on hover.
+	Details     string
+	PlayURL     string
+	DownloadURL string
+}
+
+// calendarDay is a day cell in the month grid.
+type calendarDay struct {
+	Day     int
+	URL     string
+	InMonth bool
+	Hours   []calendarHour
+}
+
+// handleCalendarMonth shows a month of a station as a grid of days, each with
+// its hours coloured by status. The month query parameter, such as 2026-04,
+// defaults to the current month.
+func (s *Server) handleCalendarMonth(w http.ResponseWriter, r *http.Request) {
+	station, ok := s.calendarStation(w, r)
+	if !ok {
+		return
+	}
+	now := utils.Now()
+	first := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	if value := r.URL.Query().Get("month"); value != "" {
+		month, err := time.ParseInLocation("2006-01", value, now.Location())
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid month %q, use YYYY-MM", value)})
+			return
+		}
+		first = month
+	}
+	next := first.AddDate(0, 1, 0)
+
+	// The grid runs from the Monday before the first to the Sunday after the last.
+	start := first.AddDate(0, 0, -(int(first.Weekday())+6)%7)
+	end := next.AddDate(0, 0, (7-(int(next.Weekday())+6)%7)%7)
+	hours := s.calendarHours(station, start, end)
+
+	var weeks [][]calendarDay
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		if len(weeks) == 0 || len(weeks[len(weeks)-1]) == 7 {
+			weeks = append(weeks, nil)
+		}
+		n := int(day.AddDate(0, 0, 1).Sub(day) / time.Hour) // 23 or 25 on daylight saving changes
+		weeks[len(weeks)-1] = append(weeks[len(weeks)-1], calendarDay{
+			Day:     day.Day(),
+			URL:     calendarURL(station) + "/" + day.Format(time.DateOnly),
+			InMonth: day.Month() == first.Month(),
+			Hours:   hours[:n],
+		})
+		hours = hours[n:]
+	}
+
+	s.renderCalendar(w, "month", map[string]any{
+		"Station":  station,
+		"Title":    first.Format("January 2006"),
+		"Previous": calendarURL(station) + "?month=" + first.AddDate(0, -1, 0).Format("2006-01"),
+		"Next":     calendarURL(station) + "?month=" + next.Format("2006-01"),
+		"Weeks":    weeks,
+		"Browse":   "/recordings/" + url.PathEscape(station) + "/",
+	})
+}
+
+// handleCalendarDay shows the hours of one day of a station with their
+// metadata, issues and links to play and download them.
+func (s *Server) handleCalendarDay(w http.ResponseWriter, r *http.Request) {
+	station, ok := s.calendarStation(w, r)
+	if !ok {
+		return
+	}
+	day, err := time.ParseInLocation(time.DateOnly, r.PathValue("date"), utils.AppTimezone)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid date, use YYYY-MM-DD"})
+		return
+	}
+
+	s.renderCalendar(w, "day", map[string]any{
+		"Station":  station,
+		"Title":    day.Format("Monday 2 January 2006"),
+		"Previous": calendarURL(station) + "/" + day.AddDate(0, 0, -1).Format(time.DateOnly),
+		"Next":     calendarURL(station) + "/" + day.AddDate(0, 0, 1).Format(time.DateOnly),
+		"Month":    calendarURL(station) + "?month=" + day.Format("2006-01"),
+		"Hours":    s.calendarHours(station, day, day.AddDate(0, 0, 1)),
+	})
+}
+
+// calendarStation returns the station of a calendar request, or writes an
+// error and returns false.
+func (s *Server) calendarStation(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if s.archiveIndex == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "The archive index is not available"})
+		return "", false
+	}
+	station := r.PathValue("station")
+	if _, ok := s.config.Load().Stations[station]; !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Unknown station"})
+		return "", false
+	}
+	return station, true
+}
+
+// calendarURL returns the URL of the month view of a station.
+func calendarURL(station string) string {
+	return "/calendar/" + url.PathEscape(station)
+}
+
+// calendarHours returns the hour slots of a station from from until to, which
+// are midnights in the configured timezone.
+func (s *Server) calendarHours(station string, from, to time.Time) []calendarHour {
+	var oldest time.Time
+	recordings := make(map[string]index.Recording)
+	for _, rec := range s.archiveIndex.Recordings(station, time.Time{}, to) {
+		if rec.Audio() == "" {
+			continue
+		}
+		if oldest.IsZero() {
+			oldest = rec.Time
+		}
+		if !rec.Time.Before(from) {
+			recordings[rec.Timestamp] = rec
+		}
+	}
+
+	now := utils.Now()
+	var hours []calendarHour
+	for t := from; t.Before(to); t = t.Add(time.Hour) {
+		timestamp := t.Format(utils.HourlyTimestampFormat)
+		hour := calendarHour{Label: t.Format("15:04"), Status: hourMissing}
+		rec, recorded := recordings[timestamp]
+		switch {
+		case recorded:
+			hour.Status = hourStatus(rec.Status())
+			hour.PlayURL = recordingURL(rec.Audio())
+			hour.DownloadURL = hour.PlayURL + "?quality=original"
+			if rec.Archived {
+				hour.Status = hourArchived
+				hour.DownloadURL = hour.PlayURL
+			}
+			details := []string{rec.Metadata}
+			if rec.Validation != nil {
+				details = append(details, rec.Validation.Issues...)
+			}
+			hour.Details = strings.TrimSpace(strings.Join(details, "\n"))
+		case !t.Before(now):
+			hour.Status = hourNone
+		case t.Add(time.Hour).After(now):
+			hour.Status = hourRecording
+		case oldest.IsZero() || t.Before(oldest):
+			hour.Status = hourNone
+		}
+		hours = append(hours, hour)
+	}
+	return hours
+}
+
+// hourStatus maps the validation status of a recording to its calendar status.
+func hourStatus(status string) string {
+	switch status {
+	case index.StatusValid:
+		return hourOK
+	case index.StatusInvalid:
+		return hourFlagged
+	case index.StatusSkipped:
+		return hourPartial
+	default:
+		return hourUnvalidated
+	}
+}
+
+// renderCalendar writes a calendar page.
+func (s *Server) renderCalendar(w http.ResponseWriter, page string, data map[string]any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := calendarTemplate().ExecuteTemplate(w, page, data); err != nil {
+		slog.Error("failed to execute template", "error", err)
+	}
+}
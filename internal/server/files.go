@@ -1,9 +1,12 @@
 package server
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
@@ -12,6 +15,10 @@ import (
 	"time"
 
 	"github.com/dustin/go-humanize"
+	"github.com/oszuidwest/zwfm-audiologger/internal/archive"
+	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+	"github.com/oszuidwest/zwfm-audiologger/internal/index"
+	"github.com/oszuidwest/zwfm-audiologger/internal/proxy"
 	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
 )
 
@@ -22,6 +29,8 @@ type FileInfo struct {
 	ModTime string
 	IsDir   bool
 	URL     string
+	// OriginalURL is set for recordings that are served as their proxy.
+	OriginalURL string
 }
 
 // extensionContentType returns the content type for a file extension.
@@ -46,13 +55,27 @@ func (s *Server) handleRecordings(w http.ResponseWriter, r *http.Request) {
 		urlPath = "/" + urlPath
 	}
 
+	// Hidden files and directories hold internal state, not recordings.
+	if isHiddenPath(urlPath) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "File not found"})
+		return
+	}
+
 	// Simple path construction - recordings are controlled by the system
-	fsPath := filepath.Join(s.config.RecordingsDir, filepath.Clean(urlPath))
+	fsPath := filepath.Join(s.config.Load().RecordingsDir, filepath.Clean(urlPath))
 
 	// Get file info
 	info, err := os.Stat(fsPath) //nolint:gosec // G703: path is sanitized via filepath.Clean above, not raw user input
 	if err != nil {
 		if os.IsNotExist(err) {
+			if s.serveFromTier(w, r, urlPath) {
+				return
+			}
+			if s.archiveTier != nil && urlPath != "/" {
+				// A directory of the layout whose files all moved to the tier.
+				s.showDirectoryListing(w, r, fsPath, urlPath)
+				return
+			}
 			writeJSON(w, http.StatusNotFound, map[string]string{"error": "File not found"})
 			return
 		}
@@ -61,6 +84,13 @@ func (s *Server) handleRecordings(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !info.IsDir() {
+		// A recording is served as its low-bitrate proxy, when it has one,
+		// unless the original is asked for.
+		if r.URL.Query().Get("quality") != "original" && archive.IsAudio(fsPath) {
+			if proxyPath := proxy.Path(fsPath); proxyPath != "" {
+				fsPath = proxyPath
+			}
+		}
 		ext := filepath.Ext(fsPath)
 		contentType := extensionContentType(ext)
 		w.Header().Set("Content-Type", contentType)
@@ -73,11 +103,105 @@ func (s *Server) handleRecordings(w http.ResponseWriter, r *http.Request) {
 	s.showDirectoryListing(w, r, fsPath, urlPath)
 }
 
+// recordingURL returns the URL of a file given by its slash path relative to
+// the recordings directory.
+func recordingURL(rel string) string {
+	parts := strings.Split(rel, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return "/recordings/" + strings.Join(parts, "/")
+}
+
+// isHiddenPath reports whether any element of a URL path starts with a dot.
+func isHiddenPath(urlPath string) bool {
+	for _, part := range strings.Split(path.Clean(urlPath), "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// serveFromTier serves a recording that has moved to the archive tier. It
+// returns false when there is no tier or the file is not in it.
+func (s *Server) serveFromTier(w http.ResponseWriter, r *http.Request, urlPath string) bool {
+	if s.archiveTier == nil {
+		return false
+	}
+	rel := strings.TrimPrefix(path.Clean(urlPath), "/")
+	if !strings.Contains(rel, "/") {
+		return false // Only files below a station directory exist in the tier.
+	}
+
+	w.Header().Set("Content-Type", extensionContentType(path.Ext(rel)))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", path.Base(rel)))
+	err := s.archiveTier.Serve(w, r, rel)
+	if err == nil {
+		return true
+	}
+	w.Header().Del("Content-Disposition")
+	if errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+	slog.Error("failed to serve recording from archive tier", "path", rel, "error", err)
+	writeJSON(w, http.StatusBadGateway, map[string]string{"error": "Archive tier unavailable"})
+	return true
+}
+
+// tierFiles returns listing entries for files and directories below a station
+// directory that only exist in the archive tier.
+func (s *Server) tierFiles(r *http.Request, urlPath string, local map[string]bool) []FileInfo {
+	dir := strings.Trim(urlPath, "/")
+	if s.archiveTier == nil || dir == "" {
+		return nil
+	}
+	station, _, _ := strings.Cut(dir, "/")
+
+	archived, err := s.archiveTier.List(r.Context(), station)
+	if err != nil {
+		slog.Warn("failed to list archive tier", "station", station, "error", err)
+		return nil
+	}
+
+	files := make([]FileInfo, 0, len(archived))
+	for _, file := range archived {
+		rest, ok := strings.CutPrefix(file.Path, dir+"/")
+		if !ok {
+			continue
+		}
+		name, _, nested := strings.Cut(rest, "/")
+		if local[name] || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if nested {
+			// A directory of the layout that no longer exists locally.
+			local[name] = true
+			files = append(files, FileInfo{
+				Name:  name + "/",
+				IsDir: true,
+				URL:   "/recordings" + path.Join(urlPath, name) + "/",
+				Size:  "-",
+			})
+			continue
+		}
+		files = append(files, FileInfo{
+			Name:    name,
+			ModTime: file.ModTime.In(utils.AppTimezone).Format(time.DateTime),
+			URL:     "/recordings" + path.Join(urlPath, name),
+			Size:    humanize.Bytes(uint64(file.Size)), //nolint:gosec // File sizes are always non-negative
+		})
+	}
+	return files
+}
+
 // showDirectoryListing displays an HTML directory listing.
-func (s *Server) showDirectoryListing(w http.ResponseWriter, _ *http.Request, fsPath, urlPath string) {
-	// Read directory
+func (s *Server) showDirectoryListing(w http.ResponseWriter, r *http.Request, fsPath, urlPath string) {
+	// Read directory. A directory that is missing locally may still exist in
+	// the archive tier.
 	entries, err := os.ReadDir(fsPath)
-	if err != nil {
+	missing := os.IsNotExist(err)
+	if err != nil && !missing {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
 		return
 	}
@@ -98,22 +222,44 @@ func (s *Server) showDirectoryListing(w http.ResponseWriter, _ *http.Request, fs
 		})
 	}
 
+	// Sizes and times of indexed files need no stat, which is slow for large
+	// station directories on network shares.
+	var indexed map[string]index.File
+	if dir := strings.Trim(urlPath, "/"); s.archiveIndex != nil && dir != "" {
+		indexed = s.archiveIndex.Files(dir)
+	}
+
 	// Process entries
+	local := make(map[string]bool, len(entries))
+	proxied := make(map[string]bool)
+	for _, entry := range entries {
+		local[entry.Name()] = true
+		if timestamp, suffix := archive.SplitName(entry.Name()); strings.HasPrefix(suffix, constants.ProxyFileSuffix+".") {
+			proxied[timestamp] = true
+		}
+	}
 	for _, entry := range entries {
-		info, err := entry.Info()
-		if err != nil {
-			slog.Warn( //nolint:gosec // entry name comes from our own recordings directory, not user input
-				"failed to read directory entry info, skipping",
-				"entry", entry.Name(),
-				"error", err,
-			)
+		if strings.HasPrefix(entry.Name(), ".") {
 			continue
 		}
+		file, ok := indexed[entry.Name()]
+		if !ok || entry.IsDir() {
+			info, err := entry.Info()
+			if err != nil {
+				slog.Warn( //nolint:gosec // entry name comes from our own recordings directory, not user input
+					"failed to read directory entry info, skipping",
+					"entry", entry.Name(),
+					"error", err,
+				)
+				continue
+			}
+			file = index.File{Size: info.Size(), ModTime: info.ModTime()}
+		}
 
 		fileInfo := FileInfo{
 			Name:    entry.Name(),
 			IsDir:   entry.IsDir(),
-			ModTime: info.ModTime().Format(time.DateTime),
+			ModTime: file.ModTime.Format(time.DateTime),
 		}
 
 		if entry.IsDir() {
@@ -122,12 +268,23 @@ func (s *Server) showDirectoryListing(w http.ResponseWriter, _ *http.Request, fs
 			fileInfo.Size = "-"
 		} else {
 			fileInfo.URL = "/recordings" + path.Join(urlPath, entry.Name())
-			fileInfo.Size = humanize.Bytes(uint64(info.Size())) //nolint:gosec // File sizes are always non-negative
+			fileInfo.Size = humanize.Bytes(uint64(file.Size)) //nolint:gosec // File sizes are always non-negative
+			if timestamp, _ := archive.SplitName(entry.Name()); proxied[timestamp] && archive.IsAudio(entry.Name()) {
+				fileInfo.OriginalURL = fileInfo.URL + "?quality=original"
+			}
 		}
 
 		files = append(files, fileInfo)
 	}
 
+	// Add recordings that have moved to the archive tier
+	archived := s.tierFiles(r, urlPath, local)
+	if missing && len(archived) == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "File not found"})
+		return
+	}
+	files = append(files, archived...)
+
 	// Sort files (directories first, then by name)
 	slices.SortFunc(files, func(a, b FileInfo) int {
 		if a.IsDir != b.IsDir {
@@ -143,12 +300,16 @@ func (s *Server) showDirectoryListing(w http.ResponseWriter, _ *http.Request, fs
 	t := directoryTemplate()
 
 	data := struct {
-		Path  string
-		Files []FileInfo
+		Path     string
+		Calendar string
+		Files    []FileInfo
 	}{
 		Path:  urlPath,
 		Files: files,
 	}
+	if _, ok := s.config.Load().Stations[strings.Trim(urlPath, "/")]; ok && s.archiveIndex != nil {
+		data.Calendar = calendarURL(strings.Trim(urlPath, "/"))
+	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	if err := t.Execute(w, data); err != nil {
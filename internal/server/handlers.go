@@ -1,10 +1,14 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
+	"github.com/oszuidwest/zwfm-audiologger/internal/validator"
 )
 
 // handleStatus handles requests for recording status.
@@ -13,10 +17,81 @@ func (s *Server) handleStatus(w http.ResponseWriter, _ *http.Request) {
 		"message": "System running - recordings scheduled hourly",
 		"time":    utils.Now().Format(time.RFC3339),
 	}
+	for _, r := range s.reporters {
+		status[r.name] = r.reporter.Status()
+	}
 
 	writeJSON(w, http.StatusOK, status)
 }
 
+// handleMetrics handles requests for Prometheus metrics.
+func (s *Server) handleMetrics(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	utils.WriteMetric(w, "audiologger_up", "gauge", "Whether the audio logger is running.", 1)
+	for _, r := range s.reporters {
+		r.reporter.WriteMetrics(w)
+	}
+}
+
+// handleVerify starts a background integrity verification.
+func (s *Server) handleVerify(w http.ResponseWriter, r *http.Request) {
+	if s.verifier == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Integrity manifests are not enabled"})
+		return
+	}
+	if !s.verifier.StartVerification(context.WithoutCancel(r.Context())) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "Verification already running"})
+		return
+	}
+	writeJSON(w, http.StatusAccepted, s.verifier.VerificationStatus())
+}
+
+// handleVerifyStatus returns the state and report of the last integrity verification.
+func (s *Server) handleVerifyStatus(w http.ResponseWriter, _ *http.Request) {
+	if s.verifier == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Integrity manifests are not enabled"})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.verifier.VerificationStatus())
+}
+
+// handleRevalidate starts a background re-validation with the options in the
+// JSON request body.
+func (s *Server) handleRevalidate(w http.ResponseWriter, r *http.Request) {
+	if s.revalidator == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Validation is not enabled"})
+		return
+	}
+
+	var opts validator.RevalidateOptions
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&opts); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	err := s.revalidator.StartRevalidation(context.WithoutCancel(r.Context()), opts)
+	switch {
+	case errors.Is(err, validator.ErrRevalidationRunning):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "Re-validation already running"})
+	case err != nil:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	default:
+		writeJSON(w, http.StatusAccepted, s.revalidator.RevalidationStatus())
+	}
+}
+
+// handleRevalidateStatus returns the state and report of the last re-validation.
+func (s *Server) handleRevalidateStatus(w http.ResponseWriter, _ *http.Request) {
+	if s.revalidator == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Validation is not enabled"})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.revalidator.RevalidationStatus())
+}
+
 // handleHealth handles health check requests.
 func (s *Server) handleHealth(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", "text/plain")
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/archive"
+	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+	"github.com/oszuidwest/zwfm-audiologger/internal/playback"
+	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
+)
+
+// handlePlaylist serves an HLS playlist of a station's finished recordings
+// between the from and to query parameters, by default the current day.
+func (s *Server) handlePlaylist(w http.ResponseWriter, r *http.Request) {
+	cfg := s.config.Load()
+	station := r.PathValue("station")
+	if _, ok := cfg.Stations[station]; !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Unknown station"})
+		return
+	}
+	from, to, err := timeRange(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	recordings, err := archive.Scan(cfg.RecordingsDir, station)
+	if err != nil {
+		slog.Error("failed to list recordings for playlist", "station", station, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+		return
+	}
+	items, err := playback.Items(r.Context(), s.durations, recordings, from, to)
+	if err != nil {
+		slog.Error("failed to read recording durations for playlist", "station", station, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	segmentURL := func(timestamp string, i int) string { return fmt.Sprintf("%s/%d.ts", timestamp, i) }
+	if err := playback.WritePlaylist(w, items, from, to, segmentURL); err != nil {
+		slog.Warn("failed to write playlist", "station", station, "error", err)
+	}
+}
+
+// handleSegment serves one segment of an HLS playlist, cut from the recording
+// and encoded on the fly.
+func (s *Server) handleSegment(w http.ResponseWriter, r *http.Request) {
+	cfg := s.config.Load()
+	station := r.PathValue("station")
+	timestamp := r.PathValue("timestamp")
+	index, err := strconv.Atoi(strings.TrimSuffix(r.PathValue("segment"), ".ts"))
+	if _, ok := cfg.Stations[station]; !ok || err != nil || index < 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Segment not found"})
+		return
+	}
+
+	recordings, err := archive.Scan(cfg.RecordingsDir, station)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+		return
+	}
+	for i := range recordings {
+		rec := &recordings[i]
+		if rec.Timestamp != timestamp || rec.Audio == "" || rec.InProgress() {
+			continue
+		}
+		item, err := playback.NewItem(r.Context(), s.durations, rec)
+		if err != nil {
+			slog.Error("failed to read recording duration", "station", station, "timestamp", timestamp, "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+			return
+		}
+		if index >= item.Segments() {
+			break
+		}
+
+		start, duration := item.Segment(index)
+		output, err := utils.SegmentCommand(r.Context(), item.Path, start, duration).Output()
+		if err != nil {
+			slog.Error("failed to cut segment", "file", item.Path, "segment", index, "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+			return
+		}
+		w.Header().Set("Content-Type", "video/mp2t")
+		w.Header().Set("Cache-Control", "max-age=3600")
+		_, _ = w.Write(output)
+		return
+	}
+	writeJSON(w, http.StatusNotFound, map[string]string{"error": "Segment not found"})
+}
+
+// timeRange reads the from and to query parameters. From defaults to the start
+// of the current day and to to one day after from.
+func timeRange(r *http.Request) (from, to time.Time, err error) {
+	query := r.URL.Query()
+	if value := query.Get("from"); value != "" {
+		if from, err = utils.ParseTime(value); err != nil {
+			return from, to, err
+		}
+	} else {
+		now := utils.Now()
+		from = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	}
+	if value := query.Get("to"); value != "" {
+		if to, err = utils.ParseTime(value); err != nil {
+			return from, to, err
+		}
+	} else {
+		to = from.AddDate(0, 0, 1)
+	}
+
+	switch {
+	case !to.After(from):
+		return from, to, errors.New("to must be after from")
+	case to.Sub(from) > constants.HLSMaxRange:
+		return from, to, fmt.Errorf("time range must not exceed %s", constants.HLSMaxRange)
+	}
+	return from, to, nil
+}
+
+// handleListen streams a station as MP3 from the time in the from query
+// parameter, or ago before now, through the following recordings and the one
+// in progress. The stream runs in real time, so it stays the same distance
+// behind the broadcast until the listener disconnects.
+func (s *Server) handleListen(w http.ResponseWriter, r *http.Request) {
+	cfg := s.config.Load()
+	station := r.PathValue("station")
+	if _, ok := cfg.Stations[station]; !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Unknown station"})
+		return
+	}
+	pos, err := listenStart(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx := r.Context()
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		slog.Warn("failed to lift write deadline for stream", "error", err)
+	}
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Header().Set("Cache-Control", "no-store")
+	pacer := playback.NewPacer(ctx, w, func() { _ = rc.Flush() }, constants.RestreamBitrateKbps)
+
+	var after time.Time
+	waitingSince := time.Now()
+	for ctx.Err() == nil {
+		recordings, err := archive.Scan(cfg.RecordingsDir, station)
+		if err != nil {
+			slog.Error("failed to list recordings for stream", "station", station, "error", err)
+			return
+		}
+		source, ok, err := playback.Next(ctx, s.durations, recordings, s.liveSource(station), pos, after)
+		if err != nil {
+			slog.Error("failed to find recording for stream", "station", station, "error", err)
+			return
+		}
+		if !ok {
+			if time.Since(waitingSince) > constants.RestreamMaxWait {
+				slog.Info("Ending stream, no new recording", "station", station)
+				return
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		if err := s.stream(ctx, pacer, source); err != nil && ctx.Err() == nil {
+			slog.Error("failed to stream recording", "file", source.Path, "error", err)
+			return
+		}
+		after = source.Start
+		pos = source.Start
+		waitingSince = time.Now()
+	}
+}
+
+// liveSource returns the recording in progress of a station as a source, or nil.
+func (s *Server) liveSource(station string) *playback.Source {
+	if s.recorder == nil {
+		return nil
+	}
+	live := s.recorder.Live(station)
+	if live == nil {
+		return nil
+	}
+	return &playback.Source{
+		Item: playback.Item{Timestamp: live.Timestamp, Start: live.Start, Path: live.Path},
+		Done: live.Done(),
+	}
+}
+
+// stream encodes one source to w. The recording in progress is followed
+// until the recorder finishes it.
+func (s *Server) stream(ctx context.Context, w io.Writer, source playback.Source) error {
+	input := source.Path
+	var stdin io.ReadCloser
+	if source.Live() {
+		var err error
+		if stdin, err = playback.Follow(ctx, source.Path, source.Done); err != nil {
+			return err
+		}
+		defer func() { _ = stdin.Close() }()
+		input = "pipe:0"
+	}
+
+	cmd := utils.RestreamCommand(ctx, input, source.Offset, constants.RestreamBitrateKbps)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	cmd.Stdout = w
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// listenStart reads where a stream starts: the from query parameter, or ago
+// before now, such as "15m". Without either it starts at the live broadcast.
+func listenStart(r *http.Request) (time.Time, error) {
+	query := r.URL.Query()
+	now := utils.Now()
+	var start time.Time
+	switch {
+	case query.Get("from") != "":
+		var err error
+		if start, err = utils.ParseTime(query.Get("from")); err != nil {
+			return start, err
+		}
+	case query.Get("ago") != "":
+		ago, err := time.ParseDuration(query.Get("ago"))
+		if err != nil || ago < 0 {
+			return start, fmt.Errorf("invalid ago %q, use a duration such as 15m", query.Get("ago"))
+		}
+		start = now.Add(-ago)
+	default:
+		start = now
+	}
+	if start.After(now) {
+		return start, errors.New("from must not be in the future")
+	}
+	return start, nil
+}
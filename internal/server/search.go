@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/index"
+	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
+)
+
+// searchResult is a search hit with a link to listen from its start.
+type searchResult struct {
+	index.Hit
+	ListenURL string `json:"listen_url"`
+}
+
+// handleSearch finds recordings whose metadata or validation issues contain
+// the words in the q query parameter, optionally limited to a station and to
+// recordings starting between from and to.
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if s.archiveIndex == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "The archive index is not available"})
+		return
+	}
+	query := r.URL.Query()
+	q := index.Query{Text: query.Get("q"), Station: query.Get("station")}
+	if q.Text == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "q is required"})
+		return
+	}
+	if q.Station != "" {
+		if _, ok := s.config.Load().Stations[q.Station]; !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Unknown station"})
+			return
+		}
+	}
+	var err error
+	if value := query.Get("from"); value != "" {
+		if q.From, err = utils.ParseTime(value); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		if q.To, err = utils.ParseTime(value); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	hits, truncated := s.archiveIndex.Search(q)
+	results := make([]searchResult, 0, len(hits))
+	for _, hit := range hits {
+		results = append(results, searchResult{
+			Hit:       hit,
+			ListenURL: "/listen/" + url.PathEscape(hit.Station) + "?from=" + url.QueryEscape(hit.Start.Format(time.RFC3339)),
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"results": results, "truncated": truncated})
+}
@@ -3,34 +3,88 @@ package server
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/oszuidwest/zwfm-audiologger/internal/config"
 	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+	"github.com/oszuidwest/zwfm-audiologger/internal/index"
+	"github.com/oszuidwest/zwfm-audiologger/internal/playback"
 	"github.com/oszuidwest/zwfm-audiologger/internal/recorder"
+	"github.com/oszuidwest/zwfm-audiologger/internal/tier"
+	"github.com/oszuidwest/zwfm-audiologger/internal/validator"
 )
 
+// Reporter defines the interface for components that contribute to the status
+// and metrics endpoints.
+type Reporter interface {
+	// Status returns a JSON-serializable summary for /status.
+	Status() any
+	// WriteMetrics writes metrics in Prometheus text format.
+	WriteMetrics(w io.Writer)
+}
+
+// Verifier defines the interface for checking the archive against its
+// integrity manifests.
+type Verifier interface {
+	// StartVerification starts a background verification. It returns false if
+	// one is already running.
+	StartVerification(ctx context.Context) bool
+	// VerificationStatus returns a JSON-serializable state of the current or
+	// last verification.
+	VerificationStatus() any
+}
+
+// Revalidator defines the interface for validating recordings again under the
+// current configuration.
+type Revalidator interface {
+	// StartRevalidation starts a background re-validation. It returns
+	// validator.ErrRevalidationRunning if one is already running, or another
+	// error for invalid options.
+	StartRevalidation(ctx context.Context, opts validator.RevalidateOptions) error
+	// RevalidationStatus returns a JSON-serializable state of the current or
+	// last re-validation.
+	RevalidationStatus() any
+}
+
+// namedReporter is a reporter with the key it uses in /status.
+type namedReporter struct {
+	name     string
+	reporter Reporter
+}
+
 // Server handles HTTP requests for recording control.
 type Server struct {
-	config        *config.Config
+	config        atomic.Pointer[config.Config]
 	recorder      *recorder.Manager
+	archiveTier   tier.Tier    // nil when no archive tier is configured.
+	archiveIndex  *index.Index // nil until SetIndex is called.
+	reporters     []namedReporter
+	verifier      Verifier    // nil when integrity manifests are disabled.
+	revalidator   Revalidator // nil when validation is disabled.
+	durations     *playback.Durations
 	mux           *http.ServeMux
 	accessLogger  *slog.Logger
 	accessLogFile *os.File // nil when falling back to stdout.
 }
 
-// New creates a new HTTP server.
-func New(cfg *config.Config, rec *recorder.Manager) *Server {
+// New creates a new HTTP server. The archive tier may be nil.
+func New(cfg *config.Config, rec *recorder.Manager, archiveTier tier.Tier) *Server {
 	s := &Server{
-		config:   cfg,
-		recorder: rec,
-		mux:      http.NewServeMux(),
+		recorder:    rec,
+		archiveTier: archiveTier,
+		durations:   playback.NewDurations(),
+		mux:         http.NewServeMux(),
 	}
+	s.config.Store(cfg)
 
 	// Open access log file; fall back to stdout on failure.
 	f, err := os.OpenFile(
@@ -50,22 +104,80 @@ func New(cfg *config.Config, rec *recorder.Manager) *Server {
 	return s
 }
 
+// AddReporter registers a component whose status appears under name in /status
+// and whose metrics appear in /metrics. It must be called before Start.
+func (s *Server) AddReporter(name string, r Reporter) {
+	s.reporters = append(s.reporters, namedReporter{name: name, reporter: r})
+}
+
+// SetIndex enables /search and the JSON API, and lets directory listings take
+// file sizes from the index. It must be called before Start.
+func (s *Server) SetIndex(ix *index.Index) {
+	s.archiveIndex = ix
+}
+
+// SetVerifier enables the /verify endpoints. It must be called before Start.
+func (s *Server) SetVerifier(v Verifier) {
+	s.verifier = v
+}
+
+// SetRevalidator enables the /revalidate endpoints. It must be called before Start.
+func (s *Server) SetRevalidator(r Revalidator) {
+	s.revalidator = r
+}
+
+// Reload applies a new configuration, such as a changed api_token. The port
+// and recordings directory only change on restart.
+func (s *Server) Reload(cfg *config.Config) {
+	s.config.Store(cfg)
+}
+
 // setupRoutes configures the HTTP routes.
 func (s *Server) setupRoutes() {
 	s.mux.HandleFunc("GET /status", s.handleStatus)
 	s.mux.HandleFunc("GET /health", s.handleHealth)
+	s.mux.HandleFunc("GET /metrics", s.handleMetrics)
+	s.mux.HandleFunc("GET /verify", s.handleVerifyStatus)
+	s.mux.HandleFunc("POST /verify", s.requireToken(s.handleVerify))
+	s.mux.HandleFunc("GET /revalidate", s.requireToken(s.handleRevalidateStatus))
+	s.mux.HandleFunc("POST /revalidate", s.requireToken(s.handleRevalidate))
 	s.mux.HandleFunc("GET /recordings/{path...}", s.handleRecordings)
+	s.mux.HandleFunc("GET /hls/{station}/playlist.m3u8", s.handlePlaylist)
+	s.mux.HandleFunc("GET /hls/{station}/{timestamp}/{segment}", s.handleSegment)
+	s.mux.HandleFunc("GET /listen/{station}", s.handleListen)
+	s.mux.HandleFunc("GET /search", s.handleSearch)
+	s.mux.HandleFunc("GET /api/stations", s.handleAPIStations)
+	s.mux.HandleFunc("GET /calendar/{station}", s.handleCalendarMonth)
+	s.mux.HandleFunc("GET /calendar/{station}/{date}", s.handleCalendarDay)
+	s.mux.HandleFunc("GET /api/stations/{station}/recordings", s.handleAPIRecordings)
 }
 
 // Start begins listening for HTTP requests.
 func (s *Server) Start(ctx context.Context) error {
-	addr := fmt.Sprintf(":%d", s.config.Port)
+	port := s.config.Load().Port
+	addr := fmt.Sprintf(":%d", port)
 
-	slog.Info("HTTP server listening", "port", s.config.Port)
+	slog.Info("HTTP server listening", "port", port)
 	slog.Info("Endpoints:")
 	slog.Info("  - GET /recordings/* (browse recordings)")
+	slog.Info("  - GET /hls/{station}/playlist.m3u8 (HLS playback of the archive)")
+	slog.Info("  - GET /listen/{station} (time-shifted stream)")
+	if s.archiveIndex != nil {
+		slog.Info("  - GET /search (search metadata and validation issues)")
+		slog.Info("  - GET /api/stations (stations and recordings as JSON)")
+		slog.Info("  - GET /calendar/{station} (archive calendar)")
+	}
 	slog.Info("  - GET /status (system status)")
 	slog.Info("  - GET /health (health check)")
+	slog.Info("  - GET /metrics (Prometheus metrics)")
+	if s.verifier != nil {
+		slog.Info("  - POST /verify (start integrity verification, requires api_token)")
+		slog.Info("  - GET /verify (integrity verification result)")
+	}
+	if s.revalidator != nil {
+		slog.Info("  - POST /revalidate (start re-validation, requires api_token)")
+		slog.Info("  - GET /revalidate (re-validation result, requires api_token)")
+	}
 
 	// Create HTTP server with logging middleware
 	server := &http.Server{
@@ -126,6 +238,25 @@ func (s *Server) closeAccessLogFile() {
 	s.accessLogFile = nil
 }
 
+// requireToken allows a request only if it carries the configured API token as
+// a bearer token. Without a configured token the endpoint is disabled.
+func (s *Server) requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiToken := s.config.Load().APIToken
+		if apiToken == "" {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "Set api_token to enable this endpoint"})
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(apiToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid or missing API token"})
+			return
+		}
+		next(w, r)
+	}
+}
+
 // loggingMiddleware logs HTTP requests.
 func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -157,6 +288,12 @@ func (lrw *loggingResponseWriter) WriteHeader(code int) {
 	lrw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap returns the underlying ResponseWriter, so http.ResponseController
+// can flush streams and lift the write deadline through the wrapper.
+func (lrw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
+
 // writeJSON writes a JSON response.
 func writeJSON(w http.ResponseWriter, status int, data any) {
 	w.Header().Set("Content-Type", "application/json")
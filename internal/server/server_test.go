@@ -8,11 +8,17 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+	"github.com/oszuidwest/zwfm-audiologger/internal/index"
+	"github.com/oszuidwest/zwfm-audiologger/internal/playback"
+	"github.com/oszuidwest/zwfm-audiologger/internal/validator"
 )
 
 func TestStartClosesAccessLogFileWhenListenFails(t *testing.T) {
@@ -24,11 +30,11 @@ func TestStartClosesAccessLogFileWhenListenFails(t *testing.T) {
 	t.Cleanup(func() { _ = accessLogFile.Close() })
 
 	s := &Server{
-		config:        &config.Config{Port: -1},
 		mux:           http.NewServeMux(),
 		accessLogger:  slog.New(slog.NewJSONHandler(accessLogFile, nil)),
 		accessLogFile: accessLogFile,
 	}
+	s.config.Store(&config.Config{Port: -1})
 
 	if err := s.Start(context.Background()); err == nil {
 		t.Fatal("Start returned nil error for invalid listen address")
@@ -54,11 +60,11 @@ func TestStartClosesAccessLogFileAfterCleanShutdown(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	s := &Server{
-		config:        &config.Config{Port: port},
 		mux:           http.NewServeMux(),
 		accessLogger:  slog.New(slog.NewJSONHandler(accessLogFile, nil)),
 		accessLogFile: accessLogFile,
 	}
+	s.config.Store(&config.Config{Port: port})
 	s.setupRoutes()
 
 	errCh := make(chan error, 1)
@@ -95,6 +101,304 @@ func TestCloseAccessLogFileAllowsNilFile(t *testing.T) {
 	}
 }
 
+// fakeRevalidator records the options of the re-validations it starts.
+type fakeRevalidator struct {
+	started []validator.RevalidateOptions
+}
+
+func (f *fakeRevalidator) StartRevalidation(_ context.Context, opts validator.RevalidateOptions) error {
+	if opts.From == "" {
+		return errors.New("invalid from date")
+	}
+	f.started = append(f.started, opts)
+	return nil
+}
+
+func (f *fakeRevalidator) RevalidationStatus() any {
+	return map[string]bool{"running": len(f.started) > 0}
+}
+
+// fakeVerifier counts the verifications it starts.
+type fakeVerifier struct {
+	started int
+}
+
+func (f *fakeVerifier) StartVerification(context.Context) bool {
+	f.started++
+	return true
+}
+
+func (f *fakeVerifier) VerificationStatus() any {
+	return map[string]int{"started": f.started}
+}
+
+func TestVerifyRequiresToken(t *testing.T) {
+	verifier := &fakeVerifier{}
+	s := &Server{mux: http.NewServeMux(), verifier: verifier}
+	s.config.Store(&config.Config{APIToken: "secret"})
+	s.setupRoutes()
+
+	for _, tc := range []struct {
+		token string
+		want  int
+	}{
+		{"", http.StatusUnauthorized},
+		{"wrong", http.StatusUnauthorized},
+		{"secret", http.StatusAccepted},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/verify", nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("token %q: status = %d, want %d", tc.token, rec.Code, tc.want)
+		}
+	}
+	if verifier.started != 1 {
+		t.Errorf("started %d verifications, want 1", verifier.started)
+	}
+}
+
+func TestRevalidateRequiresToken(t *testing.T) {
+	revalidator := &fakeRevalidator{}
+	s := &Server{mux: http.NewServeMux(), revalidator: revalidator}
+	s.config.Store(&config.Config{APIToken: "secret"})
+	s.setupRoutes()
+
+	for _, tc := range []struct {
+		token string
+		body  string
+		want  int
+	}{
+		{"", `{"from": "2026-04-01"}`, http.StatusUnauthorized},
+		{"wrong", `{"from": "2026-04-01"}`, http.StatusUnauthorized},
+		{"secret", `{"from": "2026-04-01", "dry_run": true}`, http.StatusAccepted},
+		{"secret", `{"station": "a"}`, http.StatusBadRequest},
+		{"secret", `{"form": "2026-04-01"}`, http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/revalidate", strings.NewReader(tc.body))
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("token %q, body %s: status = %d, want %d", tc.token, tc.body, rec.Code, tc.want)
+		}
+	}
+	if len(revalidator.started) != 1 || !revalidator.started[0].DryRun {
+		t.Errorf("started = %+v, want one dry run", revalidator.started)
+	}
+
+	// Without a configured token the endpoint is disabled.
+	s.Reload(&config.Config{})
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/revalidate", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status without api_token = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestRecordingsServeProxyByDefault(t *testing.T) {
+	dir := t.TempDir()
+	stationDir := filepath.Join(dir, "station")
+	if err := os.MkdirAll(stationDir, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"2026-04-30-22.mp3":        "original",
+		"2026-04-30-22.proxy.opus": "proxy",
+		"2026-04-30-23.mp3":        "no proxy",
+	} {
+		if err := os.WriteFile(filepath.Join(stationDir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := &Server{mux: http.NewServeMux()}
+	s.config.Store(&config.Config{RecordingsDir: dir})
+	s.setupRoutes()
+
+	for _, tc := range []struct {
+		url  string
+		want string
+	}{
+		{"/recordings/station/2026-04-30-22.mp3", "proxy"},
+		{"/recordings/station/2026-04-30-22.mp3?quality=original", "original"},
+		{"/recordings/station/2026-04-30-23.mp3", "no proxy"},
+	} {
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.url, nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != tc.want {
+			t.Errorf("%s: status %d, body %q, want %q", tc.url, rec.Code, rec.Body.String(), tc.want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/recordings/station/", nil))
+	if body := rec.Body.String(); strings.Count(body, "?quality=original") != 1 {
+		t.Errorf("listing should link the original of the proxied recording once:\n%s", body)
+	}
+}
+
+func TestSearchReturnsListenURL(t *testing.T) {
+	dir := t.TempDir()
+	stationDir := filepath.Join(dir, "station")
+	if err := os.MkdirAll(stationDir, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{RecordingsDir: dir, StateDir: filepath.Join(dir, ".audiologger"), Stations: map[string]config.Station{"station": {}}}
+	ix := index.New(cfg, nil)
+	metaFile := filepath.Join(stationDir, "2026-04-30-22.meta")
+	if err := os.WriteFile(metaFile, []byte("Late Show"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ix.FileCompleted("station", "2026-04-30-22", metaFile)
+
+	s := &Server{mux: http.NewServeMux()}
+	s.config.Store(cfg)
+	s.SetIndex(ix)
+	s.setupRoutes()
+
+	for _, tc := range []struct {
+		url  string
+		code int
+		want string
+	}{
+		{"/search?q=late+show", http.StatusOK, `"listen_url":"/listen/station?from=2026-04-30T22%3A00%3A00Z"`},
+		{"/search?q=late&to=2026-04-30T22:00", http.StatusOK, `"results":[]`},
+		{"/search?q=late&station=other", http.StatusNotFound, "Unknown station"},
+		{"/search", http.StatusBadRequest, "q is required"},
+	} {
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.url, nil))
+		if rec.Code != tc.code || !strings.Contains(rec.Body.String(), tc.want) {
+			t.Errorf("%s: status %d, body %s, want %d with %s", tc.url, rec.Code, rec.Body.String(), tc.code, tc.want)
+		}
+	}
+}
+
+func TestAPIRecordingsPagesAndFilters(t *testing.T) {
+	dir := t.TempDir()
+	stationDir := filepath.Join(dir, "station")
+	if err := os.MkdirAll(stationDir, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{RecordingsDir: dir, StateDir: filepath.Join(dir, ".audiologger"), Stations: map[string]config.Station{"station": {}}}
+	ix := index.New(cfg, nil)
+	for name, content := range map[string]string{
+		"2026-04-30-20.mp3":             "audio",
+		"2026-04-30-20.validation.json": `{"duration_secs": 3600, "valid": true}`,
+		"2026-04-30-21.mp3":             "audio",
+		"2026-04-30-21.validation.json": `{"duration_secs": 1200, "valid": false, "issues": ["duration too short"]}`,
+		"2026-04-30-21.proxy.opus":      "proxy",
+		"2026-04-30-22.ogg":             "audio",
+		"2026-04-30-23.meta":            "Only metadata",
+	} {
+		path := filepath.Join(stationDir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		ix.FileCompleted("station", "", path)
+	}
+
+	s := &Server{mux: http.NewServeMux()}
+	s.config.Store(cfg)
+	s.SetIndex(ix)
+	s.setupRoutes()
+
+	for _, tc := range []struct {
+		url  string
+		code int
+		want []string
+	}{
+		{"/api/stations", http.StatusOK, []string{`"name":"station","recordings":3`}},
+		{"/api/stations/station/recordings?limit=2", http.StatusOK, []string{
+			`"total":3`, `"timestamp":"2026-04-30-20"`, `"status":"valid"`,
+			`"download_url":"/recordings/station/2026-04-30-21.mp3?quality=original"`,
+			`"proxy_url":"/recordings/station/2026-04-30-21.proxy.opus"`,
+			`"next":"/api/stations/station/recordings?limit=2\u0026offset=2"`,
+		}},
+		{"/api/stations/station/recordings?limit=2&offset=2", http.StatusOK, []string{`"format":"ogg"`, `"status":"unvalidated"`}},
+		{"/api/stations/station/recordings?offset=9223372036854775807", http.StatusOK, []string{`"recordings":[]`, `"total":3`, `"offset":3`}},
+		{"/api/stations/station/recordings?status=invalid", http.StatusOK, []string{`"total":1`, `"issues":["duration too short"]`}},
+		{"/api/stations/station/recordings?from=2026-04-30T21:00&to=2026-04-30T22:00", http.StatusOK, []string{`"total":1`, `"duration_secs":1200`}},
+		{"/api/stations/station/recordings?status=broken", http.StatusBadRequest, []string{"invalid status"}},
+		{"/api/stations/station/recordings?limit=0", http.StatusBadRequest, []string{"limit must be"}},
+		{"/api/stations/other/recordings", http.StatusNotFound, []string{"Unknown station"}},
+	} {
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.url, nil))
+		if rec.Code != tc.code {
+			t.Errorf("%s: status %d, want %d", tc.url, rec.Code, tc.code)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(rec.Body.String(), want) {
+				t.Errorf("%s: body %s, want %s", tc.url, rec.Body.String(), want)
+			}
+		}
+	}
+}
+
+func TestCalendarColoursHoursByStatus(t *testing.T) {
+	dir := t.TempDir()
+	stationDir := filepath.Join(dir, "station")
+	if err := os.MkdirAll(stationDir, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{RecordingsDir: dir, StateDir: filepath.Join(dir, ".audiologger"), Stations: map[string]config.Station{"station": {}}}
+	ix := index.New(cfg, nil)
+	for name, content := range map[string]string{
+		"2026-04-30-10.mp3":             "audio",
+		"2026-04-30-10.meta":            "Morning Show",
+		"2026-04-30-10.validation.json": `{"valid": true}`,
+		"2026-04-30-11.mp3":             "audio",
+		"2026-04-30-11.validation.json": `{"valid": false, "issues": ["silence detected"]}`,
+		"2026-04-30-13.mp3":             "audio",
+		"2026-04-30-13.validation.json": `{"valid": true, "skipped": true}`,
+	} {
+		path := filepath.Join(stationDir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		ix.FileCompleted("station", "", path)
+	}
+
+	s := &Server{mux: http.NewServeMux()}
+	s.config.Store(cfg)
+	s.SetIndex(ix)
+	s.setupRoutes()
+
+	hours := s.calendarHours("station",
+		time.Date(2026, 4, 30, 0, 0, 0, 0, time.UTC), time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC))
+	if len(hours) != 24 {
+		t.Fatalf("got %d hours, want 24", len(hours))
+	}
+	for i, want := range map[int]string{9: hourNone, 10: hourOK, 11: hourFlagged, 12: hourMissing, 13: hourPartial, 14: hourMissing} {
+		if hours[i].Status != want {
+			t.Errorf("hour %d: status %s, want %s", i, hours[i].Status, want)
+		}
+	}
+	if hours[11].Details != "silence detected" || hours[10].PlayURL != "/recordings/station/2026-04-30-10.mp3" {
+		t.Errorf("hours = %+v, want the issue and play link", hours[10:12])
+	}
+
+	for _, url := range []string{"/calendar/station?month=2026-04", "/calendar/station/2026-04-30"} {
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `class="flagged"`) && !strings.Contains(rec.Body.String(), `class="slot flagged"`) {
+			t.Errorf("%s: status %d, want a page with the flagged hour:\n%s", url, rec.Code, rec.Body.String())
+		}
+	}
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/calendar/station?month=April", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid month: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
 func freeLocalPort(t *testing.T) int {
 	t.Helper()
 
@@ -136,3 +440,73 @@ func waitForHealth(t *testing.T, port int, errCh <-chan error) {
 
 	t.Fatalf("server did not become healthy at %s", url)
 }
+
+func TestListenStreamsPastWriteTimeout(t *testing.T) {
+	// Fake ffprobe and ffmpeg: the recording lasts an hour and the encoder
+	// writes a 1000-byte chunk every 200ms.
+	bin := t.TempDir()
+	scripts := map[string]string{
+		"ffprobe": `echo '{"format":{"duration":"3600"}}'`,
+		"ffmpeg":  `i=0; while [ $i -lt 8 ]; do printf '%01000d' 0; sleep 0.2; i=$((i+1)); done`,
+	}
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte("#!/bin/sh\n"+script+"\n"), 0o700); err != nil { //nolint:gosec // G306: test scripts must be executable
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	dir := t.TempDir()
+	now := time.Now().UTC()
+	recording := filepath.Join(dir, "station", now.Format("2006-01-02-15")+".mp3")
+	if err := os.MkdirAll(filepath.Dir(recording), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(recording, []byte("audio"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{
+		mux:          http.NewServeMux(),
+		accessLogger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		durations:    playback.NewDurations(),
+	}
+	s.config.Store(&config.Config{RecordingsDir: dir, Stations: map[string]config.Station{"station": {}}})
+	s.setupRoutes()
+
+	const writeTimeout = 500 * time.Millisecond
+	srv := httptest.NewUnstartedServer(s.loggingMiddleware(s.mux))
+	srv.Config.WriteTimeout = writeTimeout
+	srv.Start()
+	defer srv.Close()
+
+	start := time.Now()
+	resp, err := http.Get(srv.URL + "/listen/station?ago=1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	buf := make([]byte, 8000)
+	var firstChunk time.Duration
+	received := 0
+	for received < len(buf) {
+		n, err := resp.Body.Read(buf[received:])
+		if n > 0 && received == 0 {
+			firstChunk = time.Since(start)
+		}
+		received += n
+		if err != nil {
+			break
+		}
+	}
+	if received < len(buf) {
+		t.Fatalf("received %d bytes in %s, want %d: the stream was cut off", received, time.Since(start), len(buf))
+	}
+	if elapsed := time.Since(start); elapsed < writeTimeout {
+		t.Errorf("stream took %s, want it to last past the write timeout of %s", elapsed, writeTimeout)
+	}
+	if firstChunk > 400*time.Millisecond {
+		t.Errorf("first chunk arrived after %s, want it flushed before the rest was encoded", firstChunk)
+	}
+}
@@ -27,6 +27,7 @@ var directoryTemplate = sync.OnceValue(func() *template.Template {
 </head>
 <body>
     <h1>Index of /recordings{{.Path}}</h1>
+    {{if .Calendar}}<p><a href="{{.Calendar}}">Calendar view</a></p>{{end}}
     <table>
         <thead>
             <tr>
@@ -38,7 +39,7 @@ var directoryTemplate = sync.OnceValue(func() *template.Template {
         <tbody>
             {{range .Files}}
             <tr>
-                <td><a href="{{.URL}}">{{.Name}}</a></td>
+                <td><a href="{{.URL}}">{{.Name}}</a>{{if .OriginalURL}} <a class="time" href="{{.OriginalURL}}">(original)</a>{{end}}</td>
                 <td class="size">{{.Size}}</td>
                 <td class="time">{{.ModTime}}</td>
             </tr>
@@ -54,3 +55,97 @@ var directoryTemplate = sync.OnceValue(func() *template.Template {
 	}
 	return t
 })
+
+// calendarTemplate provides the HTML templates of the calendar: "month" for
+// the grid of a month and "day" for the hours of a day.
+var calendarTemplate = sync.OnceValue(func() *template.Template {
+	tmpl := `{{define "head"}}<!DOCTYPE html>
+<html>
+<head>
+    <title>{{.Station}} - {{.Title}}</title>
+    <style>
+        body { font-family: monospace; margin: 20px; }
+        h1 { font-size: 24px; }
+        a { text-decoration: none; color: #0066cc; }
+        a:hover { text-decoration: underline; }
+        nav { margin-bottom: 16px; }
+        nav a { margin-right: 16px; }
+        table { border-collapse: collapse; }
+        th { text-align: left; border-bottom: 1px solid #ddd; padding: 8px; }
+        td { padding: 8px; vertical-align: top; }
+        .month td { border: 1px solid #ddd; width: 130px; height: 70px; }
+        .month td.outside { color: #aaa; }
+        .month td.outside .hours { opacity: 0.4; }
+        .hours { display: grid; grid-template-columns: repeat(6, 1fr); gap: 2px; margin-top: 6px; }
+        .hours a, .hours span { display: block; height: 10px; }
+        .day tr:hover { background-color: #f5f5f5; }
+        .day .slot { width: 14px; }
+        .details { white-space: pre-line; }
+        .time { color: #666; }
+        .legend span { display: inline-block; padding: 2px 8px; margin-right: 4px; }
+        .ok { background-color: #7bc67e; }
+        .flagged { background-color: #f0a04b; }
+        .partial { background-color: #e3d15a; }
+        .unvalidated { background-color: #b8d8b9; }
+        .archived { background-color: #a5b8cf; }
+        .recording { background-color: #7fb2e5; }
+        .missing { background-color: #e06666; }
+        .none { background-color: #eee; }
+    </style>
+</head>
+<body>
+    <h1>{{.Station}} - {{.Title}}</h1>
+    <p class="legend"><span class="ok">ok</span><span class="flagged">flagged</span><span class="partial">partial</span><span class="unvalidated">not validated</span><span class="archived">archived</span><span class="recording">recording</span><span class="missing">missing</span></p>
+{{end}}
+
+{{define "month"}}{{template "head" .}}
+    <nav><a href="{{.Previous}}">&larr; previous</a><a href="{{.Next}}">next &rarr;</a><a href="{{.Browse}}">all files</a></nav>
+    <table class="month">
+        <thead>
+            <tr><th>Mon</th><th>Tue</th><th>Wed</th><th>Thu</th><th>Fri</th><th>Sat</th><th>Sun</th></tr>
+        </thead>
+        <tbody>
+            {{range .Weeks}}
+            <tr>
+                {{range .}}
+                <td{{if not .InMonth}} class="outside"{{end}}>
+                    <a href="{{.URL}}">{{.Day}}</a>
+                    <div class="hours">
+                        {{$day := .URL}}{{range .Hours}}<a class="{{.Status}}" href="{{$day}}" title="{{.Label}} {{.Status}}{{if .Details}}: {{.Details}}{{end}}"></a>{{end}}
+                    </div>
+                </td>
+                {{end}}
+            </tr>
+            {{end}}
+        </tbody>
+    </table>
+</body>
+</html>{{end}}
+
+{{define "day"}}{{template "head" .}}
+    <nav><a href="{{.Previous}}">&larr; previous</a><a href="{{.Next}}">next &rarr;</a><a href="{{.Month}}">month</a></nav>
+    <table class="day">
+        <thead>
+            <tr><th></th><th>Hour</th><th>Status</th><th>Metadata and issues</th><th></th></tr>
+        </thead>
+        <tbody>
+            {{range .Hours}}
+            <tr title="{{.Details}}">
+                <td class="slot {{.Status}}"></td>
+                <td>{{.Label}}</td>
+                <td class="time">{{.Status}}</td>
+                <td class="details">{{.Details}}</td>
+                <td>{{if .PlayURL}}<a href="{{.PlayURL}}">play</a> <a href="{{.DownloadURL}}" download>download</a>{{end}}</td>
+            </tr>
+            {{end}}
+        </tbody>
+    </table>
+</body>
+</html>{{end}}`
+
+	t, err := template.New("calendar").Parse(tmpl)
+	if err != nil {
+		panic(fmt.Sprintf("template parse error: %v", err))
+	}
+	return t
+})
@@ -0,0 +1,107 @@
+package tier
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/archive"
+	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
+)
+
+// localTier stores recordings in a directory, typically on a NAS mount.
+type localTier struct {
+	root string
+}
+
+func (t *localTier) fsPath(p string) string {
+	return filepath.Join(t.root, filepath.FromSlash(path.Clean("/"+p)))
+}
+
+// List returns the files stored for a station, including those in the
+// subdirectories of the layout.
+func (t *localTier) List(_ context.Context, station string) ([]archive.File, error) {
+	files, err := archive.ScanFiles(t.root, station)
+	if err != nil {
+		return nil, err
+	}
+	for i, file := range files {
+		rel, err := filepath.Rel(t.root, file.Path)
+		if err != nil {
+			return nil, err
+		}
+		files[i].Path = filepath.ToSlash(rel)
+	}
+	return files, nil
+}
+
+// Store copies a local file into the tier. The copy is written to a temporary
+// file and renamed, so a partial copy never appears under the final name.
+func (t *localTier) Store(_ context.Context, p, localFile string) error {
+	dest := t.fsPath(p)
+	if err := utils.EnsureDir(filepath.Dir(dest)); err != nil {
+		return err
+	}
+
+	src, err := os.Open(localFile) //nolint:gosec // G304: path is a recording inside the recordings directory
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".archive-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := io.Copy(tmp, src); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("copy to %s: %w", dest, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), constants.FilePermissions); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+// ReadFile returns the content of a file in the tier.
+func (t *localTier) ReadFile(_ context.Context, p string) ([]byte, error) {
+	return os.ReadFile(t.fsPath(p))
+}
+
+// Open returns a reader for a file in the tier.
+func (t *localTier) Open(_ context.Context, p string) (io.ReadCloser, error) {
+	return os.Open(t.fsPath(p))
+}
+
+// Remove deletes a file from the tier.
+func (t *localTier) Remove(_ context.Context, p string) error {
+	return os.Remove(t.fsPath(p))
+}
+
+// Serve writes a file from the tier to the response.
+func (t *localTier) Serve(w http.ResponseWriter, r *http.Request, p string) error {
+	fsPath := t.fsPath(p)
+	info, err := os.Stat(fsPath)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory: %w", p, os.ErrNotExist)
+	}
+	http.ServeFile(w, r, fsPath)
+	return nil
+}
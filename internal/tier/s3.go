@@ -0,0 +1,119 @@
+package tier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/archive"
+	"github.com/oszuidwest/zwfm-audiologger/internal/objectstore"
+	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
+)
+
+// maxReadFileBytes bounds ReadFile, which is only meant for sidecars.
+const maxReadFileBytes = 16 << 20
+
+// forwardedRequestHeaders are passed from the client to the object store so
+// that seeking and caching work as they do for local files.
+var forwardedRequestHeaders = []string{"Range", "If-Range", "If-None-Match", "If-Modified-Since"}
+
+// forwardedResponseHeaders are passed from the object store to the client.
+var forwardedResponseHeaders = []string{"Content-Length", "Content-Range", "Accept-Ranges", "ETag", "Last-Modified"}
+
+// s3Tier stores recordings in an S3-compatible bucket under an optional prefix.
+type s3Tier struct {
+	client *objectstore.Client
+	prefix string
+}
+
+// List returns the files stored for a station.
+func (t *s3Tier) List(ctx context.Context, station string) ([]archive.File, error) {
+	objects, err := t.client.List(ctx, t.prefix+station+"/")
+	if err != nil {
+		return nil, err
+	}
+	files := make([]archive.File, 0, len(objects))
+	for _, obj := range objects {
+		files = append(files, archive.File{
+			Path:    strings.TrimPrefix(obj.Key, t.prefix),
+			Size:    obj.Size,
+			ModTime: obj.LastModified,
+		})
+	}
+	return files, nil
+}
+
+// Store uploads a local file into the bucket.
+func (t *s3Tier) Store(ctx context.Context, p, localFile string) error {
+	_, err := t.client.PutFile(ctx, t.prefix+p, localFile)
+	return err
+}
+
+// ReadFile downloads a small file from the bucket.
+func (t *s3Tier) ReadFile(ctx context.Context, p string) ([]byte, error) {
+	body, err := t.Open(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = body.Close() }()
+	return io.ReadAll(io.LimitReader(body, maxReadFileBytes))
+}
+
+// Open returns a reader streaming a file from the bucket.
+func (t *s3Tier) Open(ctx context.Context, p string) (io.ReadCloser, error) {
+	resp, err := t.client.Get(ctx, t.prefix+p, nil)
+	if err != nil {
+		return nil, mapNotFound(err)
+	}
+	return resp.Body, nil
+}
+
+// Remove deletes a file from the bucket.
+func (t *s3Tier) Remove(ctx context.Context, p string) error {
+	return t.client.Delete(ctx, t.prefix+p)
+}
+
+// Serve proxies a file from the bucket to the response.
+func (t *s3Tier) Serve(w http.ResponseWriter, r *http.Request, p string) error {
+	header := make(http.Header)
+	for _, name := range forwardedRequestHeaders {
+		if value := r.Header.Get(name); value != "" {
+			header.Set(name, value)
+		}
+	}
+
+	resp, err := t.client.Get(r.Context(), t.prefix+p, header)
+	if err != nil {
+		return mapNotFound(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// Objects are stored without a content type, so it follows from the
+	// extension unless the caller set one, as http.ServeFile does.
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", utils.ContentType(path.Ext(p)))
+	}
+	for _, name := range forwardedResponseHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			w.Header().Set(name, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	if r.Method != http.MethodHead {
+		_, _ = io.Copy(w, resp.Body)
+	}
+	return nil
+}
+
+// mapNotFound converts a missing object into os.ErrNotExist.
+func mapNotFound(err error) error {
+	if errors.Is(err, objectstore.ErrNotFound) {
+		return fmt.Errorf("%w: %w", os.ErrNotExist, err)
+	}
+	return err
+}
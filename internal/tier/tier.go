@@ -0,0 +1,124 @@
+// Package tier moves older recordings from the recordings directory to
+// secondary storage, either another local path or an S3-compatible bucket.
+package tier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/archive"
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+	"github.com/oszuidwest/zwfm-audiologger/internal/objectstore"
+	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
+)
+
+// Tier is secondary storage for recordings. Paths are relative to the tier
+// root and follow the station/file layout of the recordings directory.
+type Tier interface {
+	// List returns the files stored for a station.
+	List(ctx context.Context, station string) ([]archive.File, error)
+	// Store copies a local file into the tier.
+	Store(ctx context.Context, path, localFile string) error
+	// ReadFile returns the content of a small file such as a sidecar.
+	ReadFile(ctx context.Context, path string) ([]byte, error)
+	// Open returns a reader for a file of any size. The caller must close it.
+	Open(ctx context.Context, path string) (io.ReadCloser, error)
+	// Remove deletes a file from the tier.
+	Remove(ctx context.Context, path string) error
+	// Serve writes a file to the response, honouring range requests. It
+	// returns an error wrapping os.ErrNotExist if the file is not in the tier.
+	Serve(w http.ResponseWriter, r *http.Request, path string) error
+}
+
+// MoveObserver is notified of every recording that Move stored in the tier and
+// removed from the recordings directory.
+type MoveObserver interface {
+	RecordingMoved(station, timestamp string)
+}
+
+// New creates the tier described by the configuration.
+func New(cfg *config.ArchiveTierConfig) (Tier, error) {
+	switch {
+	case cfg.S3 != nil && cfg.Path != "":
+		return nil, errors.New("archive tier must have either a path or s3 settings, not both")
+	case cfg.S3 != nil:
+		client, err := objectstore.New(cfg.S3)
+		if err != nil {
+			return nil, err
+		}
+		return &s3Tier{client: client, prefix: cfg.S3.Prefix}, nil
+	case cfg.Path != "":
+		return &localTier{root: cfg.Path}, nil
+	default:
+		return nil, errors.New("archive tier needs a path or s3 settings")
+	}
+}
+
+// Move moves recordings older than after_days, with all their sidecars, from
+// the recordings directory to the tier. A recording is only removed locally
+// after every one of its files has been stored, and then reported to the
+// observers.
+func Move(ctx context.Context, cfg *config.Config, t Tier, now time.Time, observers ...MoveObserver) int {
+	cutoff := now.AddDate(0, 0, -cfg.ArchiveTier.AfterDays)
+	slog.Info("Moving recordings to archive tier", "cutoff_date", cutoff.Format(time.DateOnly))
+
+	moved := 0
+	for station := range cfg.Stations {
+		recordings, err := archive.Scan(cfg.RecordingsDir, station)
+		if err != nil {
+			slog.Error("failed to read station directory", "station", station, "error", err)
+			continue
+		}
+
+		for _, rec := range recordings {
+			if ctx.Err() != nil {
+				return moved
+			}
+			if !rec.Time.Before(cutoff) || rec.InProgress() {
+				continue
+			}
+			if err := moveRecording(ctx, t, cfg.RecordingsDir, rec.Files); err != nil {
+				slog.Error("failed to move recording to archive tier",
+					"station", station, "timestamp", rec.Timestamp, "error", err)
+				continue
+			}
+			for _, o := range observers {
+				o.RecordingMoved(station, rec.Timestamp)
+			}
+			moved++
+		}
+	}
+
+	slog.Info("Finished moving recordings to archive tier", "moved_recordings", moved)
+	return moved
+}
+
+// moveRecording stores all files of one recording under their path relative to
+// the recordings directory and then removes them locally.
+func moveRecording(ctx context.Context, t Tier, recordingsDir string, files []string) error {
+	for _, file := range files {
+		rel, err := filepath.Rel(recordingsDir, file)
+		if err != nil {
+			return err
+		}
+		if err := t.Store(ctx, filepath.ToSlash(rel), file); err != nil {
+			return fmt.Errorf("store %s: %w", file, err)
+		}
+	}
+	for _, file := range files {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove %s after archiving: %w", file, err)
+		}
+	}
+	if len(files) > 0 {
+		utils.RemoveEmptyDirs(recordingsDir, files[0])
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package tier
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+)
+
+func TestMoveToLocalTier(t *testing.T) {
+	recordingsDir := t.TempDir()
+	tierDir := t.TempDir()
+	now := time.Date(2026, 5, 31, 12, 30, 0, 0, time.UTC)
+
+	cfg := &config.Config{
+		RecordingsDir: recordingsDir,
+		Stations:      map[string]config.Station{"station": {}},
+		ArchiveTier:   &config.ArchiveTierConfig{Enabled: true, AfterDays: 7, Path: tierDir},
+	}
+	archiveTier, err := New(cfg.ArchiveTier)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	files := map[string]bool{
+		// Older than after_days: moved with its sidecars.
+		"2026-05-20-10.mp3":  true,
+		"2026-05-20-10.meta": true,
+		// Recent: stays on fast storage.
+		"2026-05-30-10.mp3": false,
+		// Interrupted capture: never moved.
+		"2026-05-01-10.mkv": false,
+	}
+	for name := range files {
+		path := filepath.Join(recordingsDir, "station", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if moved := Move(context.Background(), cfg, archiveTier, now); moved != 1 {
+		t.Errorf("Move = %d, want 1", moved)
+	}
+
+	for name, wantMoved := range files {
+		_, localErr := os.Stat(filepath.Join(recordingsDir, "station", name))
+		_, tierErr := os.Stat(filepath.Join(tierDir, "station", name))
+		if moved := localErr != nil && tierErr == nil; moved != wantMoved {
+			t.Errorf("%s moved = %v, want %v", name, moved, wantMoved)
+		}
+	}
+
+	listed, err := archiveTier.List(context.Background(), "station")
+	if err != nil || len(listed) != 2 {
+		t.Fatalf("List = %v, %v, want 2 files", listed, err)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/recordings/station/2026-05-20-10.mp3", http.NoBody)
+	if err := archiveTier.Serve(rec, req, "station/2026-05-20-10.mp3"); err != nil {
+		t.Fatalf("Serve returned error: %v", err)
+	}
+	if rec.Body.String() != "2026-05-20-10.mp3" {
+		t.Errorf("Serve body = %q", rec.Body.String())
+	}
+
+	err = archiveTier.Serve(httptest.NewRecorder(), req, "station/missing.mp3")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Serve missing file error = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestNewRejectsAmbiguousTier(t *testing.T) {
+	cfg := &config.ArchiveTierConfig{Path: "/mnt/nas", S3: &config.S3Config{Endpoint: "http://minio:9000", Bucket: "audio"}}
+	if _, err := New(cfg); err == nil {
+		t.Error("New returned nil error for a tier with both a path and s3 settings")
+	}
+	if _, err := New(&config.ArchiveTierConfig{}); err == nil {
+		t.Error("New returned nil error for a tier without a target")
+	}
+}
+
+func TestS3TierServeSetsContentType(t *testing.T) {
+	bucket := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bucket/archive/station/2026-05-20-10.mp3" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "binary/octet-stream")
+		w.Header().Set("ETag", `"abc"`)
+		_, _ = w.Write([]byte("audio"))
+	}))
+	defer bucket.Close()
+
+	archiveTier, err := New(&config.ArchiveTierConfig{S3: &config.S3Config{
+		Endpoint: bucket.URL, Bucket: "bucket", Prefix: "archive/", AccessKey: "key", SecretKey: "secret",
+	}})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/recordings/station/2026-05-20-10.mp3", http.NoBody)
+	if err := archiveTier.Serve(rec, req, "station/2026-05-20-10.mp3"); err != nil {
+		t.Fatalf("Serve returned error: %v", err)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "audio/mpeg" {
+		t.Errorf("Content-Type = %q, want audio/mpeg", got)
+	}
+	if got := rec.Header().Get("ETag"); got != `"abc"` || rec.Body.String() != "audio" {
+		t.Errorf("ETag = %q, body = %q", got, rec.Body.String())
+	}
+}
@@ -0,0 +1,416 @@
+package tsa
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	_ "crypto/sha256" // Registers SHA-256 for crypto.Hash.
+	_ "crypto/sha512" // Registers SHA-384 and SHA-512 for crypto.Hash.
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Object identifiers from RFC 3161, RFC 5652 and RFC 5754.
+var (
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidRSAPSS        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+)
+
+// Signature algorithms by key type and digest. CMS usually names only the key
+// type, such as rsaEncryption, and gives the digest separately.
+var (
+	rsaAlgorithms = map[crypto.Hash]x509.SignatureAlgorithm{
+		crypto.SHA256: x509.SHA256WithRSA,
+		crypto.SHA384: x509.SHA384WithRSA,
+		crypto.SHA512: x509.SHA512WithRSA,
+	}
+	rsaPSSAlgorithms = map[crypto.Hash]x509.SignatureAlgorithm{
+		crypto.SHA256: x509.SHA256WithRSAPSS,
+		crypto.SHA384: x509.SHA384WithRSAPSS,
+		crypto.SHA512: x509.SHA512WithRSAPSS,
+	}
+	ecdsaAlgorithms = map[crypto.Hash]x509.SignatureAlgorithm{
+		crypto.SHA256: x509.ECDSAWithSHA256,
+		crypto.SHA384: x509.ECDSAWithSHA384,
+		crypto.SHA512: x509.ECDSAWithSHA512,
+	}
+)
+
+// maxResponseBytes limits the size of a TSA response.
+const maxResponseBytes = 1 << 20
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	// Content is the [0] EXPLICIT wrapper. encoding/asn1 does not unwrap
+	// explicit tags for raw values, so its Bytes hold the inner value.
+	Content asn1.RawValue `asn1:"tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time     `asn1:"generalized"`
+	Accuracy       accuracy      `asn1:"optional"`
+	Ordering       bool          `asn1:"optional"`
+	Nonce          *big.Int      `asn1:"optional"`
+	TSA            asn1.RawValue `asn1:"optional,tag:0"`
+	Extensions     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// Info describes a verified timestamp token.
+type Info struct {
+	GenTime      time.Time
+	SerialNumber *big.Int
+	Policy       string
+	Signer       string
+	nonce        *big.Int
+}
+
+// Client requests timestamp tokens from a TSA over HTTP.
+type Client struct {
+	url      string
+	username string
+	password string
+	roots    *x509.CertPool
+	http     *http.Client
+}
+
+// Timestamp requests a token for a SHA-256 digest. It returns the DER-encoded
+// TimeStampResp, after checking that the token covers the digest and is
+// signed by the TSA certificate it contains.
+func (c *Client) Timestamp(ctx context.Context, digest []byte) ([]byte, error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	body, err := asn1.Marshal(timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+			HashedMessage: digest,
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/timestamp-query")
+	req.Header.Set("Accept", "application/timestamp-reply")
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+		return nil, fmt.Errorf("tsa returned http status %s", resp.Status)
+	}
+	reply, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) > maxResponseBytes {
+		return nil, fmt.Errorf("tsa response exceeds %d bytes", maxResponseBytes)
+	}
+
+	info, err := Verify(reply, digest, c.roots)
+	if err != nil {
+		return nil, err
+	}
+	if info.nonce == nil || info.nonce.Cmp(nonce) != 0 {
+		return nil, errors.New("tsa response nonce does not match the request")
+	}
+	return reply, nil
+}
+
+// Verify checks that a stored TimeStampResp covers the SHA-256 digest and is
+// validly signed. With roots set, the TSA certificate must also chain to one
+// of them and be valid for timestamping at the time of the token.
+func Verify(response, digest []byte, roots *x509.CertPool) (*Info, error) {
+	token, err := parseResponse(response)
+	if err != nil {
+		return nil, err
+	}
+
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(token, &ci); err != nil {
+		return nil, fmt.Errorf("parse token: %w", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("token has content type %s, want signed data", ci.ContentType)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("parse signed data: %w", err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, fmt.Errorf("token has content type %s, want TSTInfo", sd.EncapContentInfo.EContentType)
+	}
+
+	var tst tstInfo
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent, &tst); err != nil {
+		return nil, fmt.Errorf("parse TSTInfo: %w", err)
+	}
+	if !tst.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) {
+		return nil, fmt.Errorf("token uses hash algorithm %s, want SHA-256", tst.MessageImprint.HashAlgorithm.Algorithm)
+	}
+	if !bytes.Equal(tst.MessageImprint.HashedMessage, digest) {
+		return nil, errors.New("token does not match the file hash")
+	}
+
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("token has %d signers, want 1", len(sd.SignerInfos))
+	}
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse token certificates: %w", err)
+	}
+	si := sd.SignerInfos[0]
+	cert, err := signerCertificate(si, certs)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSignature(si, cert, sd.EncapContentInfo.EContent); err != nil {
+		return nil, err
+	}
+
+	if roots != nil {
+		intermediates := x509.NewCertPool()
+		for _, c := range certs {
+			intermediates.AddCert(c)
+		}
+		_, err := cert.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   tst.GenTime,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("tsa certificate not trusted: %w", err)
+		}
+	}
+
+	return &Info{
+		GenTime:      tst.GenTime,
+		SerialNumber: tst.SerialNumber,
+		Policy:       tst.Policy.String(),
+		Signer:       cert.Subject.String(),
+		nonce:        tst.Nonce,
+	}, nil
+}
+
+// parseResponse returns the token from a TimeStampResp, or an error if the TSA
+// did not grant the request.
+func parseResponse(data []byte) ([]byte, error) {
+	var resp timeStampResp
+	rest, err := asn1.Unmarshal(data, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("parse tsa response: %w", err)
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("parse tsa response: trailing data")
+	}
+	// Status 0 is granted and 1 is granted with modifications.
+	if resp.Status.Status > 1 {
+		msg := fmt.Sprintf("tsa rejected the request with status %d", resp.Status.Status)
+		if len(resp.Status.StatusString) > 0 {
+			msg += ": " + strings.Join(resp.Status.StatusString, "; ")
+		}
+		return nil, errors.New(msg)
+	}
+	if len(resp.TimeStampToken.FullBytes) == 0 {
+		return nil, errors.New("tsa response contains no token")
+	}
+	return resp.TimeStampToken.FullBytes, nil
+}
+
+// signerCertificate finds the certificate identified by the signer's issuer and
+// serial number.
+func signerCertificate(si signerInfo, certs []*x509.Certificate) (*x509.Certificate, error) {
+	var sid issuerAndSerialNumber
+	if _, err := asn1.Unmarshal(si.SID.FullBytes, &sid); err != nil {
+		return nil, fmt.Errorf("unsupported signer identifier: %w", err)
+	}
+	for _, cert := range certs {
+		if bytes.Equal(cert.RawIssuer, sid.Issuer.FullBytes) && cert.SerialNumber.Cmp(sid.SerialNumber) == 0 {
+			return cert, nil
+		}
+	}
+	return nil, errors.New("token does not include the tsa certificate")
+}
+
+// checkSignature verifies the signed attributes of a signer and that they
+// cover the content.
+func checkSignature(si signerInfo, cert *x509.Certificate, content []byte) error {
+	hash, err := hashFor(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	if len(si.SignedAttrs.FullBytes) == 0 {
+		return errors.New("token has no signed attributes")
+	}
+
+	// The signature covers the attributes encoded as a SET, not with the
+	// implicit [0] tag they carry inside SignerInfo.
+	signed := append([]byte{0x31}, si.SignedAttrs.FullBytes[1:]...)
+	var attrs []attribute
+	if _, err := asn1.UnmarshalWithParams(signed, &attrs, "set"); err != nil {
+		return fmt.Errorf("parse signed attributes: %w", err)
+	}
+
+	var contentType asn1.ObjectIdentifier
+	var messageDigest []byte
+	for _, attr := range attrs {
+		switch {
+		case attr.Type.Equal(oidContentType):
+			_, err = asn1.Unmarshal(attr.Values.Bytes, &contentType)
+		case attr.Type.Equal(oidMessageDigest):
+			_, err = asn1.Unmarshal(attr.Values.Bytes, &messageDigest)
+		}
+		if err != nil {
+			return fmt.Errorf("parse signed attribute %s: %w", attr.Type, err)
+		}
+	}
+	if !contentType.Equal(oidTSTInfo) {
+		return errors.New("signed content type is not TSTInfo")
+	}
+	h := hash.New()
+	h.Write(content)
+	if !bytes.Equal(h.Sum(nil), messageDigest) {
+		return errors.New("signed message digest does not match the token content")
+	}
+
+	algorithm, err := signatureAlgorithm(cert, hash, si.SignatureAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	if err := cert.CheckSignature(algorithm, signed, si.Signature); err != nil {
+		return fmt.Errorf("token signature invalid: %w", err)
+	}
+	return nil
+}
+
+func hashFor(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, nil
+	default:
+		return 0, fmt.Errorf("unsupported digest algorithm %s", oid)
+	}
+}
+
+// signatureAlgorithm returns the x509 algorithm for a signer's key and digest.
+func signatureAlgorithm(cert *x509.Certificate, hash crypto.Hash, sigOID asn1.ObjectIdentifier) (x509.SignatureAlgorithm, error) {
+	var algorithms map[crypto.Hash]x509.SignatureAlgorithm
+	switch cert.PublicKeyAlgorithm {
+	case x509.Ed25519:
+		return x509.PureEd25519, nil
+	case x509.RSA:
+		algorithms = rsaAlgorithms
+		if sigOID.Equal(oidRSAPSS) {
+			algorithms = rsaPSSAlgorithms
+		}
+	case x509.ECDSA:
+		algorithms = ecdsaAlgorithms
+	}
+	if algorithm, ok := algorithms[hash]; ok {
+		return algorithm, nil
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported signature algorithm %s with %s key", sigOID, cert.PublicKeyAlgorithm)
+}
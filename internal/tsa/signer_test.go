@@ -0,0 +1,170 @@
+package tsa
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testSigner is an offline stand-in TSA that issues RFC 3161 tokens signed
+// with a self-signed ECDSA certificate.
+type testSigner struct {
+	key    *ecdsa.PrivateKey
+	cert   *x509.Certificate
+	serial atomic.Int64
+	fail   atomic.Bool // Rejects requests with HTTP 503 while set.
+	now    time.Time
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 4, 30, 23, 0, 5, 0, time.UTC)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test TSA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testSigner{key: key, cert: cert, now: now}
+}
+
+// roots returns a pool trusting the signer's certificate.
+func (s *testSigner) roots() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(s.cert)
+	return pool
+}
+
+func (s *testSigner) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.fail.Load() {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req timeStampReq
+	if _, err := asn1.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, err := s.respond(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/timestamp-reply")
+	_, _ = w.Write(resp)
+}
+
+// respond builds a granted TimeStampResp for a request.
+func (s *testSigner) respond(req timeStampReq) ([]byte, error) {
+	tst, err := asn1.Marshal(tstInfo{
+		Version:        1,
+		Policy:         asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1},
+		MessageImprint: req.MessageImprint,
+		SerialNumber:   big.NewInt(s.serial.Add(1)),
+		GenTime:        s.now,
+		Nonce:          req.Nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	contentType, err := asn1.Marshal(oidTSTInfo)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(tst)
+	digest, err := asn1.Marshal(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := asn1.MarshalWithParams([]attribute{
+		{Type: oidContentType, Values: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: contentType}},
+		{Type: oidMessageDigest, Values: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: digest}},
+	}, "set")
+	if err != nil {
+		return nil, err
+	}
+	attrsDigest := sha256.Sum256(attrs)
+	signature, err := s.key.Sign(rand.Reader, attrsDigest[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	sid, err := asn1.Marshal(issuerAndSerialNumber{
+		Issuer:       asn1.RawValue{FullBytes: s.cert.RawIssuer},
+		SerialNumber: s.cert.SerialNumber,
+	})
+	if err != nil {
+		return nil, err
+	}
+	implicitAttrs := append([]byte{0xa0}, attrs[1:]...)
+	sha256ID := pkix.AlgorithmIdentifier{Algorithm: oidSHA256}
+
+	sd, err := asn1.Marshal(signedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256ID},
+		EncapContentInfo: encapsulatedContentInfo{EContentType: oidTSTInfo, EContent: tst},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: s.cert.Raw},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			SID:                asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm:    sha256ID,
+			SignedAttrs:        asn1.RawValue{FullBytes: implicitAttrs},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+			Signature:          signature,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	token, err := asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(timeStampResp{TimeStampToken: asn1.RawValue{FullBytes: token}})
+}
+
+// startTestSigner serves the signer over HTTP for the duration of the test.
+func startTestSigner(t *testing.T) (*testSigner, *httptest.Server) {
+	t.Helper()
+	signer := newTestSigner(t)
+	server := httptest.NewServer(signer)
+	t.Cleanup(server.Close)
+	return signer, server
+}
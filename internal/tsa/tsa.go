@@ -0,0 +1,356 @@
+// Package tsa obtains RFC 3161 timestamp tokens for finished recordings from a
+// trusted timestamping authority, using a persistent queue that survives
+// restarts and retries without delaying recording.
+package tsa
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/archive"
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+	"github.com/oszuidwest/zwfm-audiologger/internal/recorder"
+	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
+)
+
+// Compile-time interface check.
+var _ recorder.FileObserver = (*Manager)(nil)
+
+// Job is a recording waiting for a timestamp token.
+type Job struct {
+	Station     string    `json:"station"`
+	Timestamp   string    `json:"timestamp"`
+	Path        string    `json:"path"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// Status summarizes the timestamp queue for the status endpoint.
+type Status struct {
+	Queued    int       `json:"queued"`
+	Failing   int       `json:"failing"`
+	Stamped   int64     `json:"stamped"`
+	Failures  int64     `json:"failures"`
+	LastStamp time.Time `json:"last_stamp,omitzero"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Manager requests timestamp tokens for finished recordings.
+type Manager struct {
+	client    *Client
+	queuePath string
+	wake      chan struct{}
+	observers []recorder.FileObserver
+
+	mu     sync.Mutex
+	jobs   []Job
+	status Status
+}
+
+// New creates a timestamp manager and loads any queue left by a previous run.
+func New(cfg *config.Config) (*Manager, error) {
+	client, err := NewClient(cfg.Timestamping)
+	if err != nil {
+		return nil, err
+	}
+	if err := utils.EnsureDir(cfg.StateDir); err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		client:    client,
+		queuePath: filepath.Join(cfg.StateDir, constants.TimestampQueueFile),
+		wake:      make(chan struct{}, 1),
+	}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	if len(m.jobs) > 0 {
+		slog.Info("Resuming timestamp queue", "queued", len(m.jobs))
+	}
+	return m, nil
+}
+
+// NewClient creates a TSA client from the configuration.
+func NewClient(cfg *config.TimestampConfig) (*Client, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("timestamping requires a tsa url")
+	}
+	roots, err := LoadRoots(cfg.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		url:      cfg.URL,
+		username: cfg.Username,
+		password: cfg.Password,
+		roots:    roots,
+		http:     &http.Client{Timeout: constants.TimestampRequestTimeout},
+	}, nil
+}
+
+// LoadRoots reads a PEM bundle of trusted TSA roots. An empty path returns nil,
+// which means only token signatures are checked.
+func LoadRoots(path string) (*x509.CertPool, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path) //nolint:gosec // G304: path comes from the configuration
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tsa ca_file: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("tsa ca_file %s contains no certificates", path)
+	}
+	return roots, nil
+}
+
+// TokenPath returns the path of the timestamp response stored for a recording.
+func TokenPath(recording string) string {
+	stem, _ := archive.SplitName(filepath.Base(recording))
+	return filepath.Join(filepath.Dir(recording), stem+constants.TimestampFileSuffix)
+}
+
+// VerifyFile checks the stored timestamp response of a recording against the
+// current content of the recording.
+func VerifyFile(recording string, roots *x509.CertPool) (*Info, error) {
+	response, err := os.ReadFile(TokenPath(recording))
+	if err != nil {
+		return nil, err
+	}
+	digest, err := hashFile(recording)
+	if err != nil {
+		return nil, err
+	}
+	return Verify(response, digest, roots)
+}
+
+// AddObserver registers an observer for the timestamp responses the manager
+// writes. It must be called before Start.
+func (m *Manager) AddObserver(o recorder.FileObserver) {
+	m.observers = append(m.observers, o)
+}
+
+// load reads the persistent queue. A missing file means an empty queue.
+func (m *Manager) load() error {
+	data, err := os.ReadFile(m.queuePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read timestamp queue: %w", err)
+	}
+	if err := json.Unmarshal(data, &m.jobs); err != nil {
+		return fmt.Errorf("failed to parse timestamp queue %s: %w", m.queuePath, err)
+	}
+	return nil
+}
+
+// persist writes the queue to disk. The caller must hold m.mu.
+func (m *Manager) persist() {
+	data, err := json.MarshalIndent(m.jobs, "", "  ")
+	if err == nil {
+		err = utils.WriteFileAtomic(m.queuePath, data)
+	}
+	if err != nil {
+		slog.Error("failed to save timestamp queue", "file", m.queuePath, "error", err)
+	}
+}
+
+// FileCompleted queues a finished recording for timestamping. Sidecars are
+// ignored.
+func (m *Manager) FileCompleted(station, timestamp, path string) {
+	if !utils.IsAudioFile(path) {
+		return
+	}
+
+	m.mu.Lock()
+	m.jobs = append(m.jobs, Job{Station: station, Timestamp: timestamp, Path: path})
+	m.persist()
+	m.mu.Unlock()
+
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Status returns a snapshot of the timestamp queue for the status endpoint.
+func (m *Manager) Status() any {
+	return m.snapshot()
+}
+
+// snapshot returns the current timestamp statistics.
+func (m *Manager) snapshot() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := m.status
+	status.Queued = len(m.jobs)
+	for _, job := range m.jobs {
+		if job.Attempts > 0 {
+			status.Failing++
+		}
+	}
+	return status
+}
+
+// WriteMetrics writes the timestamp metrics in Prometheus text format.
+func (m *Manager) WriteMetrics(w io.Writer) {
+	status := m.snapshot()
+	utils.WriteMetric(w, "audiologger_timestamp_queue_length", "gauge", "Recordings waiting for a timestamp token.", float64(status.Queued))
+	utils.WriteMetric(w, "audiologger_timestamp_failing", "gauge", "Queued recordings whose last timestamp request failed.", float64(status.Failing))
+	utils.WriteMetric(w, "audiologger_timestamps_total", "counter", "Timestamp tokens obtained.", float64(status.Stamped))
+	utils.WriteMetric(w, "audiologger_timestamp_failures_total", "counter", "Failed timestamp requests.", float64(status.Failures))
+}
+
+// Start processes the queue until the context is cancelled.
+func (m *Manager) Start(ctx context.Context) error {
+	slog.Info("Timestamping started")
+	for {
+		job, wait, ok := m.next()
+		if ok {
+			m.process(ctx, job)
+			continue
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			slog.Info("Timestamping shutting down")
+			return nil
+		case <-m.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// next returns the first job that is due. When none is due it returns how long
+// to wait for the earliest retry.
+func (m *Manager) next() (Job, time.Duration, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	wait := constants.TimestampRetryMaxWait
+	for _, job := range m.jobs {
+		if !job.NextAttempt.After(now) {
+			return job, 0, true
+		}
+		wait = min(wait, job.NextAttempt.Sub(now))
+	}
+	return Job{}, wait, false
+}
+
+// process obtains a token for one job and updates the queue with the outcome.
+func (m *Manager) process(ctx context.Context, job Job) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("panic in timestamping", "file", job.Path, "panic", r, "stack", string(debug.Stack()))
+		}
+	}()
+
+	tokenPath, err := m.stamp(ctx, job)
+	if ctx.Err() != nil {
+		return // Shutting down; the job stays queued.
+	}
+
+	m.mu.Lock()
+	switch {
+	case err == nil:
+		slog.Info("Timestamped recording", "file", job.Path, "token", tokenPath)
+		m.status.Stamped++
+		m.status.LastStamp = time.Now()
+		m.removeJob(job)
+	case errors.Is(err, os.ErrNotExist):
+		slog.Warn("recording removed before timestamping, dropping from queue", "file", job.Path)
+		m.removeJob(job)
+	default:
+		job.Attempts++
+		wait := min(constants.TimestampRetryInitialWait<<min(job.Attempts-1, 16), constants.TimestampRetryMaxWait)
+		job.NextAttempt = time.Now().Add(wait)
+		job.LastError = err.Error()
+		slog.Error("timestamp request failed, will retry", "file", job.Path, "attempt", job.Attempts, "retry_in", wait, "error", err)
+		m.status.Failures++
+		m.status.LastError = err.Error()
+		m.replaceJob(job)
+	}
+	m.persist()
+	m.mu.Unlock()
+
+	if err == nil {
+		for _, o := range m.observers {
+			o.FileCompleted(job.Station, job.Timestamp, tokenPath)
+		}
+	}
+}
+
+// stamp hashes the recording, requests a token and stores the response next
+// to the recording.
+func (m *Manager) stamp(ctx context.Context, job Job) (string, error) {
+	digest, err := hashFile(job.Path)
+	if err != nil {
+		return "", err
+	}
+	response, err := m.client.Timestamp(ctx, digest)
+	if err != nil {
+		return "", err
+	}
+	tokenPath := TokenPath(job.Path)
+	if err := utils.WriteFileAtomic(tokenPath, response); err != nil {
+		return "", err
+	}
+	return tokenPath, nil
+}
+
+// removeJob drops a job from the queue. The caller must hold m.mu.
+func (m *Manager) removeJob(job Job) {
+	for i, j := range m.jobs {
+		if j.Path == job.Path {
+			m.jobs = append(m.jobs[:i], m.jobs[i+1:]...)
+			return
+		}
+	}
+}
+
+// replaceJob updates a queued job in place. The caller must hold m.mu.
+func (m *Manager) replaceJob(job Job) {
+	for i, j := range m.jobs {
+		if j.Path == job.Path {
+			m.jobs[i] = job
+			return
+		}
+	}
+}
+
+// hashFile returns the SHA-256 digest of a file.
+func hashFile(path string) ([]byte, error) {
+	file, err := os.Open(path) //nolint:gosec // G304: path is a recording inside the recordings directory
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,113 @@
+package tsa
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+)
+
+func TestTimestampAndVerify(t *testing.T) {
+	signer, server := startTestSigner(t)
+	client, err := NewClient(&config.TimestampConfig{URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("recording"))
+
+	response, err := client.Timestamp(context.Background(), digest[:])
+	if err != nil {
+		t.Fatalf("Timestamp returned error: %v", err)
+	}
+
+	info, err := Verify(response, digest[:], signer.roots())
+	if err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if !info.GenTime.Equal(signer.now) || info.Signer != "CN=Test TSA" {
+		t.Errorf("info = %+v, want time %s signed by CN=Test TSA", info, signer.now)
+	}
+
+	other := sha256.Sum256([]byte("edited recording"))
+	if _, err := Verify(response, other[:], nil); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("Verify with a different hash returned %v, want a mismatch", err)
+	}
+
+	tampered := append([]byte(nil), response...)
+	tampered[len(tampered)-1] ^= 0xff
+	if _, err := Verify(tampered, digest[:], nil); err == nil {
+		t.Error("Verify accepted a response with a modified signature")
+	}
+
+	if _, err := Verify(response, digest[:], newTestSigner(t).roots()); err == nil {
+		t.Error("Verify accepted a token from an untrusted TSA")
+	}
+}
+
+func TestQueueRetriesWithoutBlockingAndSurvivesRestart(t *testing.T) {
+	signer, server := startTestSigner(t)
+	signer.fail.Store(true)
+
+	dir := t.TempDir()
+	cfg := &config.Config{
+		StateDir:     filepath.Join(dir, ".audiologger"),
+		Timestamping: &config.TimestampConfig{Enabled: true, URL: server.URL},
+	}
+	recording := filepath.Join(dir, "station", "2026-04-30-22.mp3")
+	if err := os.MkdirAll(filepath.Dir(recording), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(recording, []byte("recording"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		first.FileCompleted("station", "2026-04-30-22", recording)
+		first.FileCompleted("station", "2026-04-30-22", filepath.Join(dir, "station", "2026-04-30-22.meta"))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("FileCompleted blocked")
+	}
+
+	job, _, ok := first.next()
+	if !ok {
+		t.Fatal("recording was not queued")
+	}
+	first.process(context.Background(), job)
+	if status := first.snapshot(); status.Queued != 1 || status.Failing != 1 {
+		t.Fatalf("status after failure = %+v, want one failing job and sidecars ignored", status)
+	}
+
+	// A new manager picks up the queue, as after a restart.
+	signer.fail.Store(false)
+	second, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	second.jobs[0].NextAttempt = time.Time{}
+	job, _, _ = second.next()
+	second.process(context.Background(), job)
+	if status := second.snapshot(); status.Queued != 0 || status.Stamped != 1 {
+		t.Fatalf("status after retry = %+v, want the job stamped", status)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "station", "2026-04-30-22.tsr")); err != nil {
+		t.Fatalf("token not stored next to the recording: %v", err)
+	}
+	if _, err := VerifyFile(recording, signer.roots()); err != nil {
+		t.Errorf("VerifyFile returned error: %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+// Package uploader copies finished recordings and their sidecars to an
+// S3-compatible bucket, using a persistent queue that survives restarts.
+package uploader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+	"github.com/oszuidwest/zwfm-audiologger/internal/objectstore"
+	"github.com/oszuidwest/zwfm-audiologger/internal/recorder"
+	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
+)
+
+// Compile-time interface check.
+var _ recorder.FileObserver = (*Manager)(nil)
+
+// Job is a file waiting to be uploaded.
+type Job struct {
+	Station     string    `json:"station"`
+	Path        string    `json:"path"`
+	Key         string    `json:"key"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// Status summarizes the upload queue for the status endpoint.
+type Status struct {
+	Queued        int       `json:"queued"`
+	Failing       int       `json:"failing"`
+	Uploaded      int64     `json:"uploaded"`
+	UploadedBytes int64     `json:"uploaded_bytes"`
+	Failures      int64     `json:"failures"`
+	LastUpload    time.Time `json:"last_upload,omitzero"`
+	LastError     string    `json:"last_error,omitempty"`
+}
+
+// Manager uploads files to the configured bucket.
+type Manager struct {
+	client        uploadClient
+	prefix        string
+	recordingsDir string
+	queuePath     string
+	wake          chan struct{}
+
+	mu     sync.Mutex
+	jobs   []Job
+	status Status
+}
+
+// uploadClient is the subset of the object store client used for uploads.
+type uploadClient interface {
+	PutFile(ctx context.Context, key, path string) (string, error)
+	Head(ctx context.Context, key string) (objectstore.Object, error)
+}
+
+// New creates an upload manager and loads any queue left by a previous run.
+func New(cfg *config.Config) (*Manager, error) {
+	if cfg.Upload.S3 == nil {
+		return nil, errors.New("upload requires s3 settings")
+	}
+	client, err := objectstore.New(cfg.Upload.S3)
+	if err != nil {
+		return nil, err
+	}
+	if err := utils.EnsureDir(cfg.StateDir); err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		client:        client,
+		prefix:        cfg.Upload.S3.Prefix,
+		recordingsDir: cfg.RecordingsDir,
+		queuePath:     filepath.Join(cfg.StateDir, constants.UploadQueueFile),
+		wake:          make(chan struct{}, 1),
+	}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	if len(m.jobs) > 0 {
+		slog.Info("Resuming upload queue", "queued", len(m.jobs))
+	}
+	return m, nil
+}
+
+// load reads the persistent queue. A missing file means an empty queue.
+func (m *Manager) load() error {
+	data, err := os.ReadFile(m.queuePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read upload queue: %w", err)
+	}
+	if err := json.Unmarshal(data, &m.jobs); err != nil {
+		return fmt.Errorf("failed to parse upload queue %s: %w", m.queuePath, err)
+	}
+	return nil
+}
+
+// persist writes the queue to disk. The caller must hold m.mu.
+func (m *Manager) persist() {
+	data, err := json.MarshalIndent(m.jobs, "", "  ")
+	if err == nil {
+		err = utils.WriteFileAtomic(m.queuePath, data)
+	}
+	if err != nil {
+		slog.Error("failed to save upload queue", "file", m.queuePath, "error", err)
+	}
+}
+
+// FileCompleted queues a finished recording or sidecar for upload. The key
+// follows the layout of the recordings directory.
+func (m *Manager) FileCompleted(station, _, filePath string) {
+	rel, err := filepath.Rel(m.recordingsDir, filePath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = filepath.Join(station, filepath.Base(filePath))
+	}
+	m.mu.Lock()
+	m.jobs = append(m.jobs, Job{
+		Station: station,
+		Path:    filePath,
+		Key:     m.prefix + filepath.ToSlash(rel),
+	})
+	m.persist()
+	m.mu.Unlock()
+
+	slog.Debug("queued for upload", "file", filePath)
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Status returns a snapshot of the upload queue for the status endpoint.
+func (m *Manager) Status() any {
+	return m.snapshot()
+}
+
+// snapshot returns the current upload statistics.
+func (m *Manager) snapshot() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := m.status
+	status.Queued = len(m.jobs)
+	for _, job := range m.jobs {
+		if job.Attempts > 0 {
+			status.Failing++
+		}
+	}
+	return status
+}
+
+// WriteMetrics writes the upload metrics in Prometheus text format.
+func (m *Manager) WriteMetrics(w io.Writer) {
+	status := m.snapshot()
+	utils.WriteMetric(w, "audiologger_upload_queue_length", "gauge", "Files waiting to be uploaded.", float64(status.Queued))
+	utils.WriteMetric(w, "audiologger_upload_failing", "gauge", "Queued files whose last upload attempt failed.", float64(status.Failing))
+	utils.WriteMetric(w, "audiologger_uploads_total", "counter", "Files uploaded successfully.", float64(status.Uploaded))
+	utils.WriteMetric(w, "audiologger_upload_bytes_total", "counter", "Bytes uploaded successfully.", float64(status.UploadedBytes))
+	utils.WriteMetric(w, "audiologger_upload_failures_total", "counter", "Failed upload attempts.", float64(status.Failures))
+}
+
+// Start processes the queue until the context is cancelled.
+func (m *Manager) Start(ctx context.Context) error {
+	slog.Info("Uploader started")
+	for {
+		job, wait, ok := m.next()
+		if ok {
+			m.process(ctx, job)
+			continue
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			slog.Info("Uploader shutting down")
+			return nil
+		case <-m.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// next returns the first job that is due. When none is due it returns how long
+// to wait for the earliest retry.
+func (m *Manager) next() (Job, time.Duration, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	wait := constants.UploadRetryMaxWait
+	for _, job := range m.jobs {
+		if !job.NextAttempt.After(now) {
+			return job, 0, true
+		}
+		wait = min(wait, job.NextAttempt.Sub(now))
+	}
+	return Job{}, wait, false
+}
+
+// process uploads one job and updates the queue with the outcome.
+func (m *Manager) process(ctx context.Context, job Job) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("panic in upload", "file", job.Path, "panic", r, "stack", string(debug.Stack()))
+		}
+	}()
+
+	size, err := m.upload(ctx, job)
+	if ctx.Err() != nil {
+		return // Shutting down; the job stays queued.
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch {
+	case err == nil:
+		slog.Info("Uploaded recording", "file", job.Path, "key", job.Key, "bytes", size)
+		m.status.Uploaded++
+		m.status.UploadedBytes += size
+		m.status.LastUpload = time.Now()
+		m.removeJob(job)
+	case errors.Is(err, os.ErrNotExist):
+		slog.Warn("file removed before upload, dropping from queue", "file", job.Path)
+		m.removeJob(job)
+	default:
+		job.Attempts++
+		wait := min(constants.UploadRetryInitialWait<<min(job.Attempts-1, 16), constants.UploadRetryMaxWait)
+		job.NextAttempt = time.Now().Add(wait)
+		job.LastError = err.Error()
+		slog.Error("upload failed, will retry", "file", job.Path, "attempt", job.Attempts, "retry_in", wait, "error", err)
+		m.status.Failures++
+		m.status.LastError = err.Error()
+		m.replaceJob(job)
+	}
+	m.persist()
+}
+
+// upload puts the file and verifies the stored object. The object store checks
+// the SHA-256 sent with the request, and the stored size is compared with the
+// local file afterwards.
+func (m *Manager) upload(ctx context.Context, job Job) (int64, error) {
+	info, err := os.Stat(job.Path)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := m.client.PutFile(ctx, job.Key, job.Path); err != nil {
+		return 0, err
+	}
+	obj, err := m.client.Head(ctx, job.Key)
+	if err != nil {
+		return 0, fmt.Errorf("verify upload: %w", err)
+	}
+	if obj.Size != info.Size() {
+		return 0, fmt.Errorf("verify upload: stored size %d differs from local size %d", obj.Size, info.Size())
+	}
+	return info.Size(), nil
+}
+
+// removeJob drops a job from the queue. The caller must hold m.mu.
+func (m *Manager) removeJob(job Job) {
+	for i, j := range m.jobs {
+		if j.Path == job.Path && j.Key == job.Key {
+			m.jobs = append(m.jobs[:i], m.jobs[i+1:]...)
+			return
+		}
+	}
+}
+
+// replaceJob updates a queued job in place. The caller must hold m.mu.
+func (m *Manager) replaceJob(job Job) {
+	for i, j := range m.jobs {
+		if j.Path == job.Path && j.Key == job.Key {
+			m.jobs[i] = job
+			return
+		}
+	}
+}
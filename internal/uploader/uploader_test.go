@@ -0,0 +1,98 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+	"github.com/oszuidwest/zwfm-audiologger/internal/objectstore"
+)
+
+// fakeClient records uploads and fails while err is set.
+type fakeClient struct {
+	err     error
+	objects map[string]int64
+}
+
+func (c *fakeClient) PutFile(_ context.Context, key, path string) (string, error) {
+	if c.err != nil {
+		return "", c.err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	c.objects[key] = info.Size()
+	return "", nil
+}
+
+func (c *fakeClient) Head(_ context.Context, key string) (objectstore.Object, error) {
+	size, ok := c.objects[key]
+	if !ok {
+		return objectstore.Object{}, objectstore.ErrNotFound
+	}
+	return objectstore.Object{Key: key, Size: size}, nil
+}
+
+func TestQueueSurvivesRestartAndRetries(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		StateDir: filepath.Join(dir, ".audiologger"),
+		Upload: &config.UploadConfig{Enabled: true, S3: &config.S3Config{
+			Endpoint: "http://127.0.0.1:9", Bucket: "audio", Prefix: "logger/",
+		}},
+	}
+	recording := filepath.Join(dir, "station", "2026-04-30-22.mp3")
+	if err := os.MkdirAll(filepath.Dir(recording), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(recording, []byte("recording"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	client := &fakeClient{err: errors.New("connection refused"), objects: make(map[string]int64)}
+	first.client = client
+
+	first.FileCompleted("station", "2026-04-30-22", recording)
+	job, _, ok := first.next()
+	if !ok {
+		t.Fatal("queued job is not due")
+	}
+	first.process(context.Background(), job)
+
+	status := first.snapshot()
+	if status.Queued != 1 || status.Failing != 1 || status.Failures != 1 {
+		t.Fatalf("status after failure = %+v", status)
+	}
+	if _, _, ok := first.next(); ok {
+		t.Fatal("failed job is due again immediately, want backoff")
+	}
+
+	// A new manager resumes the queue from disk.
+	second, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	client.err = nil
+	second.client = client
+	if len(second.jobs) != 1 || second.jobs[0].Attempts != 1 {
+		t.Fatalf("resumed jobs = %+v", second.jobs)
+	}
+
+	job = second.jobs[0]
+	second.process(context.Background(), job)
+	status = second.snapshot()
+	if status.Queued != 0 || status.Uploaded != 1 || status.UploadedBytes != 9 {
+		t.Fatalf("status after upload = %+v", status)
+	}
+	if _, ok := client.objects["logger/station/2026-04-30-22.mp3"]; !ok {
+		t.Errorf("uploaded keys = %v", client.objects)
+	}
+}
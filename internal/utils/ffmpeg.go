@@ -6,11 +6,24 @@ import (
 	"os/exec"
 	"strconv"
 	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
 )
 
+// encoders maps the codecs of an archive profile to their FFmpeg encoders.
+var encoders = map[string]string{
+	"aac":    "aac",
+	"flac":   "flac",
+	"mp3":    "libmp3lame",
+	"opus":   "libopus",
+	"vorbis": "libvorbis",
+}
+
 // RecordCommand creates an FFmpeg command for recording audio streams with
-// built-in reconnection support and timeout handling.
-func RecordCommand(ctx context.Context, streamURL string, duration time.Duration, outputFile string) *exec.Cmd {
+// built-in reconnection support and timeout handling. The stream is copied
+// unless an archive profile is given, in which case it is encoded as it is
+// recorded.
+func RecordCommand(ctx context.Context, streamURL string, duration time.Duration, outputFile string, transcode *config.TranscodeConfig) *exec.Cmd {
 	args := []string{
 		"-reconnect", "1", // Enable reconnection
 		"-reconnect_streamed", "1", // Reconnect even for streamed protocols
@@ -18,9 +31,13 @@ func RecordCommand(ctx context.Context, streamURL string, duration time.Duration
 		"-timeout", "10000000", // 10 second connection timeout (in microseconds)
 		"-i", streamURL,
 		"-t", strconv.FormatFloat(duration.Seconds(), 'f', -1, 64),
-		"-c", "copy",
-		"-y", outputFile,
 	}
+	if transcode != nil {
+		args = append(args, EncodeArgs(transcode)...)
+	} else {
+		args = append(args, "-c", "copy")
+	}
+	args = append(args, "-y", outputFile)
 
 	cmd := exec.CommandContext(ctx, "ffmpeg", args...) //nolint:gosec // Arguments are constructed from trusted config values
 
@@ -37,6 +54,78 @@ func RemuxCommand(inputFile, outputFile string) *exec.Cmd {
 	)
 }
 
+// TranscodeCommand creates an FFmpeg command that encodes a finished recording
+// with an archive profile. The container follows the output file extension.
+func TranscodeCommand(ctx context.Context, inputFile, outputFile string, transcode *config.TranscodeConfig) *exec.Cmd {
+	args := append([]string{"-i", inputFile}, EncodeArgs(transcode)...)
+	args = append(args, "-y", outputFile)
+	return exec.CommandContext(ctx, "ffmpeg", args...) //nolint:gosec // G204: args are from internal file paths and the trusted config
+}
+
+// EncodeArgs returns the FFmpeg output options that encode the audio with an
+// archive profile. Video streams such as cover art are dropped.
+func EncodeArgs(transcode *config.TranscodeConfig) []string {
+	encoder, ok := encoders[transcode.Codec]
+	if !ok {
+		encoder = transcode.Codec
+	}
+	args := []string{"-vn", "-c:a", encoder}
+	if transcode.BitrateKbps > 0 && transcode.Codec != "flac" {
+		args = append(args, "-b:a", strconv.Itoa(transcode.BitrateKbps)+"k")
+	}
+	if transcode.SampleRate > 0 {
+		args = append(args, "-ar", strconv.Itoa(transcode.SampleRate))
+	}
+	if transcode.Channels > 0 {
+		args = append(args, "-ac", strconv.Itoa(transcode.Channels))
+	}
+	if transcode.LoudnessLUFS != 0 {
+		// Single-pass loudnorm, so it works on a live stream as well.
+		args = append(args, "-af", "loudnorm=I="+strconv.FormatFloat(transcode.LoudnessLUFS, 'f', -1, 64))
+	}
+	return args
+}
+
+// SegmentCommand creates an FFmpeg command that writes part of a recording to
+// stdout as an HLS segment: AAC in MPEG-TS, with timestamps that continue from
+// the start of the recording.
+func SegmentCommand(ctx context.Context, file string, start, duration float64) *exec.Cmd {
+	offset := strconv.FormatFloat(start, 'f', -1, 64)
+	return exec.CommandContext(ctx, "ffmpeg", //nolint:gosec // G204: args are from internal file paths
+		"-v", "error",
+		"-ss", offset,
+		"-i", file,
+		"-t", strconv.FormatFloat(duration, 'f', -1, 64),
+		"-vn",
+		"-c:a", "aac",
+		"-b:a", "128k",
+		"-output_ts_offset", offset,
+		"-f", "mpegts",
+		"pipe:1",
+	)
+}
+
+// RestreamCommand creates an FFmpeg command that encodes a recording from
+// offset seconds on to constant-bitrate MP3 on stdout. An input of "pipe:0"
+// reads the recording from stdin. The MP3 has no header frames, so the output
+// of several commands can be played as one stream.
+func RestreamCommand(ctx context.Context, input string, offset float64, bitrateKbps int) *exec.Cmd {
+	return exec.CommandContext(ctx, "ffmpeg", //nolint:gosec // G204: args are from internal file paths
+		"-v", "error",
+		"-ss", strconv.FormatFloat(offset, 'f', -1, 64),
+		"-i", input,
+		"-vn",
+		"-c:a", "libmp3lame",
+		"-b:a", strconv.Itoa(bitrateKbps)+"k",
+		"-ar", "44100",
+		"-ac", "2",
+		"-write_xing", "0",
+		"-id3v2_version", "0",
+		"-f", "mp3",
+		"pipe:1",
+	)
+}
+
 // ProbeCommand creates an ffprobe command to get file metadata as JSON.
 func ProbeCommand(ctx context.Context, file string) *exec.Cmd {
 	return exec.CommandContext(ctx, "ffprobe", //nolint:gosec // G204: args are from internal file paths
@@ -47,6 +136,20 @@ func ProbeCommand(ctx context.Context, file string) *exec.Cmd {
 	)
 }
 
+// StreamProbeCommand creates an ffprobe command that connects to a stream and
+// reports its first audio stream and format as JSON.
+func StreamProbeCommand(ctx context.Context, streamURL string) *exec.Cmd {
+	return exec.CommandContext(ctx, "ffprobe", //nolint:gosec // G204: the URL comes from the trusted config
+		"-v", "error",
+		"-rw_timeout", "10000000", // 10 second network timeout (in microseconds)
+		"-print_format", "json",
+		"-show_streams",
+		"-select_streams", "a:0",
+		"-show_format",
+		streamURL,
+	)
+}
+
 // SilenceDetectCommand creates an FFmpeg command for silence detection.
 func SilenceDetectCommand(ctx context.Context, file string, thresholdDB int, minDurationSecs float64) *exec.Cmd {
 	return exec.CommandContext(ctx, "ffmpeg", //nolint:gosec // G204: args are from internal file paths
@@ -66,3 +169,28 @@ func AudioStatsCommand(ctx context.Context, file string) *exec.Cmd {
 		"-",
 	)
 }
+
+// LoudnessCommand creates an FFmpeg command for EBU R128 loudness measurement,
+// including true peak.
+func LoudnessCommand(ctx context.Context, file string) *exec.Cmd {
+	return exec.CommandContext(ctx, "ffmpeg", //nolint:gosec // G204: args are from internal file paths
+		"-nostats",
+		"-i", file,
+		"-af", "ebur128=peak=true",
+		"-f", "null",
+		"-",
+	)
+}
+
+// PCMCommand creates an FFmpeg command that decodes a file to signed 16-bit
+// little-endian mono PCM at the given sample rate on stdout.
+func PCMCommand(ctx context.Context, file string, sampleRate int) *exec.Cmd {
+	return exec.CommandContext(ctx, "ffmpeg", //nolint:gosec // G204: args are from internal file paths
+		"-v", "error",
+		"-i", file,
+		"-ac", "1",
+		"-ar", strconv.Itoa(sampleRate),
+		"-f", "s16le",
+		"-",
+	)
+}
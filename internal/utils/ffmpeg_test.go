@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+)
+
+func TestEncodeArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile config.TranscodeConfig
+		want    []string
+	}{
+		{
+			name:    "codec only",
+			profile: config.TranscodeConfig{Codec: "opus"},
+			want:    []string{"-vn", "-c:a", "libopus"},
+		},
+		{
+			name:    "full profile",
+			profile: config.TranscodeConfig{Codec: "mp3", BitrateKbps: 128, SampleRate: 44100, Channels: 1, LoudnessLUFS: -16},
+			want:    []string{"-vn", "-c:a", "libmp3lame", "-b:a", "128k", "-ar", "44100", "-ac", "1", "-af", "loudnorm=I=-16"},
+		},
+		{
+			name:    "flac ignores bitrate",
+			profile: config.TranscodeConfig{Codec: "flac", BitrateKbps: 128},
+			want:    []string{"-vn", "-c:a", "flac"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EncodeArgs(&tt.profile); !slices.Equal(got, tt.want) {
+				t.Errorf("EncodeArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
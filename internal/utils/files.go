@@ -8,8 +8,10 @@ import (
 	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+	"github.com/oszuidwest/zwfm-audiologger/internal/layout"
 )
 
 // EnsureDir creates a directory and all parent directories if they don't exist.
@@ -20,9 +22,53 @@ func EnsureDir(dir string) error {
 	return nil
 }
 
-// RecordingPath constructs a path for a recording file.
+// WriteFileAtomic writes data to a temporary file in the same directory and
+// renames it into place, so readers never see a partially written file.
+func WriteFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), constants.FilePermissions); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// RecordingPath constructs a path for a recording file following the
+// configured layout. Test recordings, whose timestamps include minutes and
+// seconds, stay directly in the station directory.
 func RecordingPath(recordingsDir, stationName, timestamp, extension string) string {
-	return filepath.Join(recordingsDir, stationName, timestamp+extension)
+	t, err := time.ParseInLocation(HourlyTimestampFormat, timestamp, time.UTC)
+	if err != nil {
+		return filepath.Join(recordingsDir, stationName, timestamp+extension)
+	}
+	return filepath.Join(recordingsDir, filepath.FromSlash(layout.Current().Path(stationName, t, extension)))
+}
+
+// RemoveEmptyDirs removes the directory of a recording file and its parents
+// while they are empty, keeping the station directory itself. It is called
+// after removing or moving a file so a dated layout leaves no empty days.
+func RemoveEmptyDirs(recordingsDir, path string) {
+	rel, err := filepath.Rel(recordingsDir, filepath.Dir(path))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	for i := len(parts); i > 1; i-- {
+		if os.Remove(filepath.Join(recordingsDir, filepath.Join(parts[:i]...))) != nil {
+			return // Not empty, or already gone.
+		}
+	}
 }
 
 // SidecarPath constructs a sidecar file path by replacing the extension.
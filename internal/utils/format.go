@@ -1,9 +1,12 @@
 package utils
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"os/exec"
+	"strconv"
 	"strings"
 )
 
@@ -14,6 +17,32 @@ type ProbeResult struct {
 	} `json:"streams"`
 }
 
+// probeFormat holds the ffprobe format output structure.
+type probeFormat struct {
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+// ProbeDuration uses ffprobe to get the duration of an audio file in seconds.
+func ProbeDuration(ctx context.Context, file string) (float64, error) {
+	output, err := ProbeCommand(ctx, file).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	var result probeFormat
+	if err := json.Unmarshal(output, &result); err != nil {
+		return 0, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+
+	duration, err := strconv.ParseFloat(result.Format.Duration, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse duration: %w", err)
+	}
+	return duration, nil
+}
+
 // Format uses ffprobe to detect the actual format of a recorded audio file.
 // It returns the appropriate file extension based on the detected codec,
 // defaulting to ".mp3" if detection fails.
@@ -40,14 +69,16 @@ func Format(filePath string) string {
 	}
 
 	if len(result.Streams) > 0 {
-		return extensionForCodec(result.Streams[0].CodecName)
+		return ExtensionForCodec(result.Streams[0].CodecName)
 	}
 
 	slog.Warn("ffprobe returned no audio streams, defaulting to .mp3", "file", filePath)
 	return ".mp3" // Default fallback
 }
 
-func extensionForCodec(codecName string) string {
+// ExtensionForCodec returns the file extension for an audio codec as named
+// by ffprobe, such as ".ogg" for "vorbis".
+func ExtensionForCodec(codecName string) string {
 	codec := strings.ToLower(codecName)
 	if codec == "" {
 		return ".mp3"
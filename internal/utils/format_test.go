@@ -24,8 +24,8 @@ func TestExtensionForCodec(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := extensionForCodec(tt.codec); got != tt.want {
-				t.Errorf("extensionForCodec(%q) = %q, want %q", tt.codec, got, tt.want)
+			if got := ExtensionForCodec(tt.codec); got != tt.want {
+				t.Errorf("ExtensionForCodec(%q) = %q, want %q", tt.codec, got, tt.want)
 			}
 		})
 	}
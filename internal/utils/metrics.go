@@ -0,0 +1,14 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// WriteMetric writes a single metric in the Prometheus text exposition format.
+// metricType is "gauge" or "counter".
+func WriteMetric(w io.Writer, name, metricType, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n",
+		name, help, name, metricType, name, strconv.FormatFloat(value, 'g', -1, 64))
+}
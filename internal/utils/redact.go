@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// redacted replaces secret values in logs.
+const redacted = "[REDACTED]"
+
+// minSecretLength is the length below which a value is not redacted, so a
+// short value cannot blank out unrelated parts of every log line.
+const minSecretLength = 4
+
+var (
+	// secrets holds the values that must not appear in logs, longest first.
+	secrets []string
+	// secretsMutex protects secrets reads/writes.
+	secretsMutex sync.RWMutex
+)
+
+// AddSecrets registers values that must not appear in logs. Secrets are never
+// removed, since a recording started before a config reload may still log
+// the old ones.
+func AddSecrets(values ...string) {
+	secretsMutex.Lock()
+	defer secretsMutex.Unlock()
+	for _, v := range values {
+		if len(v) >= minSecretLength && !slices.Contains(secrets, v) {
+			secrets = append(secrets, v)
+		}
+	}
+	// Longer secrets go first, so a secret containing another is replaced whole.
+	slices.SortFunc(secrets, func(a, b string) int { return len(b) - len(a) })
+}
+
+// Redact replaces every registered secret in s.
+func Redact(s string) string {
+	secretsMutex.RLock()
+	defer secretsMutex.RUnlock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return s
+}
+
+// RedactAttr is a slog.HandlerOptions.ReplaceAttr function that redacts
+// registered secrets from messages, strings, errors and string slices.
+func RedactAttr(_ []string, a slog.Attr) slog.Attr {
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(Redact(a.Value.String()))
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case error:
+			a.Value = slog.StringValue(Redact(v.Error()))
+		case []string:
+			values := make([]string, len(v))
+			for i, s := range v {
+				values[i] = Redact(s)
+			}
+			a.Value = slog.AnyValue(values)
+		}
+	}
+	return a
+}
@@ -1,7 +1,9 @@
 package utils
 
 import (
+	"fmt"
 	"log/slog"
+	"strings"
 	"sync"
 	"time"
 )
@@ -54,3 +56,42 @@ func HourlyTimestamp() string {
 func TestTimestamp() string {
 	return Now().Format(TestTimestampFormat)
 }
+
+// ParseTimestamp parses an hourly or test recording timestamp in the configured
+// timezone. Test timestamps carry a "test-" prefix.
+func ParseTimestamp(timestamp string) (time.Time, error) {
+	timezoneMutex.RLock()
+	tz := AppTimezone
+	timezoneMutex.RUnlock()
+
+	if rest, ok := strings.CutPrefix(timestamp, "test-"); ok {
+		return time.ParseInLocation(TestTimestampFormat, rest, tz)
+	}
+	return time.ParseInLocation(HourlyTimestampFormat, timestamp, tz)
+}
+
+// timeLayouts lists the layouts ParseTime accepts besides RFC 3339.
+var timeLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	time.DateOnly,
+	HourlyTimestampFormat,
+}
+
+// ParseTime parses a time given in a request, such as "2026-04-30T22:15" or
+// "2026-04-30". Times without a zone are in the configured timezone.
+func ParseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	timezoneMutex.RLock()
+	tz := AppTimezone
+	timezoneMutex.RUnlock()
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, tz); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, use YYYY-MM-DDTHH:MM or RFC 3339", value)
+}
@@ -2,6 +2,7 @@ package validator
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -43,7 +45,7 @@ type Alerter struct {
 
 // NewAlerter creates a new MS Graph email alerter.
 func NewAlerter(cfg *config.AlertConfig, stationRecipients map[string][]string) *Alerter {
-	if err := validateCredentials(cfg); err != nil {
+	if err := ValidateCredentials(cfg); err != nil {
 		slog.Error("invalid graph credentials", "error", err)
 		return nil
 	}
@@ -69,8 +71,8 @@ func NewAlerter(cfg *config.AlertConfig, stationRecipients map[string][]string)
 	}
 }
 
-// validateCredentials checks that required credential fields are present and valid.
-func validateCredentials(cfg *config.AlertConfig) error {
+// ValidateCredentials checks that required credential fields are present and valid.
+func ValidateCredentials(cfg *config.AlertConfig) error {
 	if err := validateGUIDField(cfg.TenantID, "tenant ID"); err != nil {
 		return err
 	}
@@ -215,9 +217,17 @@ func buildEmailContent(result *ValidationResult) string {
 	writeTableRow(&b, "Duration", fmt.Sprintf("%.1f seconds", result.DurationSecs))
 	writeTableRow(&b, "Silence", fmt.Sprintf("%.1f%%", result.SilencePercent))
 	writeTableRow(&b, "Loop", fmt.Sprintf("%.1f%%", result.LoopPercent))
+	if l := result.Loudness; l != nil {
+		writeTableRow(&b, "Loudness", fmt.Sprintf("%.1f LUFS integrated, %.1f LU range", l.IntegratedLUFS, l.RangeLU))
+		writeTableRow(&b, "Peaks", fmt.Sprintf("%.1f dBTP true peak, %.1f LUFS momentary max", l.TruePeakDBTP, l.MomentaryMaxLUFS))
+	}
 
 	b.WriteString("</table>")
 
+	if len(result.Silences) > 0 {
+		writeSilences(&b, result.Silences)
+	}
+
 	if len(result.Issues) > 0 {
 		b.WriteString("<h3>Issues:</h3><ul>")
 		for _, issue := range result.Issues {
@@ -232,6 +242,33 @@ func buildEmailContent(result *ValidationResult) string {
 	return b.String()
 }
 
+// writeSilences writes the silence periods with their clock times, longest
+// first, so staff can go straight to the dead air in the recording.
+func writeSilences(b *strings.Builder, silences []SilenceInterval) {
+	silences = slices.SortedStableFunc(slices.Values(silences), func(a, b SilenceInterval) int {
+		return cmp.Compare(b.DurationSecs, a.DurationSecs)
+	})
+	b.WriteString("<h3>Silence periods:</h3><table style='border-collapse: collapse;'>")
+	for i, s := range silences {
+		if i == constants.AlertMaxSilences {
+			fmt.Fprintf(b, "<tr><td colspan='2'>and %d more</td></tr>", len(silences)-i)
+			break
+		}
+		when := fmt.Sprintf("%s – %s", formatOffset(s.StartSecs), formatOffset(s.EndSecs))
+		if !s.Start.IsZero() {
+			when = fmt.Sprintf("%s – %s", s.Start.Format(time.TimeOnly), s.End.Format(time.TimeOnly))
+		}
+		writeTableRow(b, when, fmt.Sprintf("%.1f seconds", s.DurationSecs))
+	}
+	b.WriteString("</table>")
+}
+
+// formatOffset formats an offset in seconds as minutes and seconds into the file.
+func formatOffset(secs float64) string {
+	total := int(secs)
+	return fmt.Sprintf("+%02d:%02d", total/60, total%60)
+}
+
 // writeTableRow writes an HTML table row to the builder, escaping the label and value.
 func writeTableRow(b *strings.Builder, label, value string) {
 	fmt.Fprintf(b, "<tr><td><strong>%s:</strong></td><td>%s</td></tr>", html.EscapeString(label), html.EscapeString(value))
@@ -4,59 +4,45 @@ import (
 	"bufio"
 	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"maps"
 	"math"
+	"os"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
 	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+	"github.com/oszuidwest/zwfm-audiologger/internal/fingerprint"
 	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
 )
 
-// probeFormat holds the ffprobe format output structure.
-type probeFormat struct {
-	Format struct {
-		Duration string `json:"duration"`
-	} `json:"format"`
-}
-
 // analyzeDuration uses ffprobe to get the duration of a recording in seconds.
 func (m *Manager) analyzeDuration(ctx context.Context, file string) (float64, error) {
 	ctx, cancel := context.WithTimeout(ctx, constants.ValidationAnalysisTimeout)
 	defer cancel()
-
-	cmd := utils.ProbeCommand(ctx, file)
-	output, err := cmd.Output()
-	if err != nil {
-		return 0, fmt.Errorf("ffprobe failed: %w", err)
-	}
-
-	var result probeFormat
-	if err := json.Unmarshal(output, &result); err != nil {
-		return 0, fmt.Errorf("failed to parse ffprobe output: %w", err)
-	}
-
-	duration, err := strconv.ParseFloat(result.Format.Duration, 64)
-	if err != nil {
-		return 0, fmt.Errorf("failed to parse duration: %w", err)
-	}
-
-	return duration, nil
+	return utils.ProbeDuration(ctx, file)
 }
 
 // silenceRegex matches FFmpeg silencedetect output lines.
-var silenceRegex = regexp.MustCompile(`silence_(start|end|duration):\s*([\d.]+)`)
+var silenceRegex = regexp.MustCompile(`silence_(start|end|duration):\s*(-?[\d.]+)`)
 
-// analyzeSilence detects silence periods in the recording and returns the maximum
-// continuous silence duration in seconds.
-func (m *Manager) analyzeSilence(ctx context.Context, file string) (float64, error) {
+// analyzeSilence detects the silence periods in the recording, down to short
+// pauses, so their total is the true silence share; the station's maximum
+// silence is applied when the result is evaluated. A silence still running at
+// the end of the file is closed at durationSecs.
+func (m *Manager) analyzeSilence(ctx context.Context, file string, durationSecs float64, rules *Rules) ([]SilenceInterval, error) {
 	ctx, cancel := context.WithTimeout(ctx, constants.ValidationAnalysisTimeout)
 	defer cancel()
 
-	thresholdDB := int(m.config.Validation.SilenceThresholdDB)
-	minDuration := m.config.Validation.MaxSilenceSecs
+	thresholdDB := int(rules.SilenceThresholdDB)
+	minDuration := min(constants.SilenceMinDetectSecs, rules.MaxSilenceSecs)
 
 	cmd := utils.SilenceDetectCommand(ctx, file, thresholdDB, minDuration)
 
@@ -66,22 +52,42 @@ func (m *Manager) analyzeSilence(ctx context.Context, file string) (float64, err
 
 	_ = cmd.Run() // Ignore error; ffmpeg returns non-zero for -f null.
 
-	var maxSilence float64
-	scanner := bufio.NewScanner(&stderr)
+	return parseSilences(&stderr, durationSecs), nil
+}
+
+// parseSilences extracts the silence intervals from silencedetect output.
+func parseSilences(output io.Reader, durationSecs float64) []SilenceInterval {
+	var intervals []SilenceInterval
+	var open *SilenceInterval
+
+	scanner := bufio.NewScanner(output)
 	for scanner.Scan() {
-		line := scanner.Text()
-		matches := silenceRegex.FindAllStringSubmatch(line, -1)
-		for _, match := range matches {
-			if len(match) >= 3 && match[1] == "duration" {
-				duration, err := strconv.ParseFloat(match[2], 64)
-				if err == nil && duration > maxSilence {
-					maxSilence = duration
+		for _, match := range silenceRegex.FindAllStringSubmatch(scanner.Text(), -1) {
+			value, err := strconv.ParseFloat(match[2], 64)
+			if err != nil {
+				continue
+			}
+			value = max(value, 0) // silence_start can be slightly negative at the start of a file.
+			switch match[1] {
+			case "start":
+				open = &SilenceInterval{StartSecs: value}
+			case "end":
+				if open != nil {
+					open.EndSecs = value
+					open.DurationSecs = value - open.StartSecs
+					intervals = append(intervals, *open)
+					open = nil
 				}
 			}
 		}
 	}
 
-	return maxSilence, nil
+	if open != nil {
+		open.EndSecs = max(durationSecs, open.StartSecs)
+		open.DurationSecs = open.EndSecs - open.StartSecs
+		intervals = append(intervals, *open)
+	}
+	return intervals
 }
 
 // analyzeLoops detects looping/repeating content by analyzing audio energy patterns.
@@ -183,3 +189,161 @@ func detectLoopsViaAutocorrelation(rmsValues []float64) float64 {
 	loopPercent := float64(highCorrelationCount) / float64(totalChecks) * 100
 	return math.Round(loopPercent*10) / 10
 }
+
+// Patterns for the ebur128 filter output. Each frame line reports the
+// momentary loudness as "M: -23.4"; the summary at the end reports the
+// integrated loudness, loudness range and true peak.
+var (
+	momentaryRegex = regexp.MustCompile(`\bM:\s*(-?[\d.]+|-?inf)`)
+	summaryRegex   = regexp.MustCompile(`^\s*(I|LRA|Peak):\s*(-?[\d.]+|-?inf)`)
+)
+
+// silenceFloorDB replaces -inf levels so that results stay valid JSON.
+const silenceFloorDB = -100.0
+
+// analyzeLoudness measures EBU R128 loudness, loudness range, true peak and
+// the maximum momentary loudness.
+func (m *Manager) analyzeLoudness(ctx context.Context, file string) (*Loudness, error) {
+	ctx, cancel := context.WithTimeout(ctx, constants.ValidationAnalysisTimeout)
+	defer cancel()
+
+	cmd := utils.LoudnessCommand(ctx, file)
+
+	// ebur128 outputs to stderr.
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	_ = cmd.Run() // Ignore error; ffmpeg returns non-zero for -f null.
+
+	return parseLoudness(&stderr)
+}
+
+// parseLoudness extracts the loudness measurements from ebur128 output.
+func parseLoudness(output io.Reader) (*Loudness, error) {
+	loudness := &Loudness{MomentaryMaxLUFS: silenceFloorDB}
+	var inSummary bool
+	var found int
+
+	scanner := bufio.NewScanner(output)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.Contains(line, "Summary:") {
+			inSummary = true
+			continue
+		}
+		if !inSummary {
+			if match := momentaryRegex.FindStringSubmatch(line); match != nil {
+				loudness.MomentaryMaxLUFS = max(loudness.MomentaryMaxLUFS, parseLevel(match[1]))
+			}
+			continue
+		}
+
+		match := summaryRegex.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		found++
+		switch match[1] {
+		case "I":
+			loudness.IntegratedLUFS = parseLevel(match[2])
+		case "LRA":
+			loudness.RangeLU = parseLevel(match[2])
+		case "Peak":
+			loudness.TruePeakDBTP = parseLevel(match[2])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if found < 3 {
+		return nil, errors.New("ffmpeg ebur128 summary not found")
+	}
+	return loudness, nil
+}
+
+// parseLevel parses a level in dB, mapping -inf to the silence floor.
+func parseLevel(s string) float64 {
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(value, -1) || value < silenceFloorDB {
+		return silenceFloorDB
+	}
+	return value
+}
+
+// analyzeFingerprint computes the spectral fingerprint of a recording.
+func (m *Manager) analyzeFingerprint(ctx context.Context, file string) (*fingerprint.Fingerprint, error) {
+	ctx, cancel := context.WithTimeout(ctx, constants.ValidationAnalysisTimeout)
+	defer cancel()
+
+	cmd := utils.PCMCommand(ctx, file, fingerprint.SampleRate)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed to start: %w", err)
+	}
+
+	fp, err := fingerprint.Compute(stdout)
+	if err != nil {
+		// Stop ffmpeg, which otherwise blocks on the pipe nobody reads anymore.
+		cancel()
+	}
+	waitErr := cmd.Wait()
+	if err != nil {
+		return nil, err
+	}
+	if waitErr != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w: %s", waitErr, strings.TrimSpace(stderr.String()))
+	}
+	return fp, nil
+}
+
+// findContentMatches compares a fingerprint with the earlier hours of the same
+// station within the lookback window and with the same hour of every other
+// station. Recordings without a fingerprint are skipped.
+func (m *Manager) findContentMatches(station, timestamp string, fp *fingerprint.Fingerprint, fc config.FingerprintConfig) []ContentMatch {
+	recordedAt, err := utils.ParseTimestamp(timestamp)
+	if err != nil {
+		return nil
+	}
+
+	type candidate struct{ station, timestamp string }
+	var candidates []candidate
+	for hours := 1; hours <= fc.LookbackHours; hours++ {
+		earlier := recordedAt.Add(-time.Duration(hours) * time.Hour).Format(utils.HourlyTimestampFormat)
+		candidates = append(candidates, candidate{station, earlier})
+	}
+	cfg := m.config.Load()
+	for _, other := range slices.Sorted(maps.Keys(cfg.Stations)) {
+		if other != station {
+			candidates = append(candidates, candidate{other, timestamp})
+		}
+	}
+
+	var matches []ContentMatch
+	for _, c := range candidates {
+		path := utils.RecordingPath(cfg.RecordingsDir, c.station, c.timestamp, constants.FingerprintFileSuffix)
+		other, err := fingerprint.Load(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				slog.Warn("failed to load fingerprint", "file", path, "error", err)
+			}
+			continue
+		}
+
+		match := fingerprint.Compare(fp, other, constants.FingerprintMinOverlap)
+		similarity := math.Round(match.Similarity*1000) / 10
+		if similarity >= fc.MinSimilarityPercent {
+			matches = append(matches, ContentMatch{
+				Station:           c.station,
+				Timestamp:         c.timestamp,
+				SimilarityPercent: similarity,
+				OffsetSecs:        match.Offset.Seconds(),
+			})
+		}
+	}
+	return matches
+}
@@ -0,0 +1,122 @@
+package validator
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ebur128Output is abbreviated ffmpeg output for a recording with true peak
+// measurement enabled.
+const ebur128Output = `Input #0, mp3, from 'station/2026-04-30-22.mp3':
+[Parsed_ebur128_0 @ 0x55d0c8e0a2c0] t: 0.0999773  TARGET:-23 LUFS    M:-120.7 S:-120.7     I: -70.0 LUFS       LRA:   0.0 LU  FTPK:  -inf  -inf dBFS  TPK:  -inf  -inf dBFS
+[Parsed_ebur128_0 @ 0x55d0c8e0a2c0] t: 1.39998    TARGET:-23 LUFS    M: -14.2 S:-120.7     I: -14.2 LUFS       LRA:   0.0 LU  FTPK:  -2.1  -2.4 dBFS  TPK:  -2.1  -2.4 dBFS
+[Parsed_ebur128_0 @ 0x55d0c8e0a2c0] t: 3599.9     TARGET:-23 LUFS    M: -19.8 S: -18.9     I: -17.3 LUFS       LRA:   6.1 LU  FTPK:  -4.0  -3.9 dBFS  TPK:  -0.4  -0.6 dBFS
+[Parsed_ebur128_0 @ 0x55d0c8e0a2c0] Summary:
+
+  Integrated loudness:
+    I:         -17.3 LUFS
+    Threshold: -27.6 LUFS
+
+  Loudness range:
+    LRA:         6.1 LU
+    Threshold: -37.5 LUFS
+    LRA low:   -21.2 LUFS
+    LRA high:  -15.1 LUFS
+
+  True peak:
+    Peak:       -0.4 dBFS
+`
+
+func TestParseLoudness(t *testing.T) {
+	loudness, err := parseLoudness(strings.NewReader(ebur128Output))
+	if err != nil {
+		t.Fatalf("parseLoudness returned error: %v", err)
+	}
+	want := Loudness{IntegratedLUFS: -17.3, RangeLU: 6.1, TruePeakDBTP: -0.4, MomentaryMaxLUFS: -14.2}
+	if *loudness != want {
+		t.Errorf("parseLoudness = %+v, want %+v", *loudness, want)
+	}
+
+	if _, err := parseLoudness(strings.NewReader("Invalid data found when processing input\n")); err == nil {
+		t.Error("parseLoudness accepted output without a summary")
+	}
+}
+
+func TestParseLoudnessSilence(t *testing.T) {
+	output := `[Parsed_ebur128_0 @ 0x1] Summary:
+    I:         -70.0 LUFS
+    LRA:         0.0 LU
+    Peak:       -inf dBFS
+`
+	loudness, err := parseLoudness(strings.NewReader(output))
+	if err != nil {
+		t.Fatalf("parseLoudness returned error: %v", err)
+	}
+	if loudness.TruePeakDBTP != silenceFloorDB || loudness.MomentaryMaxLUFS != silenceFloorDB {
+		t.Errorf("silent recording = %+v, want -inf mapped to %v", *loudness, silenceFloorDB)
+	}
+}
+
+func TestParseSilences(t *testing.T) {
+	output := `[silencedetect @ 0x5581] silence_start: -0.0113
+[silencedetect @ 0x5581] silence_end: 6.5 | silence_duration: 6.5113
+size=N/A time=00:10:00.00 bitrate=N/A speed= 500x
+[silencedetect @ 0x5581] silence_start: 845.25
+[silencedetect @ 0x5581] silence_end: 877.75 | silence_duration: 32.5
+[silencedetect @ 0x5581] silence_start: 3590
+`
+	got := parseSilences(strings.NewReader(output), 3600)
+	want := []SilenceInterval{
+		{StartSecs: 0, EndSecs: 6.5, DurationSecs: 6.5},
+		{StartSecs: 845.25, EndSecs: 877.75, DurationSecs: 32.5},
+		{StartSecs: 3590, EndSecs: 3600, DurationSecs: 10},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("parseSilences returned %d intervals, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("interval %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	setClockTimes(got, "2026-04-30-22")
+	if clock := got[1].Start.Format("15:04:05.000"); clock != "22:14:05.250" {
+		t.Errorf("clock time of second interval = %s, want 22:14:05.250", clock)
+	}
+}
+
+func TestAnalyzeSilenceDetectsPausesBelowMaximum(t *testing.T) {
+	dir := t.TempDir()
+	script := `#!/bin/sh
+echo "$@" > "` + filepath.Join(dir, "args") + `"
+echo "[silencedetect @ 0x5581] silence_start: 100" >&2
+echo "[silencedetect @ 0x5581] silence_end: 102 | silence_duration: 2" >&2
+`
+	if err := os.WriteFile(filepath.Join(dir, "ffmpeg"), []byte(script), 0o700); err != nil { //nolint:gosec // G306: test scripts must be executable
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	rules := &Rules{SilenceThresholdDB: -40, MaxSilenceSecs: 5}
+	silences, err := (&Manager{}).analyzeSilence(context.Background(), "recording.mp3", 3600, rules)
+	if err != nil {
+		t.Fatalf("analyzeSilence returned error: %v", err)
+	}
+	args, err := os.ReadFile(filepath.Join(dir, "args")) //nolint:gosec // G304: file is in the test directory
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(args), "silencedetect=noise=-40dB:d=0.5") {
+		t.Errorf("ffmpeg args = %q, want detection down to half a second", args)
+	}
+	if len(silences) != 1 || silences[0].DurationSecs != 2 {
+		t.Fatalf("silences = %+v, want the 2 second pause", silences)
+	}
+	if issues := rules.checkSilence(&ValidationResult{Silences: silences}, nil); len(issues) != 0 {
+		t.Errorf("issues = %q, want none for a pause below the maximum", issues)
+	}
+}
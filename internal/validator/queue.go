@@ -0,0 +1,231 @@
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime/debug"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
+)
+
+// Job priorities. Jobs with a higher priority are validated first, so fresh
+// recordings are not held up by a backlog.
+const (
+	// priorityBacklog is for recordings found without a validation result,
+	// such as those recorded before an outage of the validator.
+	priorityBacklog = iota
+	// priorityFresh is for recordings that have just finished.
+	priorityFresh
+)
+
+// QueueStatus summarizes the validation queue for the status endpoint.
+type QueueStatus struct {
+	Workers       int       `json:"workers"`
+	Queued        int       `json:"queued"`
+	QueuedFresh   int       `json:"queued_fresh"`
+	QueuedBacklog int       `json:"queued_backlog"`
+	Running       int       `json:"running"`
+	OldestQueued  time.Time `json:"oldest_queued,omitzero"`
+	Validated     int64     `json:"validated"`
+	Invalid       int64     `json:"invalid"`
+	LastValidated time.Time `json:"last_validated,omitzero"`
+}
+
+// load reads the persistent queue. A missing file means an empty queue.
+func (m *Manager) load() error {
+	data, err := os.ReadFile(m.queuePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read validation queue: %w", err)
+	}
+	if err := json.Unmarshal(data, &m.jobs); err != nil {
+		return fmt.Errorf("failed to parse validation queue %s: %w", m.queuePath, err)
+	}
+	for _, job := range m.jobs {
+		m.seq = max(m.seq, job.Seq)
+	}
+	return nil
+}
+
+// persist writes the queue to disk. The caller must hold m.mu.
+func (m *Manager) persist() {
+	data, err := json.MarshalIndent(m.jobs, "", "  ")
+	if err == nil {
+		err = utils.WriteFileAtomic(m.queuePath, data)
+	}
+	if err != nil {
+		slog.Error("failed to save validation queue", "file", m.queuePath, "error", err)
+	}
+}
+
+// add queues jobs at the given priority and wakes a worker. A recording that
+// is already queued keeps its place, but moves up if the new priority is
+// higher.
+func (m *Manager) add(priority int, jobs ...ValidationJob) {
+	m.mu.Lock()
+	queued := make(map[string]int, len(m.jobs))
+	for i, job := range m.jobs {
+		queued[job.FilePath] = i
+	}
+	now := time.Now()
+	for _, job := range jobs {
+		if i, ok := queued[job.FilePath]; ok {
+			m.jobs[i].Priority = max(m.jobs[i].Priority, priority)
+			continue
+		}
+		m.seq++
+		job.Priority = priority
+		job.Seq = m.seq
+		job.QueuedAt = now
+		queued[job.FilePath] = len(m.jobs)
+		m.jobs = append(m.jobs, job)
+	}
+	m.persist()
+	m.mu.Unlock()
+
+	m.signal()
+}
+
+// signal wakes one idle worker, if any.
+func (m *Manager) signal() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// work runs jobs until the validator stops.
+func (m *Manager) work() {
+	for {
+		job, more, ok := m.next()
+		if !ok {
+			select {
+			case <-m.ctx.Done():
+				return
+			case <-m.wake:
+			}
+			continue
+		}
+		if more {
+			m.signal() // Let another idle worker take the next job.
+		}
+		m.run(job)
+		if m.ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// next claims the waiting job with the highest priority, oldest first, and
+// reports whether more jobs are waiting.
+func (m *Manager) next() (job ValidationJob, more, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	best := -1
+	waiting := 0
+	for i, j := range m.jobs {
+		if j.running {
+			continue
+		}
+		waiting++
+		if best < 0 || j.Priority > m.jobs[best].Priority ||
+			(j.Priority == m.jobs[best].Priority && j.Seq < m.jobs[best].Seq) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return ValidationJob{}, false, false
+	}
+	m.jobs[best].running = true
+	return m.jobs[best], waiting > 1, true
+}
+
+// run validates one job and removes it from the queue. A job interrupted by
+// shutdown stays queued and runs again on the next start.
+func (m *Manager) run(job ValidationJob) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("panic in validation", "file", job.FilePath, "panic", r, "stack", string(debug.Stack()))
+		}
+		if m.ctx.Err() == nil {
+			m.finish(job)
+		}
+	}()
+
+	if _, err := os.Stat(job.FilePath); os.IsNotExist(err) {
+		slog.Warn("recording removed before validation, dropping from queue", "file", job.FilePath)
+		return
+	}
+	m.processJob(job)
+}
+
+// finish removes a job from the queue.
+func (m *Manager) finish(job ValidationJob) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, j := range m.jobs {
+		if j.FilePath == job.FilePath {
+			m.jobs = append(m.jobs[:i], m.jobs[i+1:]...)
+			break
+		}
+	}
+	m.persist()
+}
+
+// recordResult updates the statistics with a finished validation.
+func (m *Manager) recordResult(result *ValidationResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status.Validated++
+	if !result.Valid {
+		m.status.Invalid++
+	}
+	m.status.LastValidated = time.Now()
+}
+
+// Status returns a snapshot of the validation queue for the status endpoint.
+func (m *Manager) Status() any {
+	return m.snapshot()
+}
+
+// snapshot returns the current queue statistics.
+func (m *Manager) snapshot() QueueStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := m.status
+	status.Workers = m.workers
+	for _, job := range m.jobs {
+		if job.running {
+			status.Running++
+			continue
+		}
+		status.Queued++
+		if job.Priority >= priorityFresh {
+			status.QueuedFresh++
+		} else {
+			status.QueuedBacklog++
+		}
+		if status.OldestQueued.IsZero() || job.QueuedAt.Before(status.OldestQueued) {
+			status.OldestQueued = job.QueuedAt
+		}
+	}
+	return status
+}
+
+// WriteMetrics writes the validation metrics in Prometheus text format.
+func (m *Manager) WriteMetrics(w io.Writer) {
+	status := m.snapshot()
+	utils.WriteMetric(w, "audiologger_validation_queue_length", "gauge", "Recordings waiting to be validated.", float64(status.Queued))
+	utils.WriteMetric(w, "audiologger_validation_backlog_length", "gauge", "Queued recordings found without a validation result at startup.", float64(status.QueuedBacklog))
+	utils.WriteMetric(w, "audiologger_validation_running", "gauge", "Recordings being validated.", float64(status.Running))
+	utils.WriteMetric(w, "audiologger_validations_total", "counter", "Recordings validated.", float64(status.Validated))
+	utils.WriteMetric(w, "audiologger_validation_invalid_total", "counter", "Recordings that failed validation.", float64(status.Invalid))
+}
@@ -0,0 +1,59 @@
+package validator
+
+import (
+	"testing"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+)
+
+func TestQueuePrioritizesFreshRecordingsAndSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{RecordingsDir: dir, StateDir: dir}
+
+	first, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	first.add(priorityBacklog,
+		ValidationJob{FilePath: "/a/2026-04-28-10.mp3", Station: "a", Timestamp: "2026-04-28-10"},
+		ValidationJob{FilePath: "/a/2026-04-28-11.mp3", Station: "a", Timestamp: "2026-04-28-11"},
+	)
+	first.Enqueue("/b/2026-04-30-22.mp3", "b", "2026-04-30-22")
+	// A backlog scan that finds the fresh recording does not demote it.
+	first.add(priorityBacklog, ValidationJob{FilePath: "/b/2026-04-30-22.mp3", Station: "b", Timestamp: "2026-04-30-22"})
+
+	status := first.snapshot()
+	if status.Queued != 3 || status.QueuedFresh != 1 || status.QueuedBacklog != 2 {
+		t.Errorf("status = %+v, want 3 queued of which 1 fresh", status)
+	}
+
+	job, more, ok := first.next()
+	if !ok || !more || job.FilePath != "/b/2026-04-30-22.mp3" {
+		t.Fatalf("next = %+v, %v, %v, want the fresh recording first", job, more, ok)
+	}
+	first.finish(job)
+	if job, _, _ := first.next(); job.FilePath != "/a/2026-04-28-10.mp3" {
+		t.Fatalf("next = %s, want the oldest backlog job", job.FilePath)
+	}
+	if status := first.snapshot(); status.Running != 1 || status.Queued != 1 {
+		t.Errorf("status = %+v, want 1 running and 1 queued", status)
+	}
+	first.Stop()
+
+	// The job that was running when the process stopped is picked up again.
+	second, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	defer second.Stop()
+	if status := second.snapshot(); status.Queued != 2 || status.Running != 0 {
+		t.Errorf("status after restart = %+v, want 2 queued", status)
+	}
+	if job, _, _ := second.next(); job.FilePath != "/a/2026-04-28-10.mp3" {
+		t.Errorf("next after restart = %s, want the interrupted job", job.FilePath)
+	}
+	second.Enqueue("/b/2026-04-30-23.mp3", "b", "2026-04-30-23")
+	if job, _, _ := second.next(); job.FilePath != "/b/2026-04-30-23.mp3" {
+		t.Errorf("next = %s, want the new fresh recording before the backlog", job.FilePath)
+	}
+}
@@ -3,6 +3,7 @@ package validator
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"time"
 
@@ -11,15 +12,49 @@ import (
 
 // ValidationResult holds the results of a recording validation.
 type ValidationResult struct {
-	Station        string    `json:"station"`
-	Timestamp      string    `json:"timestamp"`
-	ValidatedAt    time.Time `json:"validated_at"`
-	DurationSecs   float64   `json:"duration_secs"`
-	SilencePercent float64   `json:"silence_percent"`
-	LoopPercent    float64   `json:"loop_percent"`
-	Valid          bool      `json:"valid"`
-	Skipped        bool      `json:"skipped,omitempty"`
-	Issues         []string  `json:"issues,omitempty"`
+	Station      string    `json:"station"`
+	Timestamp    string    `json:"timestamp"`
+	ValidatedAt  time.Time `json:"validated_at"`
+	DurationSecs float64   `json:"duration_secs"`
+	// SilencePercent is the share of the recording covered by Silences.
+	SilencePercent float64           `json:"silence_percent"`
+	Silences       []SilenceInterval `json:"silences,omitempty"`
+	LoopPercent    float64           `json:"loop_percent"`
+	Loudness       *Loudness         `json:"loudness,omitempty"`
+	ContentMatches []ContentMatch    `json:"content_matches,omitempty"`
+	Valid          bool              `json:"valid"`
+	Skipped        bool              `json:"skipped,omitempty"`
+	Issues         []string          `json:"issues,omitempty"`
+	// WaivedChecks lists the checks a time-of-day exception applied to.
+	WaivedChecks []string `json:"waived_checks,omitempty"`
+}
+
+// SilenceInterval is a period of silence in a recording. Offsets are in seconds
+// from the start of the file; Start and End are the matching clock times.
+type SilenceInterval struct {
+	StartSecs    float64   `json:"start_secs"`
+	EndSecs      float64   `json:"end_secs"`
+	DurationSecs float64   `json:"duration_secs"`
+	Start        time.Time `json:"start,omitzero"`
+	End          time.Time `json:"end,omitzero"`
+}
+
+// ContentMatch is an earlier hour of the same station, or the same hour of
+// another station, with the same audio as the recording.
+type ContentMatch struct {
+	Station           string  `json:"station"`
+	Timestamp         string  `json:"timestamp"`
+	SimilarityPercent float64 `json:"similarity_percent"`
+	// OffsetSecs is where the audio of this recording starts in the other one.
+	OffsetSecs float64 `json:"offset_secs"`
+}
+
+// Loudness holds the EBU R128 measurements of a recording.
+type Loudness struct {
+	IntegratedLUFS   float64 `json:"integrated_lufs"`
+	RangeLU          float64 `json:"range_lu"`
+	TruePeakDBTP     float64 `json:"true_peak_dbtp"`
+	MomentaryMaxLUFS float64 `json:"momentary_max_lufs"`
 }
 
 // Save writes the validation result to a JSON file.
@@ -30,3 +65,12 @@ func (r *ValidationResult) Save(path string) error {
 	}
 	return os.WriteFile(path, data, constants.FilePermissions)
 }
+
+// ParseResult decodes a validation result from the content of a JSON sidecar file.
+func ParseResult(data []byte) (*ValidationResult, error) {
+	var result ValidationResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse validation result: %w", err)
+	}
+	return &result, nil
+}
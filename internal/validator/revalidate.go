@@ -0,0 +1,325 @@
+package validator
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/archive"
+	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
+)
+
+// ErrRevalidationRunning is returned by StartRevalidation while a previous
+// re-validation is still running.
+var ErrRevalidationRunning = errors.New("re-validation already running")
+
+// RevalidateOptions selects the recordings to validate again.
+type RevalidateOptions struct {
+	Station     string `json:"station,omitempty"` // Empty selects all stations
+	From        string `json:"from"`              // First day, YYYY-MM-DD
+	To          string `json:"to,omitempty"`      // Last day, inclusive; defaults to today
+	OnlyInvalid bool   `json:"only_invalid,omitempty"`
+	// DryRun reports how the results would change without writing sidecars
+	// or sending alerts.
+	DryRun bool `json:"dry_run,omitempty"`
+	// Alert sends alerts for recordings that fail. Without it re-validation
+	// is silent.
+	Alert bool `json:"alert,omitempty"`
+}
+
+// RevalidatedRecording describes how the result of one recording changed.
+type RevalidatedRecording struct {
+	Station   string `json:"station"`
+	Timestamp string `json:"timestamp"`
+	// WasValid is nil when the recording had no validation result.
+	WasValid       *bool    `json:"was_valid"`
+	Valid          bool     `json:"valid"`
+	AddedIssues    []string `json:"added_issues,omitempty"`
+	ResolvedIssues []string `json:"resolved_issues,omitempty"`
+}
+
+// RevalidationReport summarizes a re-validation.
+type RevalidationReport struct {
+	DryRun     bool `json:"dry_run"`
+	Checked    int  `json:"checked"`
+	Changed    int  `json:"changed"`
+	NowValid   int  `json:"now_valid"`
+	NowInvalid int  `json:"now_invalid"`
+	// Recordings lists the recordings whose result changed.
+	Recordings []RevalidatedRecording `json:"recordings,omitempty"`
+}
+
+// RevalidationStatus is the state of the current or last re-validation.
+type RevalidationStatus struct {
+	Running    bool                `json:"running"`
+	Options    RevalidateOptions   `json:"options"`
+	StartedAt  time.Time           `json:"started_at,omitzero"`
+	FinishedAt time.Time           `json:"finished_at,omitzero"`
+	Total      int                 `json:"total"`
+	Done       int                 `json:"done"`
+	Report     *RevalidationReport `json:"report,omitempty"`
+	Error      string              `json:"error,omitempty"`
+}
+
+// revalidation is a selected recording with its previous result, if any.
+type revalidation struct {
+	job      ValidationJob
+	previous *ValidationResult
+}
+
+// Revalidate validates the selected recordings again under the current
+// configuration, using as many workers as the validation queue. Recordings
+// that were not validated because they are catchup recordings are left alone.
+// When ctx is cancelled the report covers the recordings done so far.
+func (m *Manager) Revalidate(ctx context.Context, opts RevalidateOptions) (*RevalidationReport, error) {
+	items, err := m.selectRecordings(opts)
+	if err != nil {
+		return nil, err
+	}
+	return m.revalidate(ctx, opts, items, func() {})
+}
+
+// StartRevalidation starts a re-validation in the background. It returns an
+// error for invalid options and ErrRevalidationRunning while one is running.
+func (m *Manager) StartRevalidation(ctx context.Context, opts RevalidateOptions) error {
+	items, err := m.selectRecordings(opts)
+	if err != nil {
+		return err
+	}
+
+	m.revalMu.Lock()
+	defer m.revalMu.Unlock()
+	if m.reval.Running {
+		return ErrRevalidationRunning
+	}
+	m.reval = RevalidationStatus{
+		Running:   true,
+		Options:   opts,
+		StartedAt: time.Now(),
+		Total:     len(items),
+	}
+
+	go func() {
+		report, err := m.revalidate(ctx, opts, items, func() {
+			m.revalMu.Lock()
+			m.reval.Done++
+			m.revalMu.Unlock()
+		})
+
+		m.revalMu.Lock()
+		defer m.revalMu.Unlock()
+		m.reval.Running = false
+		m.reval.FinishedAt = time.Now()
+		m.reval.Report = report
+		if err != nil {
+			m.reval.Error = err.Error()
+		}
+	}()
+	return nil
+}
+
+// RevalidationStatus returns the state of the current or last re-validation.
+func (m *Manager) RevalidationStatus() any {
+	m.revalMu.Lock()
+	defer m.revalMu.Unlock()
+	return m.reval
+}
+
+// selectRecordings returns the finished recordings matching the options.
+func (m *Manager) selectRecordings(opts RevalidateOptions) ([]revalidation, error) {
+	loc := utils.Now().Location()
+	from, err := time.ParseInLocation(time.DateOnly, opts.From, loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from date %q, want YYYY-MM-DD", opts.From)
+	}
+	to := utils.Now()
+	if opts.To != "" {
+		if to, err = time.ParseInLocation(time.DateOnly, opts.To, loc); err != nil {
+			return nil, fmt.Errorf("invalid to date %q, want YYYY-MM-DD", opts.To)
+		}
+	}
+	end := time.Date(to.Year(), to.Month(), to.Day()+1, 0, 0, 0, 0, loc)
+	if !end.After(from) {
+		return nil, errors.New("to date is before from date")
+	}
+
+	cfg := m.config.Load()
+	stations := slices.Sorted(maps.Keys(cfg.Stations))
+	if opts.Station != "" {
+		if _, ok := cfg.Stations[opts.Station]; !ok {
+			return nil, fmt.Errorf("unknown station %q", opts.Station)
+		}
+		stations = []string{opts.Station}
+	}
+
+	var items []revalidation
+	for _, station := range stations {
+		recordings, err := archive.Scan(cfg.RecordingsDir, station)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read station %s: %w", station, err)
+		}
+		for _, rec := range recordings {
+			if rec.Audio == "" || !rec.Parsed || rec.InProgress() ||
+				rec.Time.Before(from) || !rec.Time.Before(end) {
+				continue
+			}
+
+			var previous *ValidationResult
+			if path := rec.File(constants.ValidationFileSuffix); path != "" {
+				data, err := os.ReadFile(path) //nolint:gosec // G304: path is a sidecar inside the recordings directory
+				if err == nil {
+					previous, err = ParseResult(data)
+				}
+				if err != nil {
+					slog.Warn("failed to read validation result", "file", path, "error", err)
+				}
+			}
+			if previous != nil && previous.Skipped {
+				continue
+			}
+			if opts.OnlyInvalid && (previous == nil || previous.Valid) {
+				continue
+			}
+
+			items = append(items, revalidation{
+				job: ValidationJob{
+					FilePath:  rec.Audio,
+					Station:   station,
+					Timestamp: rec.Timestamp,
+				},
+				previous: previous,
+			})
+		}
+	}
+	return items, nil
+}
+
+// revalidate validates the items with the configured number of workers and
+// calls done after each one.
+func (m *Manager) revalidate(ctx context.Context, opts RevalidateOptions, items []revalidation, done func()) (*RevalidationReport, error) {
+	slog.Info("Re-validating recordings", "count", len(items), "dry_run", opts.DryRun)
+
+	report := &RevalidationReport{DryRun: opts.DryRun}
+	var mu sync.Mutex
+	queue := make(chan revalidation)
+
+	var wg sync.WaitGroup
+	for range m.workers {
+		wg.Go(func() {
+			for item := range queue {
+				result := m.validate(ctx, item.job, !opts.DryRun)
+				if ctx.Err() != nil {
+					continue // Interrupted; the analyses did not finish.
+				}
+				if !opts.DryRun {
+					m.saveResult(item.job, result)
+					if opts.Alert && !result.Valid {
+						m.sendAlert(ctx, result)
+					}
+				}
+
+				mu.Lock()
+				report.add(item.previous, result)
+				mu.Unlock()
+				done()
+			}
+		})
+	}
+
+send:
+	for _, item := range items {
+		select {
+		case queue <- item:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	slices.SortFunc(report.Recordings, func(a, b RevalidatedRecording) int {
+		return cmp.Or(cmp.Compare(a.Station, b.Station), cmp.Compare(a.Timestamp, b.Timestamp))
+	})
+	slog.Info("Re-validation finished", "checked", report.Checked, "changed", report.Changed, "dry_run", opts.DryRun)
+	return report, ctx.Err()
+}
+
+// add compares a new result with the previous one and records the change.
+func (r *RevalidationReport) add(previous, result *ValidationResult) {
+	r.Checked++
+
+	change := RevalidatedRecording{
+		Station:   result.Station,
+		Timestamp: result.Timestamp,
+		Valid:     result.Valid,
+	}
+	var oldIssues []string
+	if previous != nil {
+		change.WasValid = &previous.Valid
+		oldIssues = previous.Issues
+	}
+	for _, issue := range result.Issues {
+		if !slices.Contains(oldIssues, issue) {
+			change.AddedIssues = append(change.AddedIssues, issue)
+		}
+	}
+	for _, issue := range oldIssues {
+		if !slices.Contains(result.Issues, issue) {
+			change.ResolvedIssues = append(change.ResolvedIssues, issue)
+		}
+	}
+
+	validityChanged := previous == nil || previous.Valid != result.Valid
+	if !validityChanged && len(change.AddedIssues) == 0 && len(change.ResolvedIssues) == 0 {
+		return
+	}
+	r.Changed++
+	if validityChanged {
+		if result.Valid {
+			r.NowValid++
+		} else {
+			r.NowInvalid++
+		}
+	}
+	r.Recordings = append(r.Recordings, change)
+}
+
+// WriteRevalidationReport writes a human-readable re-validation report.
+func WriteRevalidationReport(w io.Writer, report *RevalidationReport) {
+	for _, rec := range report.Recordings {
+		was := "unvalidated"
+		if rec.WasValid != nil {
+			was = validity(*rec.WasValid)
+		}
+		_, _ = fmt.Fprintf(w, "%s/%s: %s -> %s\n", rec.Station, rec.Timestamp, was, validity(rec.Valid))
+		for _, issue := range rec.AddedIssues {
+			_, _ = fmt.Fprintf(w, "  + %s\n", issue)
+		}
+		for _, issue := range rec.ResolvedIssues {
+			_, _ = fmt.Fprintf(w, "  - %s\n", issue)
+		}
+	}
+
+	verb := "changed"
+	if report.DryRun {
+		verb = "would change"
+	}
+	_, _ = fmt.Fprintf(w, "%d recordings checked, %d %s: %d now valid, %d now invalid\n",
+		report.Checked, report.Changed, verb, report.NowValid, report.NowInvalid)
+}
+
+func validity(valid bool) string {
+	if valid {
+		return "valid"
+	}
+	return "invalid"
+}
@@ -0,0 +1,103 @@
+package validator
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+)
+
+func TestSelectRecordings(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		RecordingsDir: dir,
+		StateDir:      filepath.Join(dir, ".audiologger"),
+		Stations:      map[string]config.Station{"a": {}, "b": {}},
+	}
+	files := map[string]string{
+		"a/2026-03-31-23.mp3":             "",
+		"a/2026-04-01-00.mp3":             "",
+		"a/2026-04-01-00.validation.json": `{"valid": true}`,
+		"a/2026-04-01-01.mp3":             "",
+		"a/2026-04-01-01.validation.json": `{"valid": false, "issues": ["loop detected"]}`,
+		"a/2026-04-01-02.mp3":             "",
+		"a/2026-04-01-02.validation.json": `{"valid": true, "skipped": true}`,
+		"a/2026-04-02-00.mp3":             "",
+		"a/2026-04-02-01.mkv":             "",
+		"b/2026-04-01-05.mp3":             "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	defer m.Stop()
+
+	selected := func(opts RevalidateOptions) []string {
+		t.Helper()
+		items, err := m.selectRecordings(opts)
+		if err != nil {
+			t.Fatalf("selectRecordings(%+v) returned error: %v", opts, err)
+		}
+		var names []string
+		for _, item := range items {
+			names = append(names, item.job.Station+"/"+item.job.Timestamp)
+		}
+		return names
+	}
+
+	// Catchup recordings and recordings still being captured are left out.
+	got := selected(RevalidateOptions{From: "2026-04-01", To: "2026-04-01"})
+	if want := []string{"a/2026-04-01-00", "a/2026-04-01-01", "b/2026-04-01-05"}; !slices.Equal(got, want) {
+		t.Errorf("selected = %v, want %v", got, want)
+	}
+	got = selected(RevalidateOptions{Station: "a", From: "2026-04-01", OnlyInvalid: true})
+	if want := []string{"a/2026-04-01-01"}; !slices.Equal(got, want) {
+		t.Errorf("selected invalid = %v, want %v", got, want)
+	}
+
+	for _, opts := range []RevalidateOptions{
+		{From: "April"},
+		{From: "2026-04-02", To: "2026-04-01"},
+		{Station: "c", From: "2026-04-01"},
+	} {
+		if _, err := m.selectRecordings(opts); err == nil {
+			t.Errorf("selectRecordings(%+v) returned no error", opts)
+		}
+	}
+}
+
+func TestRevalidationReportListsChanges(t *testing.T) {
+	report := &RevalidationReport{}
+	report.add(
+		&ValidationResult{Valid: false, Issues: []string{"loop detected: 35.0% (max: 30.0%)"}},
+		&ValidationResult{Station: "a", Timestamp: "2026-04-01-01", Valid: true},
+	)
+	report.add(
+		&ValidationResult{Valid: true},
+		&ValidationResult{Station: "a", Timestamp: "2026-04-01-02", Valid: true},
+	)
+	report.add(nil, &ValidationResult{Station: "a", Timestamp: "2026-04-01-03", Valid: false, Issues: []string{"too quiet"}})
+
+	if report.Checked != 3 || report.Changed != 2 || report.NowValid != 1 || report.NowInvalid != 1 {
+		t.Errorf("report = %+v, want 3 checked, 2 changed, 1 now valid, 1 now invalid", report)
+	}
+	first := report.Recordings[0]
+	if *first.WasValid || !first.Valid || len(first.ResolvedIssues) != 1 || len(first.AddedIssues) != 0 {
+		t.Errorf("first change = %+v, want the loop issue resolved", first)
+	}
+	if second := report.Recordings[1]; second.WasValid != nil || !slices.Equal(second.AddedIssues, []string{"too quiet"}) {
+		t.Errorf("second change = %+v, want a new result with one issue", second)
+	}
+}
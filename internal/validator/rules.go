@@ -0,0 +1,316 @@
+package validator
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
+)
+
+// Rules are the validation settings for one station: the global settings with
+// the station's overrides applied. The analysis steps take their parameters
+// from Rules, and Evaluate turns their measurements into issues.
+type Rules struct {
+	MinDurationSecs    float64
+	SilenceThresholdDB float64
+	MaxSilenceSecs     float64
+	MaxLoopPercent     float64
+	Loudness           config.LoudnessConfig
+	Fingerprint        config.FingerprintConfig
+
+	checks     map[string]bool
+	exceptions []config.ValidationException
+}
+
+// NewRules resolves the validation rules for a station.
+func NewRules(cfg *config.Config, station string) *Rules {
+	v := cfg.Validation
+	r := &Rules{
+		MinDurationSecs:    float64(v.MinDurationSecs),
+		SilenceThresholdDB: v.SilenceThresholdDB,
+		MaxSilenceSecs:     v.MaxSilenceSecs,
+		MaxLoopPercent:     v.MaxLoopPercent,
+		Loudness: config.LoudnessConfig{
+			MinIntegratedLUFS: constants.DefaultMinIntegratedLUFS,
+			MaxTruePeakDBTP:   constants.DefaultMaxTruePeakDBTP,
+		},
+		Fingerprint: config.FingerprintConfig{
+			MinSimilarityPercent: constants.DefaultMinSimilarityPercent,
+			LookbackHours:        constants.DefaultFingerprintLookbackHours,
+		},
+		checks: map[string]bool{
+			constants.CheckDuration: true,
+			constants.CheckSilence:  true,
+			constants.CheckLoop:     true,
+		},
+		exceptions: v.Exceptions,
+	}
+	if v.Loudness != nil {
+		r.Loudness = *v.Loudness
+		r.checks[constants.CheckLoudness] = v.Loudness.Enabled
+	}
+	if v.Fingerprint != nil {
+		r.Fingerprint = *v.Fingerprint
+		r.checks[constants.CheckFingerprint] = v.Fingerprint.Enabled
+	}
+	for check, enabled := range v.Checks {
+		r.checks[check] = enabled
+	}
+
+	sv := cfg.Stations[station].Validation
+	if sv == nil {
+		return r
+	}
+	// Thresholds the station sets apply even when they are 0.
+	if sv.MinDurationSecs != nil {
+		r.MinDurationSecs = float64(*sv.MinDurationSecs)
+	}
+	override(&r.SilenceThresholdDB, sv.SilenceThresholdDB)
+	override(&r.MaxSilenceSecs, sv.MaxSilenceSecs)
+	override(&r.MaxLoopPercent, sv.MaxLoopPercent)
+	if l := sv.Loudness; l != nil {
+		override(&r.Loudness.MinIntegratedLUFS, l.MinIntegratedLUFS)
+		override(&r.Loudness.MaxIntegratedLUFS, l.MaxIntegratedLUFS)
+		override(&r.Loudness.MaxTruePeakDBTP, l.MaxTruePeakDBTP)
+		override(&r.Loudness.MaxMomentaryLUFS, l.MaxMomentaryLUFS)
+		override(&r.Loudness.MaxRangeLU, l.MaxRangeLU)
+		if l.Enabled != nil {
+			r.checks[constants.CheckLoudness] = *l.Enabled
+		}
+	}
+	if f := sv.Fingerprint; f != nil {
+		override(&r.Fingerprint.MinSimilarityPercent, f.MinSimilarityPercent)
+		override(&r.Fingerprint.LookbackHours, f.LookbackHours)
+		if f.Enabled != nil {
+			r.checks[constants.CheckFingerprint] = *f.Enabled
+		}
+	}
+	for check, enabled := range sv.Checks {
+		r.checks[check] = enabled
+	}
+	r.exceptions = slices.Concat(r.exceptions, sv.Exceptions)
+	return r
+}
+
+// override replaces a setting with the station's value when it sets one.
+func override[T any](setting, value *T) {
+	if value != nil {
+		*setting = *value
+	}
+}
+
+// Enabled reports whether a check runs for the station.
+func (r *Rules) Enabled(check string) bool {
+	return r.checks[check]
+}
+
+// Evaluate checks the measurements in a result against the rules and returns
+// the issues found. Only checks that are enabled and listed in measured are
+// evaluated, so a failed analysis does not also count as a failed check.
+// Evaluate also returns the checks a time-of-day exception applied to.
+func (r *Rules) Evaluate(result *ValidationResult, measured map[string]bool) (issues, waived []string) {
+	start, err := utils.ParseTimestamp(result.Timestamp)
+	hasClock := err == nil
+	end := start.Add(time.Hour)
+	if result.DurationSecs > 0 {
+		end = start.Add(secondsToDuration(result.DurationSecs))
+	}
+
+	for _, check := range []string{
+		constants.CheckDuration,
+		constants.CheckSilence,
+		constants.CheckLoop,
+		constants.CheckFingerprint,
+		constants.CheckLoudness,
+	} {
+		if !r.Enabled(check) || !measured[check] {
+			continue
+		}
+
+		var windows []span
+		if hasClock {
+			windows = r.windows(check, start, end)
+		}
+		if len(windows) > 0 {
+			waived = append(waived, check)
+			// Silences are placed in time, so only the silence inside the
+			// exception windows is ignored. The other checks measure the
+			// whole recording and are skipped altogether.
+			if check != constants.CheckSilence {
+				continue
+			}
+		}
+
+		switch check {
+		case constants.CheckDuration:
+			issues = append(issues, r.checkDuration(result)...)
+		case constants.CheckSilence:
+			issues = append(issues, r.checkSilence(result, windows)...)
+		case constants.CheckLoop:
+			issues = append(issues, r.checkLoop(result)...)
+		case constants.CheckFingerprint:
+			issues = append(issues, checkContentMatches(result)...)
+		case constants.CheckLoudness:
+			issues = append(issues, r.checkLoudness(result)...)
+		}
+	}
+	return issues, waived
+}
+
+func (r *Rules) checkDuration(result *ValidationResult) []string {
+	if result.DurationSecs >= r.MinDurationSecs {
+		return nil
+	}
+	return []string{fmt.Sprintf("duration too short: %.1fs (min: %.1fs)", result.DurationSecs, r.MinDurationSecs)}
+}
+
+// checkSilence flags the recording if a silence, leaving out the parts inside
+// the exception windows, lasts longer than allowed.
+func (r *Rules) checkSilence(result *ValidationResult, windows []span) []string {
+	var count int
+	var total, longest time.Duration
+	for _, s := range result.Silences {
+		var sLongest, sTotal time.Duration
+		if len(windows) > 0 && !s.Start.IsZero() {
+			sLongest, sTotal = uncovered(span{s.Start, s.End}, windows)
+		} else {
+			sLongest = secondsToDuration(s.DurationSecs)
+			sTotal = sLongest
+		}
+		if sTotal > 0 {
+			count++
+		}
+		total += sTotal
+		longest = max(longest, sLongest)
+	}
+
+	if longest.Seconds() <= r.MaxSilenceSecs {
+		return nil
+	}
+	return []string{fmt.Sprintf(
+		"silence detected: %.1fs continuous, %d periods totalling %.1fs (max: %.1fs)",
+		longest.Seconds(), count, total.Seconds(), r.MaxSilenceSecs,
+	)}
+}
+
+func (r *Rules) checkLoop(result *ValidationResult) []string {
+	if result.LoopPercent <= r.MaxLoopPercent {
+		return nil
+	}
+	return []string{fmt.Sprintf("loop detected: %.1f%% (max: %.1f%%)", result.LoopPercent, r.MaxLoopPercent)}
+}
+
+// checkContentMatches reports every recording with the same audio. The matches
+// were already limited to the minimum similarity when they were searched.
+func checkContentMatches(result *ValidationResult) []string {
+	var issues []string
+	for _, match := range result.ContentMatches {
+		if match.Station == result.Station {
+			issues = append(issues, fmt.Sprintf(
+				"repeats the recording of %s (%.1f%% similar)", match.Timestamp, match.SimilarityPercent,
+			))
+		} else {
+			issues = append(issues, fmt.Sprintf(
+				"same audio as %s in this hour (%.1f%% similar)", match.Station, match.SimilarityPercent,
+			))
+		}
+	}
+	return issues
+}
+
+// checkLoudness reports each loudness threshold the result exceeds.
+func (r *Rules) checkLoudness(result *ValidationResult) []string {
+	l, lc := result.Loudness, r.Loudness
+	var issues []string
+	if l.IntegratedLUFS < lc.MinIntegratedLUFS {
+		issues = append(issues, fmt.Sprintf(
+			"too quiet: %.1f LUFS integrated (min: %.1f LUFS)", l.IntegratedLUFS, lc.MinIntegratedLUFS,
+		))
+	}
+	if lc.MaxIntegratedLUFS != 0 && l.IntegratedLUFS > lc.MaxIntegratedLUFS {
+		issues = append(issues, fmt.Sprintf(
+			"too loud: %.1f LUFS integrated (max: %.1f LUFS)", l.IntegratedLUFS, lc.MaxIntegratedLUFS,
+		))
+	}
+	if l.TruePeakDBTP > lc.MaxTruePeakDBTP {
+		issues = append(issues, fmt.Sprintf(
+			"true peak too high: %.1f dBTP (max: %.1f dBTP)", l.TruePeakDBTP, lc.MaxTruePeakDBTP,
+		))
+	}
+	if lc.MaxMomentaryLUFS != 0 && l.MomentaryMaxLUFS > lc.MaxMomentaryLUFS {
+		issues = append(issues, fmt.Sprintf(
+			"momentary loudness too high: %.1f LUFS (max: %.1f LUFS)", l.MomentaryMaxLUFS, lc.MaxMomentaryLUFS,
+		))
+	}
+	if lc.MaxRangeLU != 0 && l.RangeLU > lc.MaxRangeLU {
+		issues = append(issues, fmt.Sprintf(
+			"loudness range too wide: %.1f LU (max: %.1f LU)", l.RangeLU, lc.MaxRangeLU,
+		))
+	}
+	return issues
+}
+
+// span is a period of clock time.
+type span struct {
+	start, end time.Time
+}
+
+// windows returns the exception windows for a check that overlap the period
+// from start to end.
+func (r *Rules) windows(check string, start, end time.Time) []span {
+	var windows []span
+	for _, e := range r.exceptions {
+		if len(e.Checks) > 0 && !slices.Contains(e.Checks, check) {
+			continue
+		}
+		// A window that runs past midnight may have started the day before.
+		for day := -1; day <= 1; day++ {
+			w := span{
+				start: time.Date(start.Year(), start.Month(), start.Day()+day, e.FromMinute/60, e.FromMinute%60, 0, 0, start.Location()),
+				end:   time.Date(start.Year(), start.Month(), start.Day()+day, e.ToMinute/60, e.ToMinute%60, 0, 0, start.Location()),
+			}
+			if !w.end.After(w.start) {
+				w.end = w.end.AddDate(0, 0, 1)
+			}
+			if w.start.Before(end) && w.end.After(start) {
+				windows = append(windows, w)
+			}
+		}
+	}
+	return windows
+}
+
+// uncovered returns the longest part and the total of the period s that lies
+// outside all windows.
+func uncovered(s span, windows []span) (longest, total time.Duration) {
+	windows = slices.SortedFunc(slices.Values(windows), func(a, b span) int {
+		return a.start.Compare(b.start)
+	})
+
+	cursor := s.start
+	for _, w := range windows {
+		if w.start.After(cursor) {
+			gap := minTime(w.start, s.end).Sub(cursor)
+			longest = max(longest, gap)
+			total += gap
+		}
+		if w.end.After(cursor) {
+			cursor = w.end
+		}
+		if !cursor.Before(s.end) {
+			return longest, total
+		}
+	}
+	gap := s.end.Sub(cursor)
+	return max(longest, gap), total + gap
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
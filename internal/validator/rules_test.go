@@ -0,0 +1,180 @@
+package validator
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+)
+
+// loadRulesConfig loads a config with a talk station that allows longer
+// pauses, a music station with an overnight carrier test and a news station
+// that turns loudness and fingerprinting off.
+func loadRulesConfig(t *testing.T) *config.Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := []byte(`{
+  "stations": {
+    "talk": {
+      "stream_url": "https://stream.example.com/talk.mp3",
+      "validation": {"max_silence_secs": 8, "checks": {"loop": false}}
+    },
+    "music": {
+      "stream_url": "https://stream.example.com/music.mp3",
+      "validation": {
+        "max_silence_secs": 3,
+        "max_loop_percent": 0,
+        "loudness": {"max_range_lu": 0},
+        "exceptions": [{"from": "03:00", "to": "03:15", "checks": ["silence", "loudness"]}]
+      }
+    },
+    "news": {
+      "stream_url": "https://stream.example.com/news.mp3",
+      "validation": {
+        "loudness": {"enabled": false},
+        "fingerprint": {"enabled": false, "lookback_hours": 0}
+      }
+    }
+  },
+  "validation": {
+    "enabled": true,
+    "loudness": {"enabled": true, "max_range_lu": 20},
+    "fingerprint": {"enabled": true},
+    "exceptions": [{"from": "23:30", "to": "00:30", "checks": ["duration"]}]
+  }
+}`)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	return cfg
+}
+
+// silence returns a silence interval at an offset into the 03:00 hour.
+func silence(from, to time.Duration) SilenceInterval {
+	hour := time.Date(2026, 4, 30, 3, 0, 0, 0, time.UTC)
+	return SilenceInterval{
+		StartSecs:    from.Seconds(),
+		EndSecs:      to.Seconds(),
+		DurationSecs: (to - from).Seconds(),
+		Start:        hour.Add(from),
+		End:          hour.Add(to),
+	}
+}
+
+func TestRulesApplyStationOverrides(t *testing.T) {
+	cfg := loadRulesConfig(t)
+
+	talk := NewRules(cfg, "talk")
+	if talk.MaxSilenceSecs != 8 || talk.MaxLoopPercent != constants.DefaultMaxLoopPercent {
+		t.Errorf("talk rules = %+v, want max silence 8 and the default loop percentage", talk)
+	}
+	if talk.Enabled(constants.CheckLoop) || !talk.Enabled(constants.CheckLoudness) {
+		t.Error("talk station should skip the loop check and run the global loudness check")
+	}
+
+	result := &ValidationResult{
+		Station:      "talk",
+		Timestamp:    "2026-04-30-14",
+		DurationSecs: 3600,
+		Silences:     []SilenceInterval{{StartSecs: 10, EndSecs: 17, DurationSecs: 7}},
+		LoopPercent:  90,
+	}
+	measured := map[string]bool{constants.CheckDuration: true, constants.CheckSilence: true, constants.CheckLoop: true}
+	if issues, _ := talk.Evaluate(result, measured); len(issues) != 0 {
+		t.Errorf("talk station issues = %q, want none", issues)
+	}
+
+	music := NewRules(cfg, "music")
+	if music.MaxLoopPercent != 0 {
+		t.Errorf("music max loop percent = %g, want the explicit 0", music.MaxLoopPercent)
+	}
+	result.Station = "music"
+	issues, _ := music.Evaluate(result, measured)
+	if len(issues) != 2 {
+		t.Errorf("music station issues = %q, want silence and loop", issues)
+	}
+}
+
+func TestRulesStationOverridesApplyZeroAndDisable(t *testing.T) {
+	cfg := loadRulesConfig(t)
+
+	talk := NewRules(cfg, "talk")
+	if talk.Loudness.MaxRangeLU != 20 || !talk.Enabled(constants.CheckFingerprint) {
+		t.Errorf("talk rules = %+v, want the global loudness range and fingerprinting", talk)
+	}
+	if music := NewRules(cfg, "music"); music.Loudness.MaxRangeLU != 0 || !music.Enabled(constants.CheckLoudness) {
+		t.Errorf("music rules = %+v, want the explicit 0 loudness range and the loudness check", music)
+	}
+
+	news := NewRules(cfg, "news")
+	if news.Enabled(constants.CheckLoudness) || news.Enabled(constants.CheckFingerprint) {
+		t.Error("news station should skip the loudness and fingerprint checks")
+	}
+	if news.Fingerprint.LookbackHours != 0 {
+		t.Errorf("news lookback hours = %d, want the explicit 0", news.Fingerprint.LookbackHours)
+	}
+}
+
+func TestRulesExceptionIgnoresSilenceInWindow(t *testing.T) {
+	rules := NewRules(loadRulesConfig(t), "music")
+	measured := map[string]bool{constants.CheckSilence: true, constants.CheckLoudness: true}
+
+	result := &ValidationResult{
+		Station:   "music",
+		Timestamp: "2026-04-30-03",
+		// The carrier test overruns the window by two seconds.
+		Silences: []SilenceInterval{silence(-2*time.Second, 15*time.Minute+2*time.Second)},
+		Loudness: &Loudness{IntegratedLUFS: -60, TruePeakDBTP: -20},
+	}
+	issues, waived := rules.Evaluate(result, measured)
+	if len(issues) != 0 {
+		t.Errorf("issues = %q, want none", issues)
+	}
+	if !slices.Equal(waived, []string{constants.CheckSilence, constants.CheckLoudness}) {
+		t.Errorf("waived = %q, want silence and loudness", waived)
+	}
+
+	// Dead air after the carrier test is still flagged.
+	result.Silences = append(result.Silences, silence(20*time.Minute, 25*time.Minute))
+	if issues, _ := rules.Evaluate(result, measured); len(issues) != 1 {
+		t.Errorf("issues = %q, want the silence after the window", issues)
+	}
+
+	// Silence starting inside the window only counts from its end.
+	result.Silences = []SilenceInterval{silence(10*time.Minute, 15*time.Minute+5*time.Second)}
+	if issues, _ := rules.Evaluate(result, measured); len(issues) != 1 {
+		t.Errorf("issues = %q, want the 5 seconds after the window", issues)
+	}
+}
+
+func TestRulesExceptionPastMidnight(t *testing.T) {
+	rules := NewRules(loadRulesConfig(t), "music")
+	measured := map[string]bool{constants.CheckDuration: true}
+
+	for _, tc := range []struct {
+		timestamp string
+		waived    bool
+	}{
+		{"2026-04-30-23", true},
+		{"2026-05-01-00", true},
+		{"2026-05-01-01", false},
+		{"2026-04-30-22", false},
+	} {
+		result := &ValidationResult{Station: "music", Timestamp: tc.timestamp, DurationSecs: 3000}
+		issues, waived := rules.Evaluate(result, measured)
+		if got := len(waived) == 1; got != tc.waived {
+			t.Errorf("%s: waived = %q, want waived %v", tc.timestamp, waived, tc.waived)
+		}
+		if got := len(issues) == 0; got != tc.waived {
+			t.Errorf("%s: issues = %q", tc.timestamp, issues)
+		}
+	}
+}
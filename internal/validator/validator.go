@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
-	"os"
 	"path/filepath"
+	"reflect"
 	"runtime/debug"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/oszuidwest/zwfm-audiologger/internal/archive"
 	"github.com/oszuidwest/zwfm-audiologger/internal/config"
 	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
 	"github.com/oszuidwest/zwfm-audiologger/internal/recorder"
@@ -23,59 +26,124 @@ var (
 
 // ValidationJob represents a file to be validated.
 type ValidationJob struct {
-	FilePath  string
-	Station   string
-	Timestamp string
+	FilePath  string    `json:"file_path"`
+	Station   string    `json:"station"`
+	Timestamp string    `json:"timestamp"`
+	Priority  int       `json:"priority"`
+	Seq       uint64    `json:"seq"`
+	QueuedAt  time.Time `json:"queued_at"`
+
+	running bool
 }
 
 // Manager handles recording validation.
 type Manager struct {
-	config  *config.Config
-	queue   chan ValidationJob
-	alerter *Alerter
-	ctx     context.Context
-	cancel  context.CancelFunc
+	config    atomic.Pointer[config.Config]
+	workers   int
+	queuePath string
+	wake      chan struct{}
+	alerter   atomic.Pointer[Alerter] // nil when alerts are disabled.
+	observers []recorder.FileObserver
+	ctx       context.Context
+	cancel    context.CancelFunc
+
+	mu     sync.Mutex
+	jobs   []ValidationJob
+	seq    uint64
+	status QueueStatus
+
+	revalMu sync.Mutex
+	reval   RevalidationStatus
 }
 
-// New creates a new validation manager.
-func New(cfg *config.Config) *Manager {
+// New creates a new validation manager and loads any queue left by a
+// previous run.
+func New(cfg *config.Config) (*Manager, error) {
+	if err := utils.EnsureDir(cfg.StateDir); err != nil {
+		return nil, err
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	m := &Manager{
-		config: cfg,
-		queue:  make(chan ValidationJob, constants.ValidationQueueSize),
-		ctx:    ctx,
-		cancel: cancel,
+		workers:   1,
+		queuePath: filepath.Join(cfg.StateDir, constants.ValidationQueueFile),
+		wake:      make(chan struct{}, 1),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	if err := m.load(); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	m.config.Store(cfg)
+	if cfg.Validation != nil {
+		m.workers = max(cfg.Validation.Workers, 1)
+		m.alerter.Store(newAlerter(cfg.Validation))
+	}
+
+	return m, nil
+}
+
+// Reload applies new thresholds, checks and alert settings. Validations in
+// progress finish with the settings they started with. The number of workers
+// only changes on restart.
+func (m *Manager) Reload(cfg *config.Config) {
+	old := m.config.Swap(cfg)
+	if cfg.Validation == nil {
+		return
 	}
+	if old.Validation == nil ||
+		!reflect.DeepEqual(old.Validation.Alert, cfg.Validation.Alert) ||
+		!reflect.DeepEqual(old.Validation.StationRecipients, cfg.Validation.StationRecipients) {
+		m.alerter.Store(newAlerter(cfg.Validation))
+	}
+}
 
-	// Initialize alerter if configured.
-	if cfg.Validation != nil && cfg.Validation.Alert != nil && cfg.Validation.Alert.Enabled {
-		m.alerter = NewAlerter(cfg.Validation.Alert, cfg.Validation.StationRecipients)
+// newAlerter returns the alerter for the validation settings, or nil when
+// alerts are disabled.
+func newAlerter(v *config.ValidationConfig) *Alerter {
+	if v.Alert == nil || !v.Alert.Enabled {
+		return nil
 	}
+	return NewAlerter(v.Alert, v.StationRecipients)
+}
+
+// AddObserver registers an observer for the validation sidecars the validator
+// writes. It must be called before Start.
+func (m *Manager) AddObserver(o recorder.FileObserver) {
+	m.observers = append(m.observers, o)
+}
 
-	return m
+// notifyCompleted informs all observers that a sidecar is finished.
+func (m *Manager) notifyCompleted(station, timestamp, path string) {
+	for _, o := range m.observers {
+		o.FileCompleted(station, timestamp, path)
+	}
 }
 
-// Start begins the validation worker and scans for unvalidated files.
+// Start runs the validation workers and scans for unvalidated files. Jobs
+// left in the queue by a previous run are resumed.
 func (m *Manager) Start(ctx context.Context) error {
-	slog.Info("Validator started")
+	slog.Info("Validator started", "workers", m.workers, "queued", len(m.jobs))
 
 	// Scan for unvalidated files on startup.
 	go m.scanUnvalidated()
 
-	// Run worker loop.
-	for {
-		select {
-		case <-ctx.Done():
-			slog.Info("Validator shutting down")
-			m.cancel()
-			return nil
-		case <-m.ctx.Done():
-			return nil
-		case job := <-m.queue:
-			m.processJob(job)
-		}
+	var wg sync.WaitGroup
+	for range m.workers {
+		wg.Go(m.work)
+	}
+
+	select {
+	case <-ctx.Done():
+		slog.Info("Validator shutting down")
+		m.cancel()
+	case <-m.ctx.Done():
 	}
+	wg.Wait()
+	return nil
 }
 
 // Stop gracefully stops the validator.
@@ -87,13 +155,14 @@ func (m *Manager) Stop() {
 // Called by the recorder for any recording failure: directory creation error,
 // insufficient disk space, disk check error, FFmpeg failure, or remux failure.
 func (m *Manager) NotifyRecordingFailure(station, reason string) {
-	if m.alerter == nil {
+	alerter := m.alerter.Load()
+	if alerter == nil {
 		return
 	}
 	failedAt := utils.Now()
 	ctx, cancel := context.WithTimeout(context.Background(), constants.AlertNotifyTimeout)
 	defer cancel()
-	if err := m.alerter.SendRecordingFailure(ctx, station, reason, failedAt); err != nil {
+	if err := alerter.SendRecordingFailure(ctx, station, reason, failedAt); err != nil {
 		slog.Error("failed to send recording failure alert", "station", station, "error", err)
 	}
 }
@@ -116,23 +185,20 @@ func (m *Manager) MarkSkipped(filePath, station, timestamp string) {
 			"file", validationFile,
 			"error", err,
 		)
+		return
 	}
+	m.notifyCompleted(station, timestamp, validationFile)
 }
 
-// Enqueue adds a file to the validation queue (non-blocking).
+// Enqueue adds a finished recording to the validation queue. It is validated
+// before any backlog.
 func (m *Manager) Enqueue(filePath, station, timestamp string) {
-	job := ValidationJob{
+	m.add(priorityFresh, ValidationJob{
 		FilePath:  filePath,
 		Station:   station,
 		Timestamp: timestamp,
-	}
-
-	select {
-	case m.queue <- job:
-		slog.Debug("queued for validation", "file", filePath)
-	default:
-		slog.Warn("validation queue full, skipping", "file", filePath)
-	}
+	})
+	slog.Debug("queued for validation", "file", filePath)
 }
 
 // scanUnvalidated finds recordings without validation files and queues them.
@@ -146,111 +212,193 @@ func (m *Manager) scanUnvalidated() {
 
 	slog.Info("Scanning for unvalidated recordings")
 
-	for stationName := range m.config.Stations {
-		stationDir := filepath.Join(m.config.RecordingsDir, stationName)
-
-		entries, err := os.ReadDir(stationDir)
+	cfg := m.config.Load()
+	var jobs []ValidationJob
+	for stationName := range cfg.Stations {
+		// Scan skips the originals kept next to transcoded recordings.
+		recordings, err := archive.Scan(cfg.RecordingsDir, stationName)
 		if err != nil {
-			if !os.IsNotExist(err) {
-				slog.Warn("failed to scan station directory", "station", stationName, "error", err)
-			}
+			slog.Warn("failed to scan station directory", "station", stationName, "error", err)
 			continue
 		}
 
-		for _, entry := range entries {
-			if entry.IsDir() {
-				continue
-			}
-
-			name := entry.Name()
-
-			// Skip non-audio files and validation/metadata files.
-			if !utils.IsAudioFile(name) {
+		for _, rec := range recordings {
+			if rec.Audio == "" || rec.File(constants.ValidationFileSuffix) != "" {
 				continue
 			}
-
-			// Check if validation file exists.
-			filePath := filepath.Join(stationDir, name)
-			validationFile := utils.SidecarPath(filePath, constants.ValidationFileSuffix)
-
-			if _, err := os.Stat(validationFile); os.IsNotExist(err) {
-				baseName := filepath.Base(name)
-				baseName = baseName[:len(baseName)-len(filepath.Ext(baseName))]
-				m.Enqueue(filePath, stationName, baseName)
-			}
+			jobs = append(jobs, ValidationJob{
+				FilePath:  rec.Audio,
+				Station:   stationName,
+				Timestamp: rec.Timestamp,
+			})
 		}
 	}
 
-	slog.Info("Finished scanning for unvalidated recordings")
+	if len(jobs) > 0 {
+		m.add(priorityBacklog, jobs...)
+	}
+	slog.Info("Finished scanning for unvalidated recordings", "found", len(jobs))
 }
 
-// processJob validates a single recording.
+// processJob validates a single recording, saves the result and sends an
+// alert if it failed.
 func (m *Manager) processJob(job ValidationJob) {
 	slog.Info("Validating recording", "file", job.FilePath, "station", job.Station)
 
+	result := m.validate(m.ctx, job, true)
+
+	// A shutdown interrupts the analyses. Leave the job queued so that it
+	// runs again on the next start, instead of saving a false failure.
+	if m.ctx.Err() != nil {
+		slog.Info("Validation interrupted, will resume on restart", "file", job.FilePath)
+		return
+	}
+	m.recordResult(result)
+	m.saveResult(job, result)
+	if !result.Valid {
+		m.sendAlert(m.ctx, result)
+	}
+}
+
+// validate runs the checks enabled for the station on a recording. With write
+// set the fingerprint is stored as a sidecar; without it nothing is written.
+func (m *Manager) validate(ctx context.Context, job ValidationJob, write bool) *ValidationResult {
 	result := &ValidationResult{
 		Station:     job.Station,
 		Timestamp:   job.Timestamp,
 		ValidatedAt: time.Now(),
 		Valid:       true,
 	}
+	rules := NewRules(m.config.Load(), job.Station)
+	measured := make(map[string]bool)
 
-	// Analyze duration.
-	duration, err := m.analyzeDuration(m.ctx, job.FilePath)
+	// Analyze duration. The duration is also needed for the silence share.
+	duration, err := m.analyzeDuration(ctx, job.FilePath)
 	if err != nil {
-		m.recordAnalysisError(result, "duration", job.FilePath, err)
+		m.recordAnalysisError(result, constants.CheckDuration, job.FilePath, err)
 	} else {
 		result.DurationSecs = duration
-		minDuration := float64(m.config.Validation.MinDurationSecs)
-		if duration < minDuration {
-			m.recordIssue(result, fmt.Sprintf("duration too short: %.1fs (min: %.1fs)", duration, minDuration))
-		}
+		measured[constants.CheckDuration] = true
 	}
 
 	// Analyze silence.
-	maxSilence, err := m.analyzeSilence(m.ctx, job.FilePath)
-	if err != nil {
-		m.recordAnalysisError(result, "silence", job.FilePath, err)
-	} else {
-		// Calculate silence as percentage of total duration.
-		if result.DurationSecs > 0 {
-			result.SilencePercent = (maxSilence / result.DurationSecs) * 100
-		}
-		if maxSilence > m.config.Validation.MaxSilenceSecs {
-			m.recordIssue(result, fmt.Sprintf(
-				"silence detected: %.1fs continuous (max: %.1fs)", maxSilence, m.config.Validation.MaxSilenceSecs,
-			))
+	if rules.Enabled(constants.CheckSilence) {
+		silences, err := m.analyzeSilence(ctx, job.FilePath, result.DurationSecs, rules)
+		if err != nil {
+			m.recordAnalysisError(result, constants.CheckSilence, job.FilePath, err)
+		} else {
+			setClockTimes(silences, job.Timestamp)
+			result.Silences = silences
+
+			var totalSilence float64
+			for _, s := range silences {
+				totalSilence += s.DurationSecs
+			}
+			if result.DurationSecs > 0 {
+				result.SilencePercent = min(totalSilence/result.DurationSecs*100, 100)
+			}
+			measured[constants.CheckSilence] = true
 		}
 	}
 
 	// Analyze loops.
-	loopPercent, err := m.analyzeLoops(m.ctx, job.FilePath)
-	if err != nil {
-		m.recordAnalysisError(result, "loop", job.FilePath, err)
-	} else {
-		result.LoopPercent = loopPercent
-		if loopPercent > m.config.Validation.MaxLoopPercent {
-			m.recordIssue(result, fmt.Sprintf(
-				"loop detected: %.1f%% (max: %.1f%%)", loopPercent, m.config.Validation.MaxLoopPercent,
-			))
+	if rules.Enabled(constants.CheckLoop) {
+		loopPercent, err := m.analyzeLoops(ctx, job.FilePath)
+		if err != nil {
+			m.recordAnalysisError(result, constants.CheckLoop, job.FilePath, err)
+		} else {
+			result.LoopPercent = loopPercent
+			measured[constants.CheckLoop] = true
+		}
+	}
+
+	// Fingerprint the audio and compare it with earlier hours and other stations.
+	if rules.Enabled(constants.CheckFingerprint) {
+		measured[constants.CheckFingerprint] = m.matchContent(ctx, result, job, rules, write)
+	}
+
+	// Analyze loudness.
+	if rules.Enabled(constants.CheckLoudness) {
+		loudness, err := m.analyzeLoudness(ctx, job.FilePath)
+		if err != nil {
+			m.recordAnalysisError(result, constants.CheckLoudness, job.FilePath, err)
+		} else {
+			result.Loudness = loudness
+			measured[constants.CheckLoudness] = true
 		}
 	}
 
-	// Save validation result.
+	// Check the measurements against the station's rules.
+	issues, waived := rules.Evaluate(result, measured)
+	for _, issue := range issues {
+		m.recordIssue(result, issue)
+	}
+	result.WaivedChecks = waived
+	return result
+}
+
+// saveResult writes the validation sidecar of a recording.
+func (m *Manager) saveResult(job ValidationJob, result *ValidationResult) {
 	validationFile := utils.SidecarPath(job.FilePath, constants.ValidationFileSuffix)
 
 	if err := result.Save(validationFile); err != nil {
 		slog.Error("failed to save validation result", "file", validationFile, "error", err)
-	} else {
-		slog.Info("Validation result saved", "file", validationFile, "valid", result.Valid)
+		return
+	}
+	slog.Info("Validation result saved", "file", validationFile, "valid", result.Valid)
+	m.notifyCompleted(job.Station, job.Timestamp, validationFile)
+}
+
+// sendAlert sends an alert for a failed validation if the alerter is configured.
+func (m *Manager) sendAlert(ctx context.Context, result *ValidationResult) {
+	alerter := m.alerter.Load()
+	if alerter == nil {
+		return
+	}
+	if err := alerter.Send(ctx, result); err != nil {
+		slog.Error("failed to send validation alert", "error", err)
+	}
+}
+
+// matchContent lists the other recordings with the same audio in the result
+// and, with write set, stores the fingerprint of the recording as a sidecar.
+// It reports whether the fingerprint could be computed.
+func (m *Manager) matchContent(ctx context.Context, result *ValidationResult, job ValidationJob, rules *Rules, write bool) bool {
+	fp, err := m.analyzeFingerprint(ctx, job.FilePath)
+	if err != nil {
+		m.recordAnalysisError(result, constants.CheckFingerprint, job.FilePath, err)
+		return false
 	}
 
-	// Send alert if invalid and alerter is configured.
-	if !result.Valid && m.alerter != nil {
-		if err := m.alerter.Send(m.ctx, result); err != nil {
-			slog.Error("failed to send validation alert", "error", err)
+	if write {
+		fingerprintFile := utils.SidecarPath(job.FilePath, constants.FingerprintFileSuffix)
+		if err := fp.Save(fingerprintFile); err != nil {
+			slog.Error("failed to save fingerprint", "file", fingerprintFile, "error", err)
+		} else {
+			m.notifyCompleted(job.Station, job.Timestamp, fingerprintFile)
 		}
 	}
+
+	result.ContentMatches = m.findContentMatches(job.Station, job.Timestamp, fp, rules.Fingerprint)
+	return true
+}
+
+// setClockTimes fills in the clock times of silence intervals from the
+// recording timestamp. Validated recordings start on the hour, because catchup
+// recordings are not validated.
+func setClockTimes(silences []SilenceInterval, timestamp string) {
+	start, err := utils.ParseTimestamp(timestamp)
+	if err != nil {
+		return
+	}
+	for i := range silences {
+		silences[i].Start = start.Add(secondsToDuration(silences[i].StartSecs))
+		silences[i].End = start.Add(secondsToDuration(silences[i].EndSecs))
+	}
+}
+
+func secondsToDuration(secs float64) time.Duration {
+	return time.Duration(secs * float64(time.Second)).Round(time.Millisecond)
 }
 
 // recordAnalysisError logs an analysis error and records it in the result.
@@ -19,7 +19,10 @@ func TestMarkSkipped(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	m := validator.New(&config.Config{RecordingsDir: dir})
+	m, err := validator.New(&config.Config{RecordingsDir: dir, StateDir: dir})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
 	t.Cleanup(m.Stop)
 
 	const station = "teststation"
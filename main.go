@@ -14,9 +14,17 @@ import (
 	_ "time/tzdata" // Ensures timezone functionality across all platforms
 
 	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+	"github.com/oszuidwest/zwfm-audiologger/internal/index"
+	"github.com/oszuidwest/zwfm-audiologger/internal/layout"
+	"github.com/oszuidwest/zwfm-audiologger/internal/manifest"
+	"github.com/oszuidwest/zwfm-audiologger/internal/proxy"
 	"github.com/oszuidwest/zwfm-audiologger/internal/recorder"
+	"github.com/oszuidwest/zwfm-audiologger/internal/retention"
 	"github.com/oszuidwest/zwfm-audiologger/internal/scheduler"
 	"github.com/oszuidwest/zwfm-audiologger/internal/server"
+	"github.com/oszuidwest/zwfm-audiologger/internal/tier"
+	"github.com/oszuidwest/zwfm-audiologger/internal/tsa"
+	"github.com/oszuidwest/zwfm-audiologger/internal/uploader"
 	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
 	"github.com/oszuidwest/zwfm-audiologger/internal/validator"
 )
@@ -30,9 +38,17 @@ var (
 
 func main() {
 	// Initialize structured logger
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	// Secrets from the config are redacted from every log line.
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{ReplaceAttr: utils.RedactAttr}))
 	slog.SetDefault(logger)
 
+	// Run a one-shot subcommand such as "verify" if one is given.
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(cmd(os.Args[2:]))
+		}
+	}
+
 	// Parse command-line flags
 	configFile := flag.String("config", "config.json", "Config file path")
 	testMode := flag.Bool("test", false, "Test recording (10 seconds)")
@@ -53,12 +69,17 @@ func main() {
 	// Load configuration
 	cfg, err := config.Load(*configFile)
 	if err != nil {
-		slog.Error("failed to load config", "error", err)
+		logConfigError(err)
 		os.Exit(1)
 	}
+	utils.AddSecrets(cfg.Secrets()...)
 
 	// Set the timezone from config
 	utils.SetTimezone(cfg.Timezone)
+	if err := layout.Set(cfg.Layout); err != nil {
+		slog.Error("invalid layout", "error", err)
+		os.Exit(1)
+	}
 
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
@@ -73,10 +94,18 @@ func main() {
 		cancel()
 	}()
 
+	// SIGHUP reloads the configuration instead of stopping the process.
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
 	// Initialize validator if enabled.
 	var validatorManager *validator.Manager
 	if cfg.Validation != nil && cfg.Validation.Enabled {
-		validatorManager = validator.New(cfg)
+		validatorManager, err = validator.New(cfg)
+		if err != nil {
+			slog.Error("failed to initialize validator", "error", err)
+			os.Exit(1)
+		}
 	}
 
 	// Build non-nil interface values only when the validator is active. Passing a
@@ -90,8 +119,20 @@ func main() {
 		notifier = validatorManager
 	}
 
-	// Initialize components.
-	recorderManager := recorder.New(cfg, validatorIface, notifier)
+	// Initialize the archive tier if enabled.
+	var archiveTier tier.Tier
+	if cfg.ArchiveTier != nil && cfg.ArchiveTier.Enabled {
+		archiveTier, err = tier.New(cfg.ArchiveTier)
+		if err != nil {
+			slog.Error("failed to initialize archive tier", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Initialize components. The cleaner is shared so the recorder can free
+	// space just in time when a quota is configured.
+	cleaner := retention.New(cfg, archiveTier)
+	recorderManager := recorder.New(cfg, validatorIface, notifier, cleaner)
 
 	// Run test mode if requested.
 	if *testMode {
@@ -99,25 +140,113 @@ func main() {
 		return
 	}
 
+	srv := server.New(cfg, recorderManager, archiveTier)
+	if validatorManager != nil {
+		srv.AddReporter("validation", validatorManager)
+		srv.SetRevalidator(validatorManager)
+	}
+
+	// Initialize timestamping if enabled. It requests a token for every
+	// finished recording.
+	var timestampManager *tsa.Manager
+	if cfg.Timestamping != nil && cfg.Timestamping.Enabled {
+		timestampManager, err = tsa.New(cfg)
+		if err != nil {
+			slog.Error("failed to initialize timestamping", "error", err)
+			os.Exit(1)
+		}
+		recorderManager.AddObserver(timestampManager)
+		srv.AddReporter("timestamping", timestampManager)
+	}
+
+	// addFileObserver registers o for every finished recording, sidecar and
+	// timestamp token.
+	addFileObserver := func(o recorder.FileObserver) {
+		recorderManager.AddObserver(o)
+		if validatorManager != nil {
+			validatorManager.AddObserver(o)
+		}
+		if timestampManager != nil {
+			timestampManager.AddObserver(o)
+		}
+	}
+
+	// Initialize uploader if enabled.
+	var uploadManager *uploader.Manager
+	if cfg.Upload != nil && cfg.Upload.Enabled {
+		uploadManager, err = uploader.New(cfg)
+		if err != nil {
+			slog.Error("failed to initialize uploader", "error", err)
+			os.Exit(1)
+		}
+		addFileObserver(uploadManager)
+		srv.AddReporter("upload", uploadManager)
+	}
+
+	// Initialize proxy generation if enabled. Every finished recording gets a
+	// low-bitrate copy for listening back.
+	var proxyManager *proxy.Manager
+	if cfg.Proxy != nil && cfg.Proxy.Enabled {
+		proxyManager, err = proxy.New(cfg)
+		if err != nil {
+			slog.Error("failed to initialize proxy generation", "error", err)
+			os.Exit(1)
+		}
+		recorderManager.AddObserver(proxyManager)
+		srv.AddReporter("proxy", proxyManager)
+	}
+
+	// The archive index follows every finished and removed file, and every
+	// recording moved to the archive tier, for search and fast directory
+	// listings.
+	archiveIndex := index.New(cfg, archiveTier)
+	addFileObserver(archiveIndex)
+	cleaner.AddObserver(archiveIndex)
+	srv.SetIndex(archiveIndex)
+
+	// Initialize integrity manifests if enabled. Every finished file is hashed
+	// and every file removed by retention is recorded.
+	if cfg.Integrity != nil && cfg.Integrity.Enabled {
+		manifestManager := manifest.New(cfg, archiveTier)
+		addFileObserver(manifestManager)
+		cleaner.AddObserver(manifestManager)
+		srv.SetVerifier(manifestManager)
+	}
+
 	// Start components concurrently using goroutines
 	var wg sync.WaitGroup
 
 	// Start HTTP server for status and file browsing
 	wg.Go(func() {
-		srv := server.New(cfg, recorderManager)
 		if err := srv.Start(ctx); err != nil {
 			slog.Error("HTTP server error", "error", err)
 		}
 	})
 
 	// Start scheduler for ALL stations (always record as failsafe).
+	sched := scheduler.New(cfg, recorderManager, cleaner, archiveTier)
+	sched.AddMoveObserver(archiveIndex)
 	wg.Go(func() {
-		sched := scheduler.New(cfg, recorderManager)
 		if err := sched.Start(ctx); err != nil {
 			slog.Error("Scheduler error", "error", err)
 		}
 	})
 
+	// Bring the archive index up to date and save it as it changes.
+	wg.Go(func() {
+		if err := archiveIndex.Start(ctx); err != nil {
+			slog.Error("Archive index error", "error", err)
+		}
+	})
+
+	// Reload the configuration on SIGHUP or when the file changes.
+	components := []reloadable{sched, cleaner, srv, archiveIndex}
+	if validatorManager != nil {
+		components = append(components, validatorManager)
+	}
+	watcher := newConfigWatcher(*configFile, cfg, components...)
+	wg.Go(func() { watcher.run(ctx, hangup) })
+
 	// Start validator if enabled.
 	if validatorManager != nil {
 		wg.Go(func() {
@@ -127,6 +256,33 @@ func main() {
 		})
 	}
 
+	// Start timestamping if enabled.
+	if timestampManager != nil {
+		wg.Go(func() {
+			if err := timestampManager.Start(ctx); err != nil {
+				slog.Error("Timestamping error", "error", err)
+			}
+		})
+	}
+
+	// Start uploader if enabled.
+	if uploadManager != nil {
+		wg.Go(func() {
+			if err := uploadManager.Start(ctx); err != nil {
+				slog.Error("Uploader error", "error", err)
+			}
+		})
+	}
+
+	// Start proxy generation if enabled.
+	if proxyManager != nil {
+		wg.Go(func() {
+			if err := proxyManager.Start(ctx); err != nil {
+				slog.Error("Proxy generation error", "error", err)
+			}
+		})
+	}
+
 	// Wait for all components to finish.
 	wg.Wait()
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/oszuidwest/zwfm-audiologger/internal/config"
+	"github.com/oszuidwest/zwfm-audiologger/internal/constants"
+	"github.com/oszuidwest/zwfm-audiologger/internal/utils"
+)
+
+// reloadable is implemented by components that apply a new configuration
+// while running.
+type reloadable interface {
+	Reload(cfg *config.Config)
+}
+
+// configWatcher reloads the configuration on SIGHUP and when the file or a
+// file it includes changes.
+type configWatcher struct {
+	path       string
+	current    *config.Config
+	components []reloadable
+	state      string
+}
+
+// newConfigWatcher returns a watcher for the configuration loaded from path.
+func newConfigWatcher(path string, cfg *config.Config, components ...reloadable) *configWatcher {
+	w := &configWatcher{path: path, current: cfg, components: components}
+	w.state = w.stat()
+	return w
+}
+
+// run reloads the configuration on every signal from hangup, and when the file
+// changes on disk, until ctx is cancelled.
+func (w *configWatcher) run(ctx context.Context, hangup <-chan os.Signal) {
+	ticker := time.NewTicker(constants.ConfigPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			slog.Info("Received SIGHUP, reloading config", "file", w.path)
+			w.reload()
+			w.state = w.stat()
+		case <-ticker.C:
+			state := w.stat()
+			if state == w.state {
+				continue
+			}
+			slog.Info("Config file changed, reloading", "file", w.path)
+			w.reload()
+			w.state = w.stat()
+		}
+	}
+}
+
+// stat describes the modification time and size of the config file, the
+// files it includes and the directories they are included from. Any change,
+// including a file added to an included directory, changes the result.
+func (w *configWatcher) stat() string {
+	paths := append([]string{w.path}, w.current.Files()...)
+	for _, pattern := range w.current.Include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(w.path), pattern)
+		}
+		paths = append(paths, filepath.Dir(pattern))
+	}
+
+	var b strings.Builder
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&b, "%s %d %d\n", path, info.ModTime().UnixNano(), info.Size())
+		}
+	}
+	return b.String()
+}
+
+// reload loads and validates the config file and hands it to every component.
+// An invalid file is rejected as a whole and the running configuration stays.
+func (w *configWatcher) reload() {
+	next, err := config.Load(w.path)
+	if err != nil {
+		logConfigError(err)
+		slog.Error("config reload rejected, keeping the running config", "file", w.path)
+		return
+	}
+	utils.AddSecrets(next.Secrets()...)
+
+	applied, changes, restart := w.current.Reload(next)
+	for _, setting := range restart {
+		slog.Warn("config setting changed but only takes effect after a restart", "setting", setting)
+	}
+	w.current = applied
+	if len(changes) == 0 {
+		slog.Info("Config reloaded, no changes")
+		return
+	}
+	for _, change := range changes {
+		slog.Info("Config changed", "change", change)
+	}
+
+	for _, c := range w.components {
+		c.Reload(applied)
+	}
+	slog.Info("Config reloaded", "changes", len(changes))
+}
+
+// logConfigError logs every invalid setting of a rejected configuration.
+func logConfigError(err error) {
+	var invalid *config.ValidationError
+	if errors.As(err, &invalid) {
+		for _, problem := range invalid.Problems {
+			slog.Error("invalid config setting", "path", problem.Path, "problem", problem.Message)
+		}
+		return
+	}
+	slog.Error("failed to load config", "error", err)
+}